@@ -40,6 +40,14 @@ type ForRangeStmt struct {
 
 func (t ForRangeStmt) stmt() {}
 
+type ForInStmt struct {
+	Variable string
+	Expr     Expr
+	Body     Statement
+}
+
+func (t ForInStmt) stmt() {}
+
 type IfStmt struct {
 	Condition   Expr
 	Body        Statement
@@ -125,6 +133,7 @@ func (t MatchCaseRange) matchCaseCondition() {}
 type MatchCaseTypeError struct {
 	Message MatchCaseCondition
 	Data    MatchCaseCondition
+	Cause   MatchCaseCondition
 }
 
 func (t MatchCaseTypeError) matchCaseCondition() {}
@@ -141,6 +150,15 @@ type MatchCaseTypeNumber struct {
 
 func (t MatchCaseTypeNumber) matchCaseCondition() {}
 
+// MatchCaseRegex matches a string against Pattern, Cond is matched against
+// the captured groups, an array or an object of the named groups.
+type MatchCaseRegex struct {
+	Pattern string
+	Cond    *MatchCaseCondition
+}
+
+func (t MatchCaseRegex) matchCaseCondition() {}
+
 type MatchCaseOr struct {
 	Conditions []MatchCaseCondition
 }
@@ -158,3 +176,18 @@ type GotoStmt struct {
 }
 
 func (t GotoStmt) stmt() {}
+
+type TryStmt struct {
+	Body     Statement
+	CatchVar *string
+	Catch    *Statement
+	Finally  *Statement
+}
+
+func (t TryStmt) stmt() {}
+
+type DeferStmt struct {
+	Expr Expr
+}
+
+func (t DeferStmt) stmt() {}
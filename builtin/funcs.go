@@ -5,12 +5,13 @@ import (
 	"math/rand/v2"
 	"strconv"
 	"time"
+	"unicode/utf8"
 
 	"github.com/joetifa2003/weaver/vm"
 )
 
 func registerBuiltinFuncs(builder *vm.RegistryBuilder) {
-	builder.RegisterFunc("error", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	builder.RegisterFuncWithMembers("error", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
 		msgArg, ok := args.Get(0, vm.ValueTypeString)
 		if !ok {
 			return msgArg, false
@@ -25,6 +26,50 @@ func registerBuiltinFuncs(builder *vm.RegistryBuilder) {
 		}
 
 		return vm.NewError(msgArg.GetString(), dataArg), true
+	}, map[string]vm.Value{
+		"wrap": vm.NewNativeFunction("error.wrap", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			errArg, ok := args.Get(0, vm.ValueTypeError)
+			if !ok {
+				return errArg, false
+			}
+
+			msgArg, ok := args.Get(1, vm.ValueTypeString)
+			if !ok {
+				return msgArg, false
+			}
+
+			var data vm.Value
+			if len(args.Args) > 2 {
+				data = args.Args[2]
+			}
+
+			return vm.NewWrappedError(msgArg.GetString(), data, errArg), true
+		}),
+		"cause": vm.NewNativeFunction("error.cause", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			errArg, ok := args.Get(0, vm.ValueTypeError)
+			if !ok {
+				return errArg, false
+			}
+
+			return errArg.GetError().Cause(), true
+		}),
+		"is": vm.NewNativeFunction("error.is", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			errArg, ok := args.Get(0)
+			if !ok {
+				return errArg, false
+			}
+
+			targetArg, ok := args.Get(1, vm.ValueTypeError, vm.ValueTypeString)
+			if !ok {
+				return targetArg, false
+			}
+
+			if !errArg.IsError() {
+				return vm.NewBool(false), true
+			}
+
+			return vm.NewBool(errArg.GetError().Contains(targetArg)), true
+		}),
 	})
 
 	builder.RegisterFunc("isError", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
@@ -42,8 +87,15 @@ func registerBuiltinFuncs(builder *vm.RegistryBuilder) {
 			return timeArg, false
 		}
 
-		time.Sleep(time.Duration(timeArg.GetNumber()) * time.Millisecond)
-		return vm.Value{}, true
+		timer := time.NewTimer(time.Duration(timeArg.GetNumber()) * time.Millisecond)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			return vm.Value{}, true
+		case <-v.Ctx.Done():
+			return vm.NewCancelled(), false
+		}
 	})
 
 	builder.RegisterFunc("assert", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
@@ -73,8 +125,10 @@ func registerBuiltinFuncs(builder *vm.RegistryBuilder) {
 		return vm.NewNumber(rand.Float64()), true
 	})
 
+	// len counts the runes of a string like the strings module does,
+	// strings.bytes gives the bytes.
 	builder.RegisterFunc("len", func(x *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
-		val, ok := args.Get(0, vm.ValueTypeArray, vm.ValueTypeString, vm.ValueTypeObject)
+		val, ok := args.Get(0, vm.ValueTypeArray, vm.ValueTypeString, vm.ValueTypeBytes, vm.ValueTypeObject, vm.ValueTypeChannel)
 		if !ok {
 			return val, false
 		}
@@ -84,9 +138,13 @@ func registerBuiltinFuncs(builder *vm.RegistryBuilder) {
 		case vm.ValueTypeArray:
 			res.SetNumber(float64(len(*val.GetArray())))
 		case vm.ValueTypeString:
-			res.SetNumber(float64(len(val.GetString())))
+			res.SetNumber(float64(utf8.RuneCountInString(val.GetString())))
+		case vm.ValueTypeBytes:
+			res.SetNumber(float64(len(val.GetBytes())))
 		case vm.ValueTypeObject:
 			res.SetNumber(float64(len(val.GetObject())))
+		case vm.ValueTypeChannel:
+			res.SetNumber(float64(len(val.GetChannel())))
 		default:
 			return vm.NewError("invalid type for len()", vm.Value{}), false
 		}
@@ -139,4 +197,32 @@ func registerBuiltinFuncs(builder *vm.RegistryBuilder) {
 			return vm.NewError("invalid type for int()", vm.Value{}), false
 		}
 	})
+
+	builder.RegisterFunc("freeze", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+		val, ok := args.Get(0)
+		if !ok {
+			return val, false
+		}
+
+		val.Freeze()
+		return val, true
+	})
+
+	builder.RegisterFunc("isFrozen", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+		val, ok := args.Get(0)
+		if !ok {
+			return val, false
+		}
+
+		return vm.NewBool(val.IsFrozen()), true
+	})
+
+	builder.RegisterFunc("deepCopy", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+		val, ok := args.Get(0)
+		if !ok {
+			return val, false
+		}
+
+		return val.DeepCopy(), true
+	})
 }
@@ -40,7 +40,12 @@ func registerBuiltinFuncsArr(builder *vm.RegistryBuilder) {
 		}
 
 		arr := arrArg.GetArray()
-		*arr = append(*arr, val)
+		if errVal, ok := v.Mutate(arrArg, func() {
+			*arr = append(*arr, val)
+		}); !ok {
+			return errVal, false
+		}
+
 		return arrArg, true
 	})
 
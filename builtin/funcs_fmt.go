@@ -0,0 +1,531 @@
+package builtin
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+func registerBuiltinFuncsFmt(builder *vm.RegistryBuilder) {
+	builder.RegisterFunc("inspect", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+		val, ok := args.Get(0)
+		if !ok {
+			return val, false
+		}
+
+		opts := defaultInspectOptions()
+		if args.Len() > 1 {
+			optsArg, ok := args.Get(1, vm.ValueTypeObject)
+			if !ok {
+				return optsArg, false
+			}
+
+			if errVal, ok := opts.parse(optsArg.GetObject()); !ok {
+				return errVal, false
+			}
+		}
+
+		return vm.NewString(inspect(val, opts)), true
+	})
+}
+
+type inspectOptions struct {
+	// depth limits how deep arrays, objects and errors are printed, -1 means no limit.
+	depth int
+	// indent is the number of spaces per level, 0 prints everything on one line.
+	indent   int
+	sortKeys bool
+}
+
+func defaultInspectOptions() inspectOptions {
+	return inspectOptions{depth: -1, indent: 2, sortKeys: true}
+}
+
+func (o *inspectOptions) parse(m map[string]vm.Value) (vm.Value, bool) {
+	for key, val := range m {
+		switch key {
+		case "depth", "indent":
+			if errVal, ok := vm.CheckValueType("inspect", val, vm.ValueTypeNumber); !ok {
+				return errVal, false
+			}
+
+			n := int(val.GetNumber())
+			if n < 0 {
+				return vm.NewError(fmt.Sprintf("inspect: %s must not be negative", key), val), false
+			}
+
+			if key == "depth" {
+				o.depth = n
+			} else {
+				o.indent = n
+			}
+		case "sortKeys":
+			o.sortKeys = val.IsTruthy()
+		default:
+			return vm.NewError(fmt.Sprintf("inspect: unknown option %s", key), vm.Value{}), false
+		}
+	}
+
+	return vm.Value{}, true
+}
+
+// inspect returns a readable representation of val, unlike Value.String
+// strings are quoted, nested values are indented and cycles are detected.
+func inspect(val vm.Value, opts inspectOptions) string {
+	p := inspector{opts: opts, visiting: map[any]bool{}}
+	p.write(val, 0)
+	return p.sb.String()
+}
+
+type inspector struct {
+	opts     inspectOptions
+	sb       strings.Builder
+	visiting map[any]bool
+}
+
+func (p *inspector) newline(level int) {
+	if p.opts.indent == 0 {
+		return
+	}
+
+	p.sb.WriteByte('\n')
+	p.sb.WriteString(strings.Repeat(" ", level*p.opts.indent))
+}
+
+func (p *inspector) separator(level int) {
+	if p.opts.indent == 0 {
+		p.sb.WriteString(", ")
+		return
+	}
+
+	p.sb.WriteByte(',')
+	p.newline(level)
+}
+
+// enter marks a container as being printed, it reports false for cycles.
+func (p *inspector) enter(ptr any) bool {
+	if p.visiting[ptr] {
+		return false
+	}
+
+	p.visiting[ptr] = true
+	return true
+}
+
+func (p *inspector) write(val vm.Value, level int) {
+	tooDeep := p.opts.depth >= 0 && level >= p.opts.depth
+
+	switch val.VType {
+	case vm.ValueTypeString:
+		p.sb.WriteString(strconv.Quote(val.GetString()))
+
+	case vm.ValueTypeArray:
+		arr := val.GetArray()
+		if len(*arr) == 0 {
+			p.sb.WriteString("[]")
+			return
+		}
+		if tooDeep {
+			p.sb.WriteString("[...]")
+			return
+		}
+		if !p.enter(arr) {
+			p.sb.WriteString("<cycle array>")
+			return
+		}
+		defer delete(p.visiting, arr)
+
+		p.sb.WriteByte('[')
+		p.newline(level + 1)
+		for i, item := range *arr {
+			if i > 0 {
+				p.separator(level + 1)
+			}
+			p.write(item, level+1)
+		}
+		p.newline(level)
+		p.sb.WriteByte(']')
+
+	case vm.ValueTypeObject:
+		m := val.GetObject()
+		if len(m) == 0 {
+			p.sb.WriteString("{}")
+			return
+		}
+		if tooDeep {
+			p.sb.WriteString("{...}")
+			return
+		}
+		ptr := reflect.ValueOf(m).UnsafePointer()
+		if !p.enter(ptr) {
+			p.sb.WriteString("<cycle object>")
+			return
+		}
+		defer delete(p.visiting, ptr)
+
+		keys := slices.Collect(maps.Keys(m))
+		if p.opts.sortKeys {
+			slices.Sort(keys)
+		}
+
+		p.sb.WriteByte('{')
+		p.newline(level + 1)
+		for i, k := range keys {
+			if i > 0 {
+				p.separator(level + 1)
+			}
+			p.sb.WriteString(k)
+			p.sb.WriteString(": ")
+			p.write(m[k], level+1)
+		}
+		p.newline(level)
+		p.sb.WriteByte('}')
+
+	case vm.ValueTypeError:
+		err := val.GetError()
+		p.sb.WriteString("error(")
+		p.sb.WriteString(strconv.Quote(err.Msg()))
+		if data := err.Data(); data.VType != vm.ValueTypeNil {
+			p.sb.WriteString(", ")
+			if tooDeep {
+				p.sb.WriteString("...")
+			} else {
+				p.write(data, level)
+			}
+		}
+		p.sb.WriteByte(')')
+		if cause := err.Cause(); cause.IsError() {
+			p.sb.WriteString(": ")
+			p.write(cause, level)
+		}
+
+	case vm.ValueTypeFunction:
+		p.sb.WriteString("<function>")
+
+	case vm.ValueTypeNativeFunction:
+		fmt.Fprintf(&p.sb, "<native function %s>", val.GetNativeFunction().Name)
+
+	case vm.ValueTypeTask:
+		p.sb.WriteString("<task>")
+
+	case vm.ValueTypeLock:
+		p.sb.WriteString("<lock>")
+
+	case vm.ValueTypeChannel:
+		ch := val.GetChannel()
+		fmt.Fprintf(&p.sb, "<channel %d/%d>", len(ch), cap(ch))
+
+	case vm.ValueTypeIterator:
+		p.sb.WriteString("<iterator>")
+
+	case vm.ValueTypeTime:
+		fmt.Fprintf(&p.sb, "<time %s>", val.String())
+
+	case vm.ValueTypeNativeObject:
+		obj := val.GetNativeObject()
+		fmt.Fprintf(&p.sb, "<native object %T", obj.Obj)
+		if len(obj.Methods) > 0 {
+			p.sb.WriteString(" {")
+			p.sb.WriteString(strings.Join(slices.Sorted(maps.Keys(obj.Methods)), ", "))
+			p.sb.WriteByte('}')
+		}
+		p.sb.WriteByte('>')
+
+	default:
+		p.sb.WriteString(val.String())
+	}
+}
+
+// formatString implements strings.fmt, placeholders are {} for the next
+// argument, {0} for a positional one or {name} for a field of the last
+// argument, optionally followed by a spec like {:>10}, {:.2f} or {name:?}.
+// Placeholders that aren't valid or have no matching argument or field are
+// kept literally, so text like "{x y}" or "{a: 1}" passes through.
+func formatString(format string, args []vm.Value) (vm.Value, bool) {
+	var result strings.Builder
+	argIndex := 0
+
+	for i := 0; i < len(format); i++ {
+		char := format[i]
+
+		switch char {
+		case '\\':
+			// \{, \} and \\ are escapes, any other backslash is literal
+			if i+1 < len(format) && (format[i+1] == '{' || format[i+1] == '}' || format[i+1] == '\\') {
+				result.WriteByte(format[i+1])
+				i++
+			} else {
+				result.WriteByte(char)
+			}
+
+		case '{':
+			end := strings.IndexByte(format[i:], '}')
+			if end == -1 {
+				result.WriteString(format[i:])
+				return vm.NewString(result.String()), true
+			}
+
+			placeholder := format[i+1 : i+end]
+			arg, ok := placeholderArg(placeholder, args, &argIndex)
+			if !ok {
+				result.WriteString(format[i : i+end+1])
+				i += end
+				continue
+			}
+			_, spec, _ := strings.Cut(placeholder, ":")
+
+			if arg.IsError() && !strings.HasSuffix(spec, "?") {
+				return arg, false
+			}
+
+			s, err := formatValue(arg, spec)
+			if err != nil {
+				return vm.NewError(fmt.Sprintf("fmt: {%s}: %s", placeholder, err), vm.Value{}), false
+			}
+
+			result.WriteString(s)
+			i += end
+
+		default:
+			result.WriteByte(char)
+		}
+	}
+
+	return vm.NewString(result.String()), true
+}
+
+// placeholderArg returns the argument a placeholder refers to, ok is false
+// when the placeholder isn't valid or there's nothing to fill it with.
+func placeholderArg(placeholder string, args []vm.Value, argIndex *int) (vm.Value, bool) {
+	field, spec, _ := strings.Cut(placeholder, ":")
+	if spec != "" {
+		if _, err := parseFormatSpec(spec); err != nil {
+			return vm.Value{}, false
+		}
+	}
+
+	switch {
+	case field == "":
+		if *argIndex >= len(args) {
+			return vm.Value{}, false
+		}
+		*argIndex++
+		return args[*argIndex-1], true
+
+	case field[0] >= '0' && field[0] <= '9':
+		idx, err := strconv.Atoi(field)
+		if err != nil || idx >= len(args) {
+			return vm.Value{}, false
+		}
+		return args[idx], true
+
+	default:
+		if !validFieldPath(field) || len(args) == 0 || args[len(args)-1].VType != vm.ValueTypeObject {
+			return vm.Value{}, false
+		}
+		return objectPath(args[len(args)-1], field)
+	}
+}
+
+// validFieldPath reports whether field is a dotted path like user.name or
+// items.0.
+func validFieldPath(field string) bool {
+	for _, part := range strings.Split(field, ".") {
+		if part == "" {
+			return false
+		}
+		for _, c := range part {
+			if c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// formatSpec is [[fill]align][sign][0][width][.precision][verb].
+type formatSpec struct {
+	fill      rune
+	align     byte
+	sign      byte
+	zero      bool
+	width     int
+	precision int
+	verb      byte
+}
+
+func parseFormatSpec(spec string) (formatSpec, error) {
+	f := formatSpec{fill: ' ', precision: -1}
+	rest := spec
+
+	isAlign := func(c byte) bool { return c == '<' || c == '>' || c == '^' }
+	if r, size := utf8.DecodeRuneInString(rest); size > 0 && len(rest) > size && isAlign(rest[size]) {
+		f.fill, f.align = r, rest[size]
+		rest = rest[size+1:]
+	} else if len(rest) > 0 && isAlign(rest[0]) {
+		f.align = rest[0]
+		rest = rest[1:]
+	}
+
+	if len(rest) > 0 && (rest[0] == '+' || rest[0] == ' ') {
+		f.sign = rest[0]
+		rest = rest[1:]
+	}
+
+	if len(rest) > 0 && rest[0] == '0' {
+		f.zero = true
+		rest = rest[1:]
+	}
+
+	n := 0
+	for n < len(rest) && rest[n] >= '0' && rest[n] <= '9' {
+		n++
+	}
+	if n > 0 {
+		f.width, _ = strconv.Atoi(rest[:n])
+		rest = rest[n:]
+	}
+
+	if len(rest) > 0 && rest[0] == '.' {
+		n = 1
+		for n < len(rest) && rest[n] >= '0' && rest[n] <= '9' {
+			n++
+		}
+		if n == 1 {
+			return f, fmt.Errorf("missing precision")
+		}
+		f.precision, _ = strconv.Atoi(rest[1:n])
+		rest = rest[n:]
+	}
+
+	switch rest {
+	case "":
+	case "s", "d", "f", "e", "g", "x", "X", "o", "b", "%", "?":
+		f.verb = rest[0]
+	default:
+		return f, fmt.Errorf("invalid format spec %q", spec)
+	}
+
+	return f, nil
+}
+
+func formatValue(val vm.Value, spec string) (string, error) {
+	if spec == "" {
+		return val.String(), nil
+	}
+
+	f, err := parseFormatSpec(spec)
+	if err != nil {
+		return "", err
+	}
+
+	var s string
+	numeric := false
+
+	switch f.verb {
+	case '?':
+		s = inspect(val, inspectOptions{depth: -1, sortKeys: true})
+
+	case 'd', 'x', 'X', 'o', 'b':
+		if val.VType != vm.ValueTypeNumber {
+			return "", fmt.Errorf("%c needs a number, got %s", f.verb, val.VType)
+		}
+
+		n := val.GetNumber()
+		if n != math.Trunc(n) || math.IsInf(n, 0) {
+			return "", fmt.Errorf("%c needs an integer, got %v", f.verb, n)
+		}
+
+		base := map[byte]int{'d': 10, 'x': 16, 'X': 16, 'o': 8, 'b': 2}[f.verb]
+		s = strconv.FormatInt(int64(n), base)
+		if f.verb == 'X' {
+			s = strings.ToUpper(s)
+		}
+		numeric = true
+
+	case 'f', 'e', 'g', '%':
+		if val.VType != vm.ValueTypeNumber {
+			return "", fmt.Errorf("%c needs a number, got %s", f.verb, val.VType)
+		}
+
+		n := val.GetNumber()
+		verb := f.verb
+		if verb == '%' {
+			n, verb = n*100, 'f'
+		}
+
+		precision := f.precision
+		if precision < 0 && verb != 'g' {
+			precision = 6
+		}
+
+		s = strconv.FormatFloat(n, verb, precision, 64)
+		if f.verb == '%' {
+			s += "%"
+		}
+		numeric = true
+
+	default:
+		if val.VType == vm.ValueTypeNumber && f.verb == 0 {
+			if f.precision >= 0 {
+				s = strconv.FormatFloat(val.GetNumber(), 'f', f.precision, 64)
+			} else {
+				s = val.String()
+			}
+			numeric = true
+			break
+		}
+
+		s = val.String()
+		if f.precision >= 0 {
+			runes := []rune(s)
+			if len(runes) > f.precision {
+				s = string(runes[:f.precision])
+			}
+		}
+	}
+
+	if numeric && f.sign != 0 && !strings.HasPrefix(s, "-") {
+		s = string(f.sign) + s
+	}
+
+	pad := f.width - utf8.RuneCountInString(s)
+	if pad <= 0 {
+		return s, nil
+	}
+
+	if numeric && f.zero && f.align == 0 {
+		signLen := 0
+		if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") || strings.HasPrefix(s, " ") {
+			signLen = 1
+		}
+		return s[:signLen] + strings.Repeat("0", pad) + s[signLen:], nil
+	}
+
+	align := f.align
+	if align == 0 {
+		align = '<'
+		if numeric {
+			align = '>'
+		}
+	}
+
+	fill := string(f.fill)
+	switch align {
+	case '>':
+		return strings.Repeat(fill, pad) + s, nil
+	case '^':
+		return strings.Repeat(fill, pad/2) + s + strings.Repeat(fill, pad-pad/2), nil
+	default:
+		return s + strings.Repeat(fill, pad), nil
+	}
+}
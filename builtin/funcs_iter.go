@@ -0,0 +1,157 @@
+package builtin
+
+import (
+	"iter"
+	"maps"
+	"slices"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+func registerBuiltinFuncsIter(builder *vm.RegistryBuilder) {
+	// __iterPull is what for (x in expr) loops compile to, the iter module
+	// is imported under the name iter so this one is internal.
+	builder.RegisterFunc("__iterPull", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+		val, ok := args.Get(0)
+		if !ok {
+			return val, false
+		}
+
+		fn, ok := iterSource(val)
+		if !ok {
+			return vm.NewError("value is not iterable", val), false
+		}
+
+		return newPuller(fn(v)), true
+	})
+}
+
+// iterSource returns the values a for (x in val) loop visits, channels are
+// received from until they are closed or the consuming VM is stopped.
+func iterSource(val vm.Value) (vm.IterFunc, bool) {
+	switch val.VType {
+	case vm.ValueTypeIterator:
+		return val.GetIter, true
+
+	case vm.ValueTypeChannel:
+		ch := val.GetChannel()
+		return func(v *vm.VM) iter.Seq[vm.Value] {
+			return func(yield func(vm.Value) bool) {
+				for {
+					select {
+					case val, ok := <-ch:
+						if !ok || !yield(val) {
+							return
+						}
+					case <-v.Ctx.Done():
+						return
+					}
+				}
+			}
+		}, true
+	}
+
+	seq, ok := valueSeq(val)
+	if !ok {
+		return nil, false
+	}
+
+	return func(*vm.VM) iter.Seq[vm.Value] { return seq }, true
+}
+
+// valueSeq returns the values of the iterables that don't depend on the VM
+// consuming them.
+func valueSeq(val vm.Value) (iter.Seq[vm.Value], bool) {
+	switch val.VType {
+	case vm.ValueTypeArray:
+		arr := val.GetArray()
+		return func(yield func(vm.Value) bool) {
+			for i := 0; i < len(*arr); i++ {
+				if !yield((*arr)[i]) {
+					return
+				}
+			}
+		}, true
+
+	case vm.ValueTypeObject:
+		keys := slices.Sorted(maps.Keys(val.GetObject()))
+		return func(yield func(vm.Value) bool) {
+			for _, k := range keys {
+				if !yield(vm.NewString(k)) {
+					return
+				}
+			}
+		}, true
+
+	case vm.ValueTypeString:
+		s := val.GetString()
+		return func(yield func(vm.Value) bool) {
+			for _, r := range s {
+				if !yield(vm.NewString(string(r))) {
+					return
+				}
+			}
+		}, true
+
+	case vm.ValueTypeBytes:
+		b := val.GetBytes()
+		return func(yield func(vm.Value) bool) {
+			for _, c := range b {
+				if !yield(vm.NewNumber(float64(c))) {
+					return
+				}
+			}
+		}, true
+
+	default:
+		return nil, false
+	}
+}
+
+func newPuller(seq iter.Seq[vm.Value]) vm.Value {
+	next, stop := iter.Pull(seq)
+	var current vm.Value
+
+	return vm.NewNativeObject(nil, map[string]vm.Value{
+		"next": vm.NewNativeFunction("next", func(v *vm.VM, args vm.NativeFunctionArgs) (res vm.Value, ok bool) {
+			defer catchIterError(&res, &ok)
+
+			val, ok := next()
+			current = val
+			return vm.NewBool(ok), true
+		}),
+		"value": vm.NewNativeFunction("value", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			return current, true
+		}),
+		"stop": vm.NewNativeFunction("stop", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			stop()
+			return vm.Value{}, true
+		}),
+	})
+}
+
+// iterError carries an error raised by a callback inside a lazy iterator,
+// iter.Seq can't return errors so it unwinds to the consumer as a panic.
+type iterError struct {
+	val vm.Value
+}
+
+func raiseIterError(val vm.Value) {
+	panic(iterError{val: val})
+}
+
+// catchIterError is deferred by native functions that consume iterators,
+// it turns an iterError back into a failed result.
+func catchIterError(res *vm.Value, ok *bool) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	e, isIterError := r.(iterError)
+	if !isIterError {
+		panic(r)
+	}
+
+	*res, *ok = e.val, false
+}
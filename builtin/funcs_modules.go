@@ -3,7 +3,6 @@ package builtin
 import (
 	"os"
 	"path/filepath"
-	"sync"
 
 	"github.com/joetifa2003/weaver/compiler"
 	"github.com/joetifa2003/weaver/ir"
@@ -12,13 +11,7 @@ import (
 )
 
 func registerBuiltinFuncsModules(builder *vm.RegistryBuilder) {
-	moduleCache := map[string]vm.Value{}
-	lock := sync.Mutex{}
-
 	builder.RegisterFunc("import", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
-		lock.Lock()
-		defer lock.Unlock()
-
 		pathArg, ok := args.Get(0, vm.ValueTypeString)
 		if !ok {
 			return pathArg, false
@@ -26,59 +19,66 @@ func registerBuiltinFuncsModules(builder *vm.RegistryBuilder) {
 
 		pathStr := pathArg.GetString()
 
-		if mod, ok := moduleCache[pathStr]; ok {
-			return mod, true
-		}
-
-		modInit, ok := v.Executor.Reg.ResolveModule(pathStr)
-		if ok {
-			mod := modInit()
-			moduleCache[pathStr] = mod
-			return mod, true
-		}
+		return v.Executor.Module(v, pathStr, func() (vm.Value, bool) {
+			modInit, ok := v.Executor.Reg.ResolveModule(pathStr)
+			if ok {
+				return modInit(), true
+			}
 
-		userMod, ok := initModule(v, pathStr)
-		if !ok {
-			return userMod, false
-		}
-
-		moduleCache[pathStr] = userMod
-		return userMod, true
+			return initModule(v, pathStr)
+		})
 	})
 }
 
 func initModule(v *vm.VM, path string) (vm.Value, bool) {
-	absPath := filepath.Join(filepath.Dir(v.CurrentFrame().Path), path)
+	fn, err := compileModule(modulePath(v, path))
+	if err != nil {
+		return vm.NewErrFromErr(err), false
+	}
 
+	return v.RunFunction(fn)
+}
+
+// modulePath resolves path relative to the file that's currently running.
+func modulePath(v *vm.VM, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(filepath.Dir(v.CurrentFrame().Path), path)
+}
+
+// compileModule compiles the file at absPath to a function that runs the module.
+func compileModule(absPath string) (vm.Value, error) {
 	srcData, err := os.ReadFile(absPath)
 	if err != nil {
-		return vm.NewErrFromErr(err), false
+		return vm.Value{}, err
 	}
 	src := string(srcData)
 
 	p, err := parser.Parse(src)
 	if err != nil {
-		return vm.NewErrFromErr(err), false
+		return vm.Value{}, err
 	}
 
 	irc := ir.NewCompiler()
 	ircr, err := irc.Compile(absPath, p)
 	if err != nil {
-		return vm.NewErrFromErr(err), false
+		return vm.Value{}, err
 	}
 
 	c := compiler.New(StdReg)
 	instructions, vars, constants, err := c.Compile(ircr)
 	if err != nil {
-		return vm.NewErrFromErr(err), false
+		return vm.Value{}, err
 	}
 
-	return v.RunFunction(vm.NewFunction(
+	return vm.NewFunction(
 		vm.FunctionValue{
 			NumVars:      vars,
 			Instructions: instructions,
 			Constants:    constants,
 			Path:         absPath,
 		},
-	))
+	), nil
 }
@@ -0,0 +1,739 @@
+package builtin
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+// compareValues orders numbers, strings, bytes and times, it is used by sort, min,
+// max and binarySearch when no comparator is given.
+func compareValues(a, b vm.Value) (int, error) {
+	if a.VType != b.VType {
+		return 0, fmt.Errorf("cannot compare %s with %s", a.VType, b.VType)
+	}
+
+	switch a.VType {
+	case vm.ValueTypeNumber:
+		return cmp.Compare(a.GetNumber(), b.GetNumber()), nil
+	case vm.ValueTypeString:
+		return strings.Compare(a.GetString(), b.GetString()), nil
+	case vm.ValueTypeBytes:
+		return bytes.Compare(a.GetBytes(), b.GetBytes()), nil
+	case vm.ValueTypeTime:
+		return a.GetTime().Compare(b.GetTime()), nil
+	default:
+		return 0, fmt.Errorf("cannot compare %s values", a.VType)
+	}
+}
+
+func valuesEqual(a, b vm.Value) bool {
+	res := vm.Value{}
+	a.Equal(&b, &res)
+	return res.IsTruthy()
+}
+
+// arrayComparator builds a compare function from an optional comparator,
+// the comparator must return a number whose sign orders a and b.
+func arrayComparator(v *vm.VM, fn vm.Value, errVal *vm.Value) func(a, b vm.Value) int {
+	return func(a, b vm.Value) int {
+		if errVal.VType != vm.ValueTypeNil {
+			return 0
+		}
+
+		if fn.VType == vm.ValueTypeNil {
+			c, err := compareValues(a, b)
+			if err != nil {
+				*errVal = vm.NewErrFromErr(err)
+			}
+			return c
+		}
+
+		r, ok := v.RunFunction(fn, a, b)
+		if !ok {
+			*errVal = r
+			return 0
+		}
+
+		if r.VType != vm.ValueTypeNumber {
+			*errVal = vm.NewError(fmt.Sprintf("comparator must return a number, got %s", r.VType), r)
+			return 0
+		}
+
+		return cmp.Compare(r.GetNumber(), 0)
+	}
+}
+
+// arrayIndex resolves a possibly negative index against an array of length n.
+func arrayIndex(idx vm.Value, n int, allowEnd bool) (int, vm.Value, bool) {
+	i := int(idx.GetNumber())
+	if i < 0 {
+		i += n
+	}
+
+	limit := n
+	if allowEnd {
+		limit++
+	}
+
+	if i < 0 || i >= limit {
+		return 0, vm.NewError(fmt.Sprintf("index %d out of range [0:%d]", int(idx.GetNumber()), n), idx), false
+	}
+
+	return i, vm.Value{}, true
+}
+
+func flattenInto(dst []vm.Value, src []vm.Value, depth int) []vm.Value {
+	for _, val := range src {
+		if val.VType == vm.ValueTypeArray && depth > 0 {
+			dst = flattenInto(dst, *val.GetArray(), depth-1)
+			continue
+		}
+
+		dst = append(dst, val)
+	}
+
+	return dst
+}
+
+func registerArraysModule(builder *vm.RegistryBuilder) {
+	builder.RegisterModule("arrays", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				"sort": vm.NewNativeFunction("sort", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					var cmpFn, keyFn vm.Value
+					desc := false
+					if args.Len() > 1 {
+						opt, ok := args.Get(1, vm.ValueTypeFunction, vm.ValueTypeObject)
+						if !ok {
+							return opt, false
+						}
+
+						if opt.VType == vm.ValueTypeFunction {
+							cmpFn = opt
+						} else {
+							m := opt.GetObject()
+							if key, ok := m["key"]; ok {
+								if errVal, ok := vm.CheckValueType("sort", key, vm.ValueTypeFunction); !ok {
+									return errVal, false
+								}
+								keyFn = key
+							}
+							if c, ok := m["compare"]; ok {
+								if errVal, ok := vm.CheckValueType("sort", c, vm.ValueTypeFunction); !ok {
+									return errVal, false
+								}
+								cmpFn = c
+							}
+							d := m["desc"]
+							desc = d.IsTruthy()
+						}
+					}
+
+					type entry struct {
+						key vm.Value
+						val vm.Value
+					}
+
+					arr := *arrArg.GetArray()
+					entries := make([]entry, len(arr))
+					for i, val := range arr {
+						entries[i] = entry{key: val, val: val}
+						if keyFn.VType != vm.ValueTypeNil {
+							k, ok := v.RunFunction(keyFn, val)
+							if !ok {
+								return k, false
+							}
+							entries[i].key = k
+						}
+					}
+
+					var errVal vm.Value
+					compare := arrayComparator(v, cmpFn, &errVal)
+					slices.SortStableFunc(entries, func(a, b entry) int {
+						if desc {
+							return compare(b.key, a.key)
+						}
+						return compare(a.key, b.key)
+					})
+					if errVal.VType != vm.ValueTypeNil {
+						return errVal, false
+					}
+
+					result := make([]vm.Value, len(entries))
+					for i, e := range entries {
+						result[i] = e.val
+					}
+
+					return vm.NewArray(result), true
+				}),
+
+				"reduce": vm.NewNativeFunction("reduce", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					fnArg, ok := args.Get(1, vm.ValueTypeFunction)
+					if !ok {
+						return fnArg, false
+					}
+
+					arr := *arrArg.GetArray()
+					var acc vm.Value
+					if args.Len() > 2 {
+						acc, _ = args.Get(2)
+					} else {
+						if len(arr) == 0 {
+							return vm.NewError("reduce of empty array with no initial value", vm.Value{}), false
+						}
+						acc, arr = arr[0], arr[1:]
+					}
+
+					for _, val := range arr {
+						acc, ok = v.RunFunction(fnArg, acc, val)
+						if !ok {
+							return acc, false
+						}
+					}
+
+					return acc, true
+				}),
+
+				"slice": vm.NewNativeFunction("slice", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					startArg, ok := args.Get(1, vm.ValueTypeNumber)
+					if !ok {
+						return startArg, false
+					}
+
+					arr := *arrArg.GetArray()
+					start, errVal, ok := arrayIndex(startArg, len(arr), true)
+					if !ok {
+						return errVal, false
+					}
+
+					end := len(arr)
+					if args.Len() > 2 {
+						endArg, ok := args.Get(2, vm.ValueTypeNumber)
+						if !ok {
+							return endArg, false
+						}
+
+						end, errVal, ok = arrayIndex(endArg, len(arr), true)
+						if !ok {
+							return errVal, false
+						}
+					}
+
+					if end < start {
+						return vm.NewError(fmt.Sprintf("invalid slice indices %d > %d", start, end), vm.Value{}), false
+					}
+
+					return vm.NewArray(slices.Clone(arr[start:end])), true
+				}),
+
+				"reverse": vm.NewNativeFunction("reverse", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					result := slices.Clone(*arrArg.GetArray())
+					slices.Reverse(result)
+
+					return vm.NewArray(result), true
+				}),
+
+				"concat": vm.NewNativeFunction("concat", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					result := []vm.Value{}
+					for i := range args.Len() {
+						arrArg, ok := args.Get(i, vm.ValueTypeArray)
+						if !ok {
+							return arrArg, false
+						}
+
+						result = append(result, *arrArg.GetArray()...)
+					}
+
+					return vm.NewArray(result), true
+				}),
+
+				"flatMap": vm.NewNativeFunction("flatMap", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					fnArg, ok := args.Get(1, vm.ValueTypeFunction)
+					if !ok {
+						return fnArg, false
+					}
+
+					result := []vm.Value{}
+					for _, val := range *arrArg.GetArray() {
+						r, ok := v.RunFunction(fnArg, val)
+						if !ok {
+							return r, false
+						}
+
+						if r.VType == vm.ValueTypeArray {
+							result = append(result, *r.GetArray()...)
+						} else {
+							result = append(result, r)
+						}
+					}
+
+					return vm.NewArray(result), true
+				}),
+
+				"flatten": vm.NewNativeFunction("flatten", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					depth := 1
+					if args.Len() > 1 {
+						depthArg, ok := args.Get(1, vm.ValueTypeNumber)
+						if !ok {
+							return depthArg, false
+						}
+
+						depth = int(depthArg.GetNumber())
+						if depth < 0 {
+							return vm.NewError("flatten depth must not be negative", depthArg), false
+						}
+					}
+
+					return vm.NewArray(flattenInto([]vm.Value{}, *arrArg.GetArray(), depth)), true
+				}),
+
+				"zip": vm.NewNativeFunction("zip", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					if args.Len() == 0 {
+						return vm.NewArray([]vm.Value{}), true
+					}
+
+					arrs := make([][]vm.Value, args.Len())
+					n := -1
+					for i := range args.Len() {
+						arrArg, ok := args.Get(i, vm.ValueTypeArray)
+						if !ok {
+							return arrArg, false
+						}
+
+						arrs[i] = *arrArg.GetArray()
+						if n == -1 || len(arrs[i]) < n {
+							n = len(arrs[i])
+						}
+					}
+
+					result := make([]vm.Value, n)
+					for i := range n {
+						tuple := make([]vm.Value, len(arrs))
+						for j, arr := range arrs {
+							tuple[j] = arr[i]
+						}
+						result[i] = vm.NewArray(tuple)
+					}
+
+					return vm.NewArray(result), true
+				}),
+
+				"groupBy": vm.NewNativeFunction("groupBy", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					fnArg, ok := args.Get(1, vm.ValueTypeFunction)
+					if !ok {
+						return fnArg, false
+					}
+
+					groups := map[string]vm.Value{}
+					for _, val := range *arrArg.GetArray() {
+						key, ok := v.RunFunction(fnArg, val)
+						if !ok {
+							return key, false
+						}
+
+						if errVal, ok := vm.CheckValueType("groupBy", key, vm.ValueTypeString, vm.ValueTypeNumber, vm.ValueTypeBool); !ok {
+							return errVal, false
+						}
+
+						k := key.String()
+						group, ok := groups[k]
+						if !ok {
+							group = vm.NewArray([]vm.Value{})
+						}
+						*group.GetArray() = append(*group.GetArray(), val)
+						groups[k] = group
+					}
+
+					return vm.NewObject(groups), true
+				}),
+
+				"chunk": vm.NewNativeFunction("chunk", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					sizeArg, ok := args.Get(1, vm.ValueTypeNumber)
+					if !ok {
+						return sizeArg, false
+					}
+
+					size := int(sizeArg.GetNumber())
+					if size <= 0 {
+						return vm.NewError("chunk size must be positive", sizeArg), false
+					}
+
+					result := []vm.Value{}
+					for c := range slices.Chunk(*arrArg.GetArray(), size) {
+						result = append(result, vm.NewArray(slices.Clone(c)))
+					}
+
+					return vm.NewArray(result), true
+				}),
+
+				"unique": vm.NewNativeFunction("unique", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					var keyFn vm.Value
+					if args.Len() > 1 {
+						keyFn, ok = args.Get(1, vm.ValueTypeFunction)
+						if !ok {
+							return keyFn, false
+						}
+					}
+
+					result := []vm.Value{}
+					seen := []vm.Value{}
+					for _, val := range *arrArg.GetArray() {
+						key := val
+						if keyFn.VType != vm.ValueTypeNil {
+							key, ok = v.RunFunction(keyFn, val)
+							if !ok {
+								return key, false
+							}
+						}
+
+						if slices.ContainsFunc(seen, func(s vm.Value) bool { return valuesEqual(s, key) }) {
+							continue
+						}
+
+						seen = append(seen, key)
+						result = append(result, val)
+					}
+
+					return vm.NewArray(result), true
+				}),
+
+				"indexOf": vm.NewNativeFunction("indexOf", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					f, ok := args.Get(1)
+					if !ok {
+						return f, false
+					}
+
+					for i, val := range *arrArg.GetArray() {
+						if f.VType == vm.ValueTypeFunction {
+							r, ok := v.RunFunction(f, val)
+							if !ok {
+								return r, false
+							}
+
+							if r.IsTruthy() {
+								return vm.NewNumber(float64(i)), true
+							}
+						} else if valuesEqual(val, f) {
+							return vm.NewNumber(float64(i)), true
+						}
+					}
+
+					return vm.NewNumber(-1), true
+				}),
+
+				"insert": vm.NewNativeFunction("insert", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					idxArg, ok := args.Get(1, vm.ValueTypeNumber)
+					if !ok {
+						return idxArg, false
+					}
+
+					val, ok := args.Get(2)
+					if !ok {
+						return val, false
+					}
+
+					arr := arrArg.GetArray()
+					idx, errVal, ok := arrayIndex(idxArg, len(*arr), true)
+					if !ok {
+						return errVal, false
+					}
+
+					if errVal, ok := v.Mutate(arrArg, func() {
+						*arr = slices.Insert(*arr, idx, val)
+					}); !ok {
+						return errVal, false
+					}
+
+					return arrArg, true
+				}),
+
+				"removeAt": vm.NewNativeFunction("removeAt", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					idxArg, ok := args.Get(1, vm.ValueTypeNumber)
+					if !ok {
+						return idxArg, false
+					}
+
+					arr := arrArg.GetArray()
+					idx, errVal, ok := arrayIndex(idxArg, len(*arr), false)
+					if !ok {
+						return errVal, false
+					}
+
+					removed := (*arr)[idx]
+					if errVal, ok := v.Mutate(arrArg, func() {
+						*arr = slices.Delete(*arr, idx, idx+1)
+					}); !ok {
+						return errVal, false
+					}
+
+					return removed, true
+				}),
+
+				"pop": vm.NewNativeFunction("pop", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					arr := arrArg.GetArray()
+					if len(*arr) == 0 {
+						return vm.Value{}, true
+					}
+
+					last := (*arr)[len(*arr)-1]
+					if errVal, ok := v.Mutate(arrArg, func() {
+						*arr = (*arr)[:len(*arr)-1]
+					}); !ok {
+						return errVal, false
+					}
+
+					return last, true
+				}),
+
+				"shift": vm.NewNativeFunction("shift", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					arr := arrArg.GetArray()
+					if len(*arr) == 0 {
+						return vm.Value{}, true
+					}
+
+					first := (*arr)[0]
+					if errVal, ok := v.Mutate(arrArg, func() {
+						*arr = slices.Delete(*arr, 0, 1)
+					}); !ok {
+						return errVal, false
+					}
+
+					return first, true
+				}),
+
+				"some": vm.NewNativeFunction("some", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					fnArg, ok := args.Get(1, vm.ValueTypeFunction)
+					if !ok {
+						return fnArg, false
+					}
+
+					for _, val := range *arrArg.GetArray() {
+						r, ok := v.RunFunction(fnArg, val)
+						if !ok {
+							return r, false
+						}
+
+						if r.IsTruthy() {
+							return vm.NewBool(true), true
+						}
+					}
+
+					return vm.NewBool(false), true
+				}),
+
+				"every": vm.NewNativeFunction("every", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					fnArg, ok := args.Get(1, vm.ValueTypeFunction)
+					if !ok {
+						return fnArg, false
+					}
+
+					for _, val := range *arrArg.GetArray() {
+						r, ok := v.RunFunction(fnArg, val)
+						if !ok {
+							return r, false
+						}
+
+						if !r.IsTruthy() {
+							return vm.NewBool(false), true
+						}
+					}
+
+					return vm.NewBool(true), true
+				}),
+
+				"sum": vm.NewNativeFunction("sum", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					sum := 0.0
+					for _, val := range *arrArg.GetArray() {
+						if errVal, ok := vm.CheckValueType("sum", val, vm.ValueTypeNumber); !ok {
+							return errVal, false
+						}
+
+						sum += val.GetNumber()
+					}
+
+					return vm.NewNumber(sum), true
+				}),
+
+				"min": vm.NewNativeFunction("min", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					return arrayExtreme(v, args, -1)
+				}),
+
+				"max": vm.NewNativeFunction("max", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					return arrayExtreme(v, args, 1)
+				}),
+
+				"binarySearch": vm.NewNativeFunction("binarySearch", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					target, ok := args.Get(1)
+					if !ok {
+						return target, false
+					}
+
+					var cmpFn vm.Value
+					if args.Len() > 2 {
+						cmpFn, ok = args.Get(2, vm.ValueTypeFunction)
+						if !ok {
+							return cmpFn, false
+						}
+					}
+
+					var errVal vm.Value
+					compare := arrayComparator(v, cmpFn, &errVal)
+					idx, found := slices.BinarySearchFunc(*arrArg.GetArray(), target, compare)
+					if errVal.VType != vm.ValueTypeNil {
+						return errVal, false
+					}
+
+					if !found {
+						return vm.NewNumber(-1), true
+					}
+
+					return vm.NewNumber(float64(idx)), true
+				}),
+			},
+		)
+	})
+}
+
+// arrayExtreme returns the smallest (dir -1) or largest (dir 1) element,
+// optionally comparing the results of a key function.
+func arrayExtreme(v *vm.VM, args vm.NativeFunctionArgs, dir int) (vm.Value, bool) {
+	arrArg, ok := args.Get(0, vm.ValueTypeArray)
+	if !ok {
+		return arrArg, false
+	}
+
+	var keyFn vm.Value
+	if args.Len() > 1 {
+		keyFn, ok = args.Get(1, vm.ValueTypeFunction)
+		if !ok {
+			return keyFn, false
+		}
+	}
+
+	arr := *arrArg.GetArray()
+	if len(arr) == 0 {
+		return vm.NewError(fmt.Sprintf("[%s]: empty array", args.Name), vm.Value{}), false
+	}
+
+	var best, bestKey vm.Value
+	for i, val := range arr {
+		key := val
+		if keyFn.VType != vm.ValueTypeNil {
+			key, ok = v.RunFunction(keyFn, val)
+			if !ok {
+				return key, false
+			}
+		}
+
+		if i == 0 {
+			best, bestKey = val, key
+			continue
+		}
+
+		c, err := compareValues(key, bestKey)
+		if err != nil {
+			return vm.NewErrFromErr(err), false
+		}
+
+		if c*dir > 0 {
+			best, bestKey = val, key
+		}
+	}
+
+	return best, true
+}
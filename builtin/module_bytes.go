@@ -0,0 +1,370 @@
+package builtin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+// bytesEncoding converts between bytes and strings, utf8 keeps the bytes
+// as they are.
+type bytesEncoding struct {
+	encode func([]byte) string
+	decode func(string) ([]byte, error)
+}
+
+var bytesEncodings = map[string]bytesEncoding{
+	"utf8": {
+		encode: func(b []byte) string { return string(b) },
+		decode: func(s string) ([]byte, error) { return []byte(s), nil },
+	},
+	"hex": {
+		encode: hex.EncodeToString,
+		decode: hex.DecodeString,
+	},
+	"base64": {
+		encode: base64.StdEncoding.EncodeToString,
+		decode: base64.StdEncoding.DecodeString,
+	},
+	"base64url": {
+		encode: base64.RawURLEncoding.EncodeToString,
+		decode: base64.RawURLEncoding.DecodeString,
+	},
+	"latin1": {
+		encode: func(b []byte) string {
+			runes := make([]rune, len(b))
+			for i, c := range b {
+				runes[i] = rune(c)
+			}
+			return string(runes)
+		},
+		decode: func(s string) ([]byte, error) {
+			b := make([]byte, 0, len(s))
+			for _, r := range s {
+				if r > 0xff {
+					return nil, fmt.Errorf("latin1: %q can't be encoded", r)
+				}
+				b = append(b, byte(r))
+			}
+			return b, nil
+		},
+	},
+}
+
+func bytesEncodingArg(args vm.NativeFunctionArgs, i int) (bytesEncoding, vm.Value, bool) {
+	if args.Len() <= i {
+		return bytesEncodings["utf8"], vm.Value{}, true
+	}
+
+	encArg, ok := args.Get(i, vm.ValueTypeString)
+	if !ok {
+		return bytesEncoding{}, encArg, false
+	}
+
+	enc, ok := bytesEncodings[encArg.GetString()]
+	if !ok {
+		return bytesEncoding{}, vm.NewError("unknown encoding, expected utf8, hex, base64, base64url or latin1", encArg), false
+	}
+
+	return enc, vm.Value{}, true
+}
+
+// bytesArg accepts bytes or a string, strings are used as utf8.
+func bytesArg(args vm.NativeFunctionArgs, i int) ([]byte, vm.Value, bool) {
+	val, ok := args.Get(i, vm.ValueTypeBytes, vm.ValueTypeString)
+	if !ok {
+		return nil, val, false
+	}
+
+	return bytesOf(val), vm.Value{}, true
+}
+
+func bytesOf(val vm.Value) []byte {
+	if val.VType == vm.ValueTypeBytes {
+		return val.GetBytes()
+	}
+
+	return []byte(val.GetString())
+}
+
+// appendBytes appends bytes, strings, a single byte or an array of bytes.
+func appendBytes(dst []byte, val vm.Value) ([]byte, error) {
+	switch val.VType {
+	case vm.ValueTypeBytes:
+		return append(dst, val.GetBytes()...), nil
+	case vm.ValueTypeString:
+		return append(dst, val.GetString()...), nil
+	case vm.ValueTypeNumber:
+		n := val.GetNumber()
+		if n < 0 || n > 255 || n != float64(int(n)) {
+			return nil, fmt.Errorf("%v is not a byte", n)
+		}
+		return append(dst, byte(n)), nil
+	case vm.ValueTypeArray:
+		for _, item := range *val.GetArray() {
+			if item.VType != vm.ValueTypeNumber {
+				return nil, errors.New("byte arrays must only contain numbers")
+			}
+
+			var err error
+			if dst, err = appendBytes(dst, item); err != nil {
+				return nil, err
+			}
+		}
+		return dst, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to bytes", val.VType)
+	}
+}
+
+// newBytesFrom is bytes(value, encoding?), strings are decoded with the
+// encoding, arrays hold byte values and a number makes zeroed bytes.
+func newBytesFrom(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	val, ok := args.Get(0, vm.ValueTypeString, vm.ValueTypeBytes, vm.ValueTypeArray, vm.ValueTypeNumber)
+	if !ok {
+		return val, false
+	}
+
+	switch val.VType {
+	case vm.ValueTypeString:
+		enc, errVal, ok := bytesEncodingArg(args, 1)
+		if !ok {
+			return errVal, false
+		}
+
+		b, err := enc.decode(val.GetString())
+		if err != nil {
+			return vm.NewError(err.Error(), val), false
+		}
+
+		return vm.NewBytes(b), true
+
+	case vm.ValueTypeNumber:
+		if val.GetNumber() < 0 {
+			return vm.NewError("bytes size must not be negative", val), false
+		}
+
+		return vm.NewBytes(make([]byte, int(val.GetNumber()))), true
+
+	case vm.ValueTypeBytes:
+		return val, true
+
+	default:
+		b, err := appendBytes(nil, val)
+		if err != nil {
+			return vm.NewError(err.Error(), val), false
+		}
+
+		return vm.NewBytes(b), true
+	}
+}
+
+type bytesBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+// newBytesBuffer returns a mutable buffer for building binary payloads.
+func newBytesBuffer() vm.Value {
+	b := &bytesBuffer{}
+
+	return vm.NewNativeObject(b, map[string]vm.Value{
+		// write appends bytes, strings, byte values or arrays of them
+		"write": vm.NewNativeFunction("write", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			for _, arg := range args.Args {
+				buf, err := appendBytes(b.buf, arg)
+				if err != nil {
+					return vm.NewError(err.Error(), arg), false
+				}
+				b.buf = buf
+			}
+
+			return vm.Value{}, true
+		}),
+
+		// pack(format, ...values) appends values packed like encoding.binary.pack
+		"pack": vm.NewNativeFunction("pack", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			formatArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return formatArg, false
+			}
+
+			data, err := binaryPack(formatArg.GetString(), args.Args[1:])
+			if err != nil {
+				return vm.NewError(err.Error(), formatArg), false
+			}
+
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			b.buf = append(b.buf, data...)
+			return vm.Value{}, true
+		}),
+
+		"len": vm.NewNativeFunction("len", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			return vm.NewNumber(float64(len(b.buf))), true
+		}),
+
+		// bytes returns a copy of the contents, later writes don't change it
+		"bytes": vm.NewNativeFunction("bytes", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			return vm.NewBytes(bytes.Clone(b.buf)), true
+		}),
+
+		"toString": vm.NewNativeFunction("toString", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			enc, errVal, ok := bytesEncodingArg(args, 0)
+			if !ok {
+				return errVal, false
+			}
+
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			return vm.NewString(enc.encode(b.buf)), true
+		}),
+
+		"reset": vm.NewNativeFunction("reset", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			b.buf = nil
+			return vm.Value{}, true
+		}),
+	})
+}
+
+func registerBytesModule(builder *vm.RegistryBuilder) {
+	builder.RegisterFunc("bytes", newBytesFrom)
+
+	builder.RegisterModule("bytes", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				"from": vm.NewNativeFunction("from", newBytesFrom),
+
+				// toString(b, encoding = "utf8")
+				"toString": vm.NewNativeFunction("toString", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					bArg, ok := args.Get(0, vm.ValueTypeBytes)
+					if !ok {
+						return bArg, false
+					}
+
+					enc, errVal, ok := bytesEncodingArg(args, 1)
+					if !ok {
+						return errVal, false
+					}
+
+					return vm.NewString(enc.encode(bArg.GetBytes())), true
+				}),
+
+				"isValidUtf8": vm.NewNativeFunction("isValidUtf8", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					bArg, ok := args.Get(0, vm.ValueTypeBytes)
+					if !ok {
+						return bArg, false
+					}
+
+					return vm.NewBool(utf8.Valid(bArg.GetBytes())), true
+				}),
+
+				// slice(b, start, end?) supports negative indexes like arrays.slice,
+				// the result shares memory with b which is fine since bytes are immutable.
+				"slice": vm.NewNativeFunction("slice", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					bArg, ok := args.Get(0, vm.ValueTypeBytes)
+					if !ok {
+						return bArg, false
+					}
+					b := bArg.GetBytes()
+
+					startArg, ok := args.Get(1, vm.ValueTypeNumber)
+					if !ok {
+						return startArg, false
+					}
+
+					start, errVal, ok := arrayIndex(startArg, len(b), true)
+					if !ok {
+						return errVal, false
+					}
+
+					end := len(b)
+					if args.Len() > 2 {
+						endArg, ok := args.Get(2, vm.ValueTypeNumber)
+						if !ok {
+							return endArg, false
+						}
+
+						end, errVal, ok = arrayIndex(endArg, len(b), true)
+						if !ok {
+							return errVal, false
+						}
+					}
+
+					if end < start {
+						return vm.NewError(fmt.Sprintf("invalid slice indices %d > %d", start, end), vm.Value{}), false
+					}
+
+					return vm.NewBytes(b[start:end:end]), true
+				}),
+
+				"concat": vm.NewNativeFunction("concat", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					result := []byte{}
+					for i := range args.Len() {
+						b, errVal, ok := bytesArg(args, i)
+						if !ok {
+							return errVal, false
+						}
+						result = append(result, b...)
+					}
+
+					return vm.NewBytes(result), true
+				}),
+
+				// indexOf(b, sub) returns the index of sub or -1
+				"indexOf": vm.NewNativeFunction("indexOf", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					bArg, ok := args.Get(0, vm.ValueTypeBytes)
+					if !ok {
+						return bArg, false
+					}
+
+					sub, errVal, ok := bytesArg(args, 1)
+					if !ok {
+						return errVal, false
+					}
+
+					return vm.NewNumber(float64(bytes.Index(bArg.GetBytes(), sub))), true
+				}),
+
+				"toArray": vm.NewNativeFunction("toArray", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					bArg, ok := args.Get(0, vm.ValueTypeBytes)
+					if !ok {
+						return bArg, false
+					}
+
+					b := bArg.GetBytes()
+					result := make([]vm.Value, len(b))
+					for i, c := range b {
+						result[i] = vm.NewNumber(float64(c))
+					}
+
+					return vm.NewArray(result), true
+				}),
+
+				"buffer": vm.NewNativeFunction("buffer", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					return newBytesBuffer(), true
+				}),
+			},
+		)
+	})
+}
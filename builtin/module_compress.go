@@ -0,0 +1,191 @@
+package builtin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+// compressLevelArg reads an optional compression level from -1 (default)
+// to 9 (best), 0 stores the data without compressing.
+func compressLevelArg(args vm.NativeFunctionArgs, i int) (int, vm.Value, bool) {
+	if args.Len() <= i {
+		return gzip.DefaultCompression, vm.Value{}, true
+	}
+
+	levelArg, ok := args.Get(i, vm.ValueTypeNumber)
+	if !ok {
+		return 0, levelArg, false
+	}
+
+	level := levelArg.GetNumber()
+	if level < gzip.DefaultCompression || level > gzip.BestCompression || level != float64(int(level)) {
+		return 0, vm.NewError("compression level must be an integer from -1 to 9", levelArg), false
+	}
+
+	return int(level), vm.Value{}, true
+}
+
+// compressWith compresses args[0] with a writer made by newWriter.
+func compressWith(args vm.NativeFunctionArgs, newWriter func(io.Writer, int) (io.WriteCloser, error)) (vm.Value, bool) {
+	data, errVal, ok := bytesArg(args, 0)
+	if !ok {
+		return errVal, false
+	}
+
+	level, errVal, ok := compressLevelArg(args, 1)
+	if !ok {
+		return errVal, false
+	}
+
+	var buf bytes.Buffer
+	w, err := newWriter(&buf, level)
+	if err != nil {
+		return vm.NewErrFromErr(err), false
+	}
+	if _, err := w.Write(data); err != nil {
+		return vm.NewErrFromErr(err), false
+	}
+	if err := w.Close(); err != nil {
+		return vm.NewErrFromErr(err), false
+	}
+
+	return vm.NewBytes(buf.Bytes()), true
+}
+
+// decompressWith decompresses args[0] with a reader made by newReader.
+func decompressWith(args vm.NativeFunctionArgs, newReader func(io.Reader) (io.ReadCloser, error)) (vm.Value, bool) {
+	data, errVal, ok := bytesArg(args, 0)
+	if !ok {
+		return errVal, false
+	}
+
+	r, err := newReader(bytes.NewReader(data))
+	if err != nil {
+		return vm.NewErrFromErr(err), false
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return vm.NewErrFromErr(err), false
+	}
+
+	return vm.NewBytes(out), true
+}
+
+func registerCompressModule(builder *vm.RegistryBuilder) {
+	builder.RegisterModule("compress", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				// gzip(data, level?) compresses a string or bytes
+				"gzip": vm.NewNativeFunction("gzip", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					return compressWith(args, func(w io.Writer, level int) (io.WriteCloser, error) {
+						return gzip.NewWriterLevel(w, level)
+					})
+				}),
+
+				"gunzip": vm.NewNativeFunction("gunzip", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					return decompressWith(args, func(r io.Reader) (io.ReadCloser, error) {
+						return gzip.NewReader(r)
+					})
+				}),
+
+				"zlib": vm.NewObject(map[string]vm.Value{
+					// compress(data, level?) compresses a string or bytes
+					"compress": vm.NewNativeFunction("compress", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						return compressWith(args, func(w io.Writer, level int) (io.WriteCloser, error) {
+							return zlib.NewWriterLevel(w, level)
+						})
+					}),
+
+					"decompress": vm.NewNativeFunction("decompress", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						return decompressWith(args, zlib.NewReader)
+					}),
+				}),
+
+				"zip": vm.NewObject(map[string]vm.Value{
+					// open(source) opens a zip file from a path or from bytes
+					"open": vm.NewNativeFunction("open", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						src, ok := args.Get(0, vm.ValueTypeString, vm.ValueTypeBytes)
+						if !ok {
+							return src, false
+						}
+
+						a, err := openZipArchive(src)
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						return newArchiveReader(a), true
+					}),
+
+					"create": vm.NewNativeFunction("create", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						pathArg, ok := args.Get(0, vm.ValueTypeString)
+						if !ok {
+							return pathArg, false
+						}
+
+						w, err := createZipArchive(pathArg.GetString())
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						return newArchiveWriter(w), true
+					}),
+				}),
+
+				"tar": vm.NewObject(map[string]vm.Value{
+					// open(source) opens a tar file from a path or from bytes,
+					// gzipped archives are detected from their header
+					"open": vm.NewNativeFunction("open", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						src, ok := args.Get(0, vm.ValueTypeString, vm.ValueTypeBytes)
+						if !ok {
+							return src, false
+						}
+
+						a, err := openTarArchive(src)
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						return newArchiveReader(a), true
+					}),
+
+					// create(path, {gzip}) gzips when asked to or when the path
+					// ends with .gz or .tgz
+					"create": vm.NewNativeFunction("create", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						pathArg, ok := args.Get(0, vm.ValueTypeString)
+						if !ok {
+							return pathArg, false
+						}
+
+						path := pathArg.GetString()
+						gz := strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".tgz")
+						if args.Len() > 1 {
+							optsArg, ok := args.Get(1, vm.ValueTypeObject)
+							if !ok {
+								return optsArg, false
+							}
+
+							if opt, ok := optsArg.GetObject()["gzip"]; ok {
+								gz = opt.IsTruthy()
+							}
+						}
+
+						w, err := createTarArchive(path, gz)
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						return newArchiveWriter(w), true
+					}),
+				}),
+			},
+		)
+	})
+}
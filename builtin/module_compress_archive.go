@@ -0,0 +1,632 @@
+package builtin
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+var errArchiveStop = errors.New("stop walking the archive")
+
+type archiveEntry struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (e archiveEntry) value() vm.Value {
+	return vm.NewObject(map[string]vm.Value{
+		"name":    vm.NewString(e.name),
+		"size":    vm.NewNumber(float64(e.size)),
+		"isDir":   vm.NewBool(e.mode.IsDir()),
+		"mode":    vm.NewNumber(float64(e.mode.Perm())),
+		"modTime": vm.NewTime(e.modTime),
+	})
+}
+
+// archive is a zip or tar archive being read.
+type archive interface {
+	// walk calls fn for every entry in order, open reads the entry and is
+	// only valid until fn returns. fn can stop early with errArchiveStop.
+	walk(fn func(e archiveEntry, open func() (io.ReadCloser, error)) error) error
+	// open streams a single entry.
+	open(name string) (io.ReadCloser, error)
+	close() error
+}
+
+// archiveWriter is a zip or tar archive being written.
+type archiveWriter interface {
+	// create starts an entry, the data for files is written to the result.
+	create(e archiveEntry) (io.Writer, error)
+	close() error
+}
+
+func archiveEntryNotFound(name string) error {
+	return fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+}
+
+type zipArchive struct {
+	r      *zip.Reader
+	closer io.Closer
+}
+
+func openZipArchive(src vm.Value) (*zipArchive, error) {
+	if src.VType == vm.ValueTypeBytes {
+		b := src.GetBytes()
+		r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			return nil, err
+		}
+
+		return &zipArchive{r: r}, nil
+	}
+
+	rc, err := zip.OpenReader(src.GetString())
+	if err != nil {
+		return nil, err
+	}
+
+	return &zipArchive{r: &rc.Reader, closer: rc}, nil
+}
+
+func (a *zipArchive) walk(fn func(e archiveEntry, open func() (io.ReadCloser, error)) error) error {
+	for _, f := range a.r.File {
+		e := archiveEntry{
+			name:    f.Name,
+			size:    int64(f.UncompressedSize64),
+			mode:    f.Mode(),
+			modTime: f.Modified,
+		}
+
+		if err := fn(e, f.Open); err != nil {
+			if errors.Is(err, errArchiveStop) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *zipArchive) open(name string) (io.ReadCloser, error) {
+	for _, f := range a.r.File {
+		if f.Name == name {
+			return f.Open()
+		}
+	}
+
+	return nil, archiveEntryNotFound(name)
+}
+
+func (a *zipArchive) close() error {
+	if a.closer == nil {
+		return nil
+	}
+
+	return a.closer.Close()
+}
+
+// tarArchive reopens its source for every walk since tar files can only
+// be read from start to end.
+type tarArchive struct {
+	source func() (io.ReadCloser, error)
+}
+
+func openTarArchive(src vm.Value) (*tarArchive, error) {
+	a := &tarArchive{}
+	if src.VType == vm.ValueTypeBytes {
+		b := src.GetBytes()
+		a.source = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(b)), nil
+		}
+	} else {
+		path := src.GetString()
+		a.source = func() (io.ReadCloser, error) {
+			return os.Open(path)
+		}
+	}
+
+	// read the first header so bad archives fail when opened
+	err := a.walk(func(e archiveEntry, open func() (io.ReadCloser, error)) error {
+		return errArchiveStop
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *tarArchive) reader() (*tar.Reader, io.Closer, error) {
+	rc, err := a.source()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(rc)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			rc.Close()
+			return nil, nil, err
+		}
+		r = gz
+	}
+
+	return tar.NewReader(r), rc, nil
+}
+
+func (a *tarArchive) walk(fn func(e archiveEntry, open func() (io.ReadCloser, error)) error) error {
+	tr, closer, err := a.reader()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	open := func() (io.ReadCloser, error) {
+		return io.NopCloser(tr), nil
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		e := archiveEntry{
+			name:    hdr.Name,
+			size:    hdr.Size,
+			mode:    hdr.FileInfo().Mode(),
+			modTime: hdr.ModTime,
+		}
+
+		if err := fn(e, open); err != nil {
+			if errors.Is(err, errArchiveStop) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (a *tarArchive) open(name string) (io.ReadCloser, error) {
+	tr, closer, err := a.reader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			closer.Close()
+			return nil, archiveEntryNotFound(name)
+		}
+		if err != nil {
+			closer.Close()
+			return nil, err
+		}
+
+		if hdr.Name == name {
+			return struct {
+				io.Reader
+				io.Closer
+			}{tr, closer}, nil
+		}
+	}
+}
+
+func (a *tarArchive) close() error {
+	return nil
+}
+
+type zipArchiveWriter struct {
+	f *os.File
+	w *zip.Writer
+}
+
+func createZipArchive(path string) (*zipArchiveWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &zipArchiveWriter{f: f, w: zip.NewWriter(f)}, nil
+}
+
+func (a *zipArchiveWriter) create(e archiveEntry) (io.Writer, error) {
+	hdr := &zip.FileHeader{
+		Name:     e.name,
+		Method:   zip.Deflate,
+		Modified: e.modTime,
+	}
+	hdr.SetMode(e.mode)
+	if e.mode.IsDir() {
+		hdr.Name = strings.TrimSuffix(e.name, "/") + "/"
+		hdr.Method = zip.Store
+	}
+
+	return a.w.CreateHeader(hdr)
+}
+
+func (a *zipArchiveWriter) close() error {
+	return errors.Join(a.w.Close(), a.f.Close())
+}
+
+type tarArchiveWriter struct {
+	f  *os.File
+	gz *gzip.Writer
+	w  *tar.Writer
+}
+
+func createTarArchive(path string, gz bool) (*tarArchiveWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &tarArchiveWriter{f: f}
+	if gz {
+		a.gz = gzip.NewWriter(f)
+		a.w = tar.NewWriter(a.gz)
+	} else {
+		a.w = tar.NewWriter(f)
+	}
+
+	return a, nil
+}
+
+func (a *tarArchiveWriter) create(e archiveEntry) (io.Writer, error) {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     e.name,
+		Size:     e.size,
+		Mode:     int64(e.mode.Perm()),
+		ModTime:  e.modTime,
+	}
+	if e.mode.IsDir() {
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name = strings.TrimSuffix(e.name, "/") + "/"
+		hdr.Size = 0
+	}
+
+	if err := a.w.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+
+	return a.w, nil
+}
+
+func (a *tarArchiveWriter) close() error {
+	err := a.w.Close()
+	if a.gz != nil {
+		err = errors.Join(err, a.gz.Close())
+	}
+
+	return errors.Join(err, a.f.Close())
+}
+
+// extractArchive writes every file and directory in a to dir and returns
+// the extracted entry names. Writes go through an os.Root so entries can't
+// escape dir, not even through symlinks already in it, and entries with
+// absolute or ".." paths fail the extraction. Links and devices are skipped.
+func extractArchive(a archive, dir string) ([]vm.Value, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	names := []vm.Value{}
+	err = a.walk(func(e archiveEntry, open func() (io.ReadCloser, error)) error {
+		name := filepath.FromSlash(strings.TrimSuffix(e.name, "/"))
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("%s: archive entry is outside the destination directory", e.name)
+		}
+
+		switch {
+		case e.mode.IsDir():
+			if err := root.MkdirAll(name, 0755); err != nil {
+				return err
+			}
+
+		case e.mode.IsRegular():
+			if err := root.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				return err
+			}
+
+			perm := e.mode.Perm()
+			if perm == 0 {
+				perm = 0644
+			}
+
+			if err := extractArchiveFile(root, name, perm, open); err != nil {
+				return err
+			}
+
+		default:
+			return nil
+		}
+
+		names = append(names, vm.NewString(e.name))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+func extractArchiveFile(root *os.Root, name string, perm fs.FileMode, open func() (io.ReadCloser, error)) error {
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// newArchiveStream wraps an entry reader, the native object is an io.Reader
+// so csv.reader and json.decoder can stream from it.
+func newArchiveStream(rc io.ReadCloser, name string) vm.Value {
+	return vm.NewNativeObject(rc, map[string]vm.Value{
+		"name": vm.NewString(name),
+
+		// read reads up to n bytes, or the rest of the entry without n,
+		// it returns nil at the end of the entry.
+		"read": vm.NewNativeFunction("read", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			data, errVal, ok := fileRead(rc, args)
+			if !ok || data == nil {
+				return errVal, ok
+			}
+
+			return vm.NewString(string(data)), true
+		}),
+
+		"readBytes": vm.NewNativeFunction("readBytes", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			data, errVal, ok := fileRead(rc, args)
+			if !ok || data == nil {
+				return errVal, ok
+			}
+
+			return vm.NewBytes(data), true
+		}),
+
+		"close": vm.NewNativeFunction("close", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			if err := rc.Close(); err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+
+			return vm.Value{}, true
+		}),
+	})
+}
+
+func newArchiveReader(a archive) vm.Value {
+	return vm.NewNativeObject(a, map[string]vm.Value{
+		// entries returns {name, size, isDir, mode, modTime} for every entry
+		"entries": vm.NewNativeFunction("entries", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			entries := []vm.Value{}
+			err := a.walk(func(e archiveEntry, open func() (io.ReadCloser, error)) error {
+				entries = append(entries, e.value())
+				return nil
+			})
+			if err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+
+			return vm.NewArray(entries), true
+		}),
+
+		// read returns the contents of an entry as bytes
+		"read": vm.NewNativeFunction("read", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			nameArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return nameArg, false
+			}
+
+			rc, err := a.open(nameArg.GetString())
+			if err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+			defer rc.Close()
+
+			data, err := io.ReadAll(rc)
+			if err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+
+			return vm.NewBytes(data), true
+		}),
+
+		// open streams an entry without reading all of it into memory
+		"open": vm.NewNativeFunction("open", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			nameArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return nameArg, false
+			}
+
+			rc, err := a.open(nameArg.GetString())
+			if err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+
+			return newArchiveStream(rc, nameArg.GetString()), true
+		}),
+
+		// extract(dir) extracts everything to dir, see extractArchive
+		"extract": vm.NewNativeFunction("extract", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			dirArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return dirArg, false
+			}
+
+			names, err := extractArchive(a, dirArg.GetString())
+			if err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+
+			return vm.NewArray(names), true
+		}),
+
+		"close": vm.NewNativeFunction("close", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			if err := a.close(); err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+
+			return vm.Value{}, true
+		}),
+	})
+}
+
+func newArchiveWriter(w archiveWriter) vm.Value {
+	var mu sync.Mutex
+
+	return vm.NewNativeObject(w, map[string]vm.Value{
+		// add(name, data) adds a file with a string or bytes as its contents
+		"add": vm.NewNativeFunction("add", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			nameArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return nameArg, false
+			}
+
+			data, errVal, ok := bytesArg(args, 1)
+			if !ok {
+				return errVal, false
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			dst, err := w.create(archiveEntry{
+				name:    nameArg.GetString(),
+				size:    int64(len(data)),
+				mode:    0644,
+				modTime: time.Now(),
+			})
+			if err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+
+			if _, err := dst.Write(data); err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+
+			return vm.Value{}, true
+		}),
+
+		// addFile(name, path) adds a file from disk, directories are added
+		// with everything in them under name
+		"addFile": vm.NewNativeFunction("addFile", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			nameArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return nameArg, false
+			}
+
+			pathArg, ok := args.Get(1, vm.ValueTypeString)
+			if !ok {
+				return pathArg, false
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err := addArchivePath(w, nameArg.GetString(), pathArg.GetString()); err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+
+			return vm.Value{}, true
+		}),
+
+		"close": vm.NewNativeFunction("close", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err := w.close(); err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+
+			return vm.Value{}, true
+		}),
+	})
+}
+
+func addArchivePath(w archiveWriter, name string, path string) error {
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+
+		entryName := name
+		if rel != "." {
+			entryName = strings.TrimSuffix(name, "/") + "/" + filepath.ToSlash(rel)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		dst, err := w.create(archiveEntry{
+			name:    entryName,
+			size:    info.Size(),
+			mode:    info.Mode(),
+			modTime: info.ModTime(),
+		})
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(dst, f)
+		return err
+	})
+}
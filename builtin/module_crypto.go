@@ -0,0 +1,567 @@
+package builtin
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+var cryptoHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// cryptoOutput encodes a digest as hex unless base64 or raw bytes are asked for.
+func cryptoOutput(args vm.NativeFunctionArgs, i int, sum []byte) (vm.Value, bool) {
+	format := "hex"
+	if args.Len() > i {
+		formatArg, ok := args.Get(i, vm.ValueTypeString)
+		if !ok {
+			return formatArg, false
+		}
+		format = formatArg.GetString()
+	}
+
+	switch format {
+	case "hex":
+		return vm.NewString(hex.EncodeToString(sum)), true
+	case "base64":
+		return vm.NewString(base64.StdEncoding.EncodeToString(sum)), true
+	case "raw":
+		return vm.NewBytes(sum), true
+	default:
+		return vm.NewError("unknown output format, expected hex, base64 or raw", vm.NewString(format)), false
+	}
+}
+
+func digestFunc(name string) vm.Value {
+	return vm.NewNativeFunction(name, func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+		data, errVal, ok := bytesArg(args, 0)
+		if !ok {
+			return errVal, false
+		}
+
+		h := cryptoHashes[name]()
+		h.Write(data)
+		return cryptoOutput(args, 1, h.Sum(nil))
+	})
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func formatUUID(b []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// newUUID returns a random UUID, v7 UUIDs start with the unix time in
+// milliseconds so they sort by creation time.
+func newUUID(version byte) (string, error) {
+	b, err := randomBytes(16)
+	if err != nil {
+		return "", err
+	}
+
+	if version == 7 {
+		var ms [8]byte
+		binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixMilli()))
+		copy(b[0:6], ms[2:8])
+	}
+
+	b[6] = b[6]&0x0f | version<<4
+	b[8] = b[8]&0x3f | 0x80
+
+	return formatUUID(b), nil
+}
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	keyLen  uint32
+}
+
+var defaultArgon2Params = argon2Params{time: 1, memory: 64 * 1024, threads: 4, keyLen: 32}
+
+// maxArgon2Memory and maxArgon2Time bound the cost of a hash, memory is in
+// KiB, so a stored hash can't make verify use unbounded memory or time.
+const (
+	maxArgon2Memory = 1024 * 1024
+	maxArgon2Time   = 64
+)
+
+func (p argon2Params) valid() bool {
+	return p.time >= 1 && p.time <= maxArgon2Time &&
+		p.threads >= 1 &&
+		p.keyLen >= 16 &&
+		p.memory >= 8*uint32(p.threads) && p.memory <= maxArgon2Memory
+}
+
+// hashArgon2id returns the hash in the PHC string format that other
+// implementations use: $argon2id$v=19$m=65536,t=1,p=4$salt$key
+func hashArgon2id(password string, p argon2Params) (string, error) {
+	salt, err := randomBytes(16)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLen)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func verifyArgon2id(password string, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errors.New("unsupported argon2id version")
+	}
+
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return false, errors.New("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) < 8 {
+		return false, errors.New("invalid argon2id salt")
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, errors.New("invalid argon2id key")
+	}
+
+	p.keyLen = uint32(len(key))
+	if !p.valid() {
+		return false, errors.New("invalid argon2id parameters")
+	}
+
+	actual := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLen)
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+func parseArgon2Params(args vm.NativeFunctionArgs, i int) (argon2Params, vm.Value, bool) {
+	p := defaultArgon2Params
+	if args.Len() <= i {
+		return p, vm.Value{}, true
+	}
+
+	optsArg, ok := args.Get(i, vm.ValueTypeObject)
+	if !ok {
+		return p, optsArg, false
+	}
+
+	for key, dst := range map[string]*uint32{"time": &p.time, "memory": &p.memory, "keyLen": &p.keyLen} {
+		if val, ok := optsArg.GetObject()[key]; ok {
+			if errVal, ok := vm.CheckValueType(key, val, vm.ValueTypeNumber); !ok {
+				return p, errVal, false
+			}
+			*dst = uint32(val.GetNumber())
+		}
+	}
+
+	if val, ok := optsArg.GetObject()["threads"]; ok {
+		if errVal, ok := vm.CheckValueType("threads", val, vm.ValueTypeNumber); !ok {
+			return p, errVal, false
+		}
+		p.threads = uint8(val.GetNumber())
+	}
+
+	if !p.valid() {
+		return p, vm.NewError("invalid argon2id parameters", optsArg), false
+	}
+
+	return p, vm.Value{}, true
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// aesAdditionalData reads the optional additional authenticated data.
+func aesAdditionalData(args vm.NativeFunctionArgs, i int) ([]byte, vm.Value, bool) {
+	if args.Len() <= i {
+		return nil, vm.Value{}, true
+	}
+
+	ad, errVal, ok := bytesArg(args, i)
+	if !ok {
+		return nil, errVal, false
+	}
+
+	return ad, vm.Value{}, true
+}
+
+func registerCryptoModule(builder *vm.RegistryBuilder) {
+	builder.RegisterModule("crypto", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				// digests return hex unless the output is "base64" or "raw"
+				"md5":    digestFunc("md5"),
+				"sha1":   digestFunc("sha1"),
+				"sha256": digestFunc("sha256"),
+				"sha512": digestFunc("sha512"),
+
+				// hmac(alg, key, data, output?)
+				"hmac": vm.NewNativeFunction("hmac", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					algArg, ok := args.Get(0, vm.ValueTypeString)
+					if !ok {
+						return algArg, false
+					}
+
+					newHash, ok := cryptoHashes[algArg.GetString()]
+					if !ok {
+						return vm.NewError("unknown hash algorithm, expected md5, sha1, sha256 or sha512", algArg), false
+					}
+
+					key, errVal, ok := bytesArg(args, 1)
+					if !ok {
+						return errVal, false
+					}
+
+					data, errVal, ok := bytesArg(args, 2)
+					if !ok {
+						return errVal, false
+					}
+
+					mac := hmac.New(newHash, key)
+					mac.Write(data)
+					return cryptoOutput(args, 3, mac.Sum(nil))
+				}),
+
+				// compare checks two strings in constant time, use it for
+				// signatures and tokens
+				"compare": vm.NewNativeFunction("compare", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					a, errVal, ok := bytesArg(args, 0)
+					if !ok {
+						return errVal, false
+					}
+
+					b, errVal, ok := bytesArg(args, 1)
+					if !ok {
+						return errVal, false
+					}
+
+					return vm.NewBool(subtle.ConstantTimeCompare(a, b) == 1), true
+				}),
+
+				"randomBytes": vm.NewNativeFunction("randomBytes", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					nArg, ok := args.Get(0, vm.ValueTypeNumber)
+					if !ok {
+						return nArg, false
+					}
+
+					if nArg.GetNumber() < 0 {
+						return vm.NewError("randomBytes count must not be negative", nArg), false
+					}
+
+					b, err := randomBytes(int(nArg.GetNumber()))
+					if err != nil {
+						return vm.NewErrFromErr(err), false
+					}
+
+					return vm.NewBytes(b), true
+				}),
+
+				// randomToken(n = 32) returns n random bytes as url safe base64
+				"randomToken": vm.NewNativeFunction("randomToken", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					n := 32
+					if args.Len() > 0 {
+						nArg, ok := args.Get(0, vm.ValueTypeNumber)
+						if !ok {
+							return nArg, false
+						}
+						n = int(nArg.GetNumber())
+					}
+
+					if n < 1 {
+						return vm.NewError("randomToken size must be positive", vm.NewNumber(float64(n))), false
+					}
+
+					b, err := randomBytes(n)
+					if err != nil {
+						return vm.NewErrFromErr(err), false
+					}
+
+					return vm.NewString(base64.RawURLEncoding.EncodeToString(b)), true
+				}),
+
+				"uuid": vm.NewObject(map[string]vm.Value{
+					"v4": vm.NewNativeFunction("v4", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						id, err := newUUID(4)
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						return vm.NewString(id), true
+					}),
+					"v7": vm.NewNativeFunction("v7", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						id, err := newUUID(7)
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						return vm.NewString(id), true
+					}),
+				}),
+
+				"bcrypt": vm.NewObject(map[string]vm.Value{
+					// hash(password, cost = 10)
+					"hash": vm.NewNativeFunction("hash", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						passwordArg, ok := args.Get(0, vm.ValueTypeString)
+						if !ok {
+							return passwordArg, false
+						}
+
+						cost := bcrypt.DefaultCost
+						if args.Len() > 1 {
+							costArg, ok := args.Get(1, vm.ValueTypeNumber)
+							if !ok {
+								return costArg, false
+							}
+							cost = int(costArg.GetNumber())
+						}
+
+						h, err := bcrypt.GenerateFromPassword([]byte(passwordArg.GetString()), cost)
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						return vm.NewString(string(h)), true
+					}),
+					"verify": vm.NewNativeFunction("verify", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						passwordArg, ok := args.Get(0, vm.ValueTypeString)
+						if !ok {
+							return passwordArg, false
+						}
+
+						hashArg, ok := args.Get(1, vm.ValueTypeString)
+						if !ok {
+							return hashArg, false
+						}
+
+						err := bcrypt.CompareHashAndPassword([]byte(hashArg.GetString()), []byte(passwordArg.GetString()))
+						if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+							return vm.NewBool(false), true
+						}
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						return vm.NewBool(true), true
+					}),
+				}),
+
+				// argon2 uses the argon2id variant, identifiers can't have
+				// letters after digits so it can't be called argon2id.
+				"argon2": vm.NewObject(map[string]vm.Value{
+					// hash(password, {time, memory, threads, keyLen}), memory is in KiB
+					"hash": vm.NewNativeFunction("hash", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						passwordArg, ok := args.Get(0, vm.ValueTypeString)
+						if !ok {
+							return passwordArg, false
+						}
+
+						p, errVal, ok := parseArgon2Params(args, 1)
+						if !ok {
+							return errVal, false
+						}
+
+						h, err := hashArgon2id(passwordArg.GetString(), p)
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						return vm.NewString(h), true
+					}),
+					"verify": vm.NewNativeFunction("verify", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						passwordArg, ok := args.Get(0, vm.ValueTypeString)
+						if !ok {
+							return passwordArg, false
+						}
+
+						hashArg, ok := args.Get(1, vm.ValueTypeString)
+						if !ok {
+							return hashArg, false
+						}
+
+						matched, err := verifyArgon2id(passwordArg.GetString(), hashArg.GetString())
+						if err != nil {
+							return vm.NewError(err.Error(), hashArg), false
+						}
+
+						return vm.NewBool(matched), true
+					}),
+				}),
+
+				// aes uses AES-GCM, the key is 16, 24 or 32 bytes and the
+				// nonce is prepended to the ciphertext.
+				"aes": vm.NewObject(map[string]vm.Value{
+					// encrypt(key, plaintext, additionalData?)
+					"encrypt": vm.NewNativeFunction("encrypt", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						key, errVal, ok := bytesArg(args, 0)
+						if !ok {
+							return errVal, false
+						}
+
+						plain, errVal, ok := bytesArg(args, 1)
+						if !ok {
+							return errVal, false
+						}
+
+						ad, errVal, ok := aesAdditionalData(args, 2)
+						if !ok {
+							return errVal, false
+						}
+
+						gcm, err := newAESGCM(key)
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						nonce, err := randomBytes(gcm.NonceSize())
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						return vm.NewBytes(gcm.Seal(nonce, nonce, plain, ad)), true
+					}),
+
+					// decrypt(key, ciphertext, additionalData?)
+					"decrypt": vm.NewNativeFunction("decrypt", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						key, errVal, ok := bytesArg(args, 0)
+						if !ok {
+							return errVal, false
+						}
+
+						data, errVal, ok := bytesArg(args, 1)
+						if !ok {
+							return errVal, false
+						}
+
+						ad, errVal, ok := aesAdditionalData(args, 2)
+						if !ok {
+							return errVal, false
+						}
+
+						gcm, err := newAESGCM(key)
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						if len(data) < gcm.NonceSize() {
+							return vm.NewError("aes: ciphertext too short", vm.Value{}), false
+						}
+
+						plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], ad)
+						if err != nil {
+							return vm.NewError("aes: "+err.Error(), vm.Value{}), false
+						}
+
+						return vm.NewBytes(plain), true
+					}),
+				}),
+
+				"ed25519": vm.NewObject(map[string]vm.Value{
+					// generateKey returns {publicKey, privateKey} as bytes
+					"generateKey": vm.NewNativeFunction("generateKey", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						pub, priv, err := ed25519.GenerateKey(rand.Reader)
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						return vm.NewObject(map[string]vm.Value{
+							"publicKey":  vm.NewBytes(pub),
+							"privateKey": vm.NewBytes(priv),
+						}), true
+					}),
+
+					// sign(privateKey, message)
+					"sign": vm.NewNativeFunction("sign", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						key, errVal, ok := bytesArg(args, 0)
+						if !ok {
+							return errVal, false
+						}
+
+						msg, errVal, ok := bytesArg(args, 1)
+						if !ok {
+							return errVal, false
+						}
+
+						if len(key) != ed25519.PrivateKeySize {
+							return vm.NewError(fmt.Sprintf("ed25519: private key must be %d bytes", ed25519.PrivateKeySize), vm.Value{}), false
+						}
+
+						return vm.NewBytes(ed25519.Sign(key, msg)), true
+					}),
+
+					// verify(publicKey, message, signature)
+					"verify": vm.NewNativeFunction("verify", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						key, errVal, ok := bytesArg(args, 0)
+						if !ok {
+							return errVal, false
+						}
+
+						msg, errVal, ok := bytesArg(args, 1)
+						if !ok {
+							return errVal, false
+						}
+
+						sig, errVal, ok := bytesArg(args, 2)
+						if !ok {
+							return errVal, false
+						}
+
+						if len(key) != ed25519.PublicKeySize {
+							return vm.NewError(fmt.Sprintf("ed25519: public key must be %d bytes", ed25519.PublicKeySize), vm.Value{}), false
+						}
+
+						return vm.NewBool(ed25519.Verify(key, msg, sig)), true
+					}),
+				}),
+			},
+		)
+	})
+}
@@ -0,0 +1,463 @@
+package builtin
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+type csvOptions struct {
+	delimiter rune
+	comment   rune
+	// header reads keys from the first row, columns is set when the
+	// keys are given instead
+	header  bool
+	columns []string
+	infer   bool
+	crlf    bool
+}
+
+func csvRuneOption(opts map[string]vm.Value, key string, dst *rune) (vm.Value, bool) {
+	val, ok := opts[key]
+	if !ok {
+		return vm.Value{}, true
+	}
+
+	if errVal, ok := vm.CheckValueType(key, val, vm.ValueTypeString); !ok {
+		return errVal, false
+	}
+
+	r, size := utf8.DecodeRuneInString(val.GetString())
+	if size == 0 || size != len(val.GetString()) {
+		return vm.NewError("csv: "+key+" must be a single character", val), false
+	}
+
+	*dst = r
+	return vm.Value{}, true
+}
+
+func parseCSVOptions(args vm.NativeFunctionArgs, i int) (csvOptions, vm.Value, bool) {
+	opts := csvOptions{delimiter: ','}
+	if args.Len() <= i {
+		return opts, vm.Value{}, true
+	}
+
+	optsArg, ok := args.Get(i, vm.ValueTypeObject)
+	if !ok {
+		return opts, optsArg, false
+	}
+	m := optsArg.GetObject()
+
+	if errVal, ok := csvRuneOption(m, "delimiter", &opts.delimiter); !ok {
+		return opts, errVal, false
+	}
+	if errVal, ok := csvRuneOption(m, "comment", &opts.comment); !ok {
+		return opts, errVal, false
+	}
+
+	if header, ok := m["header"]; ok {
+		if header.VType == vm.ValueTypeArray {
+			for _, col := range *header.GetArray() {
+				if errVal, ok := vm.CheckValueType("header", col, vm.ValueTypeString); !ok {
+					return opts, errVal, false
+				}
+				opts.columns = append(opts.columns, col.GetString())
+			}
+		} else {
+			opts.header = header.IsTruthy()
+		}
+	}
+
+	infer, crlf := m["infer"], m["crlf"]
+	opts.infer = infer.IsTruthy()
+	opts.crlf = crlf.IsTruthy()
+
+	return opts, vm.Value{}, true
+}
+
+func csvError(err error) vm.Value {
+	var parseErr *csv.ParseError
+	if !errors.As(err, &parseErr) {
+		return vm.NewError("csv: "+err.Error(), vm.Value{})
+	}
+
+	return vm.NewError(
+		"csv: "+parseErr.Error(),
+		vm.NewObject(map[string]vm.Value{
+			"line":   vm.NewNumber(float64(parseErr.Line)),
+			"column": vm.NewNumber(float64(parseErr.Column)),
+		}),
+	)
+}
+
+// csvNumber matches numbers without leading zeros, so codes like 007 or zip
+// codes aren't changed.
+var csvNumber = regexp.MustCompile(`^[+-]?((0|[1-9]\d*)(\.\d*)?|\.\d+)([eE][+-]?\d+)?$`)
+
+// csvField infers numbers and booleans when asked to, everything
+// else, including empty fields, stays a string.
+func csvField(field string, infer bool) vm.Value {
+	if infer {
+		switch {
+		case field == "true":
+			return vm.NewBool(true)
+		case field == "false":
+			return vm.NewBool(false)
+		case csvNumber.MatchString(field):
+			n, err := strconv.ParseFloat(field, 64)
+			if err == nil {
+				return vm.NewNumber(n)
+			}
+		}
+	}
+
+	return vm.NewString(field)
+}
+
+// csvRows reads records one by one and turns them into arrays, or into
+// objects keyed by the header where missing fields are nil.
+type csvRows struct {
+	r       *csv.Reader
+	opts    csvOptions
+	columns []string
+}
+
+func newCSVRows(r io.Reader, opts csvOptions) *csvRows {
+	cr := csv.NewReader(r)
+	cr.Comma = opts.delimiter
+	cr.Comment = opts.comment
+	cr.ReuseRecord = true
+	if opts.header || opts.columns != nil {
+		// short rows are padded with nil, long ones are checked in next
+		cr.FieldsPerRecord = -1
+	}
+
+	return &csvRows{r: cr, opts: opts, columns: opts.columns}
+}
+
+// next returns false at the end of the input.
+func (c *csvRows) next() (vm.Value, bool, error) {
+	record, err := c.r.Read()
+	if err == io.EOF {
+		return vm.Value{}, false, nil
+	}
+	if err != nil {
+		return vm.Value{}, false, err
+	}
+
+	if c.opts.header && c.columns == nil {
+		c.columns = slices.Clone(record)
+		return c.next()
+	}
+
+	if c.columns == nil {
+		row := make([]vm.Value, len(record))
+		for i, field := range record {
+			row[i] = csvField(field, c.opts.infer)
+		}
+		return vm.NewArray(row), true, nil
+	}
+
+	if len(record) > len(c.columns) {
+		line, column := c.r.FieldPos(len(c.columns))
+		return vm.Value{}, false, &csv.ParseError{StartLine: line, Line: line, Column: column, Err: csv.ErrFieldCount}
+	}
+
+	row := make(map[string]vm.Value, len(c.columns))
+	for i, col := range c.columns {
+		if i < len(record) {
+			row[col] = csvField(record[i], c.opts.infer)
+		} else {
+			row[col] = vm.Value{}
+		}
+	}
+	return vm.NewObject(row), true, nil
+}
+
+func csvFieldString(val vm.Value) (string, vm.Value, bool) {
+	switch val.VType {
+	case vm.ValueTypeNil:
+		return "", vm.Value{}, true
+	case vm.ValueTypeString, vm.ValueTypeNumber, vm.ValueTypeBool, vm.ValueTypeTime:
+		return val.String(), vm.Value{}, true
+	default:
+		return "", vm.NewError("csv: cannot write a field of type "+val.VType.String(), val), false
+	}
+}
+
+// csvWriter writes rows as arrays, or objects in the order of the header,
+// the header row is written before the first row.
+type csvWriter struct {
+	mu          sync.Mutex
+	w           *csv.Writer
+	buf         *bytes.Buffer
+	columns     []string
+	wroteHeader bool
+}
+
+func (c *csvWriter) write(row vm.Value) (vm.Value, bool) {
+	if errVal, ok := vm.CheckValueType("row", row, vm.ValueTypeArray, vm.ValueTypeObject); !ok {
+		return errVal, false
+	}
+
+	if row.VType == vm.ValueTypeObject && c.columns == nil {
+		c.columns = slices.Sorted(maps.Keys(row.GetObject()))
+	}
+
+	if c.columns != nil && !c.wroteHeader {
+		c.wroteHeader = true
+		if err := c.w.Write(c.columns); err != nil {
+			return csvError(err), false
+		}
+	}
+
+	var fields []vm.Value
+	if row.VType == vm.ValueTypeArray {
+		fields = *row.GetArray()
+	} else {
+		m := row.GetObject()
+		for _, col := range c.columns {
+			fields = append(fields, m[col])
+		}
+	}
+
+	record := make([]string, len(fields))
+	for i, field := range fields {
+		s, errVal, ok := csvFieldString(field)
+		if !ok {
+			return errVal, false
+		}
+		record[i] = s
+	}
+
+	if err := c.w.Write(record); err != nil {
+		return csvError(err), false
+	}
+
+	return vm.Value{}, true
+}
+
+func (c *csvWriter) flush() (vm.Value, bool) {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return csvError(err), false
+	}
+
+	return vm.Value{}, true
+}
+
+func newCSVWriter(w io.Writer, opts csvOptions) *csvWriter {
+	cw := &csvWriter{columns: opts.columns}
+	if w == nil {
+		cw.buf = &bytes.Buffer{}
+		w = cw.buf
+	}
+
+	cw.w = csv.NewWriter(w)
+	cw.w.Comma = opts.delimiter
+	cw.w.UseCRLF = opts.crlf
+
+	return cw
+}
+
+func newCSVWriterObject(cw *csvWriter) vm.Value {
+	return vm.NewNativeObject(cw, map[string]vm.Value{
+		"write": vm.NewNativeFunction("write", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			row, ok := args.Get(0)
+			if !ok {
+				return row, false
+			}
+
+			cw.mu.Lock()
+			defer cw.mu.Unlock()
+
+			return cw.write(row)
+		}),
+
+		"writeAll": vm.NewNativeFunction("writeAll", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			rowsArg, ok := args.Get(0, vm.ValueTypeArray)
+			if !ok {
+				return rowsArg, false
+			}
+
+			cw.mu.Lock()
+			defer cw.mu.Unlock()
+
+			for _, row := range *rowsArg.GetArray() {
+				if errVal, ok := cw.write(row); !ok {
+					return errVal, false
+				}
+			}
+
+			return cw.flush()
+		}),
+
+		// flush writes buffered rows to the destination
+		"flush": vm.NewNativeFunction("flush", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			cw.mu.Lock()
+			defer cw.mu.Unlock()
+
+			return cw.flush()
+		}),
+
+		// toString returns what was written when there is no destination
+		"toString": vm.NewNativeFunction("toString", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			cw.mu.Lock()
+			defer cw.mu.Unlock()
+
+			if cw.buf == nil {
+				return vm.NewError("csv: toString is only available without a destination", vm.Value{}), false
+			}
+
+			if errVal, ok := cw.flush(); !ok {
+				return errVal, false
+			}
+
+			return vm.NewString(cw.buf.String()), true
+		}),
+	})
+}
+
+// csvSource accepts a string or a native object that is an io.Reader,
+// like a file from io.open.
+func csvSource(args vm.NativeFunctionArgs, name string) (io.Reader, vm.Value, bool) {
+	src, ok := args.Get(0, vm.ValueTypeString, vm.ValueTypeNativeObject)
+	if !ok {
+		return nil, src, false
+	}
+
+	if src.VType == vm.ValueTypeString {
+		return strings.NewReader(src.GetString()), vm.Value{}, true
+	}
+
+	if r, ok := src.GetNativeObject().Obj.(io.Reader); ok {
+		return r, vm.Value{}, true
+	}
+
+	return nil, vm.NewError("csv."+name+": expected a string or a reader", src), false
+}
+
+func registerCSVModule(builder *vm.RegistryBuilder) {
+	builder.RegisterModule("csv", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				// parse(str, {header, delimiter, comment, infer}), header is true
+				// to read the keys from the first row or an array of keys.
+				"parse": vm.NewNativeFunction("parse", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					r, errVal, ok := csvSource(args, "parse")
+					if !ok {
+						return errVal, false
+					}
+
+					opts, errVal, ok := parseCSVOptions(args, 1)
+					if !ok {
+						return errVal, false
+					}
+
+					rows := newCSVRows(r, opts)
+					result := []vm.Value{}
+					for {
+						row, ok, err := rows.next()
+						if err != nil {
+							return csvError(err), false
+						}
+						if !ok {
+							break
+						}
+						result = append(result, row)
+					}
+
+					return vm.NewArray(result), true
+				}),
+
+				// reader(source, opts) iterates the rows of a string or a reader
+				// without loading all of it, it takes the same options as parse.
+				"reader": vm.NewNativeFunction("reader", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					r, errVal, ok := csvSource(args, "reader")
+					if !ok {
+						return errVal, false
+					}
+
+					opts, errVal, ok := parseCSVOptions(args, 1)
+					if !ok {
+						return errVal, false
+					}
+
+					return vm.NewIter(func(yield func(vm.Value) bool) {
+						rows := newCSVRows(r, opts)
+						for {
+							row, ok, err := rows.next()
+							if err != nil {
+								raiseIterError(csvError(err))
+							}
+							if !ok || !yield(row) {
+								return
+							}
+						}
+					}), true
+				}),
+
+				// writer(destination?, {header, delimiter, crlf}) writes rows to a
+				// writer, like a file from io.open, or to a string without one.
+				"writer": vm.NewNativeFunction("writer", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					var w io.Writer
+					optsIdx := 0
+					if args.Len() > 0 {
+						if dest := args.Args[0]; dest.VType == vm.ValueTypeNativeObject {
+							writer, ok := dest.GetNativeObject().Obj.(io.Writer)
+							if !ok {
+								return vm.NewError("csv.writer: expected a writer", dest), false
+							}
+							w = writer
+							optsIdx = 1
+						}
+					}
+
+					opts, errVal, ok := parseCSVOptions(args, optsIdx)
+					if !ok {
+						return errVal, false
+					}
+
+					return newCSVWriterObject(newCSVWriter(w, opts)), true
+				}),
+
+				// stringify(rows, opts), objects are written under a header of
+				// their sorted keys unless the header is given.
+				"stringify": vm.NewNativeFunction("stringify", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					rowsArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return rowsArg, false
+					}
+
+					opts, errVal, ok := parseCSVOptions(args, 1)
+					if !ok {
+						return errVal, false
+					}
+
+					cw := newCSVWriter(nil, opts)
+					for _, row := range *rowsArg.GetArray() {
+						if errVal, ok := cw.write(row); !ok {
+							return errVal, false
+						}
+					}
+
+					if errVal, ok := cw.flush(); !ok {
+						return errVal, false
+					}
+
+					return vm.NewString(cw.buf.String()), true
+				}),
+			},
+		)
+	})
+}
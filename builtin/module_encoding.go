@@ -0,0 +1,466 @@
+package builtin
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+var base64Encodings = map[string]*base64.Encoding{
+	"std":    base64.StdEncoding,
+	"url":    base64.URLEncoding,
+	"rawStd": base64.RawStdEncoding,
+	"rawUrl": base64.RawURLEncoding,
+}
+
+func base64Encoding(args vm.NativeFunctionArgs, i int) (*base64.Encoding, vm.Value, bool) {
+	if args.Len() <= i {
+		return base64.StdEncoding, vm.Value{}, true
+	}
+
+	variantArg, ok := args.Get(i, vm.ValueTypeString)
+	if !ok {
+		return nil, variantArg, false
+	}
+
+	enc, ok := base64Encodings[variantArg.GetString()]
+	if !ok {
+		return nil, vm.NewError("unknown base64 variant, expected std, url, rawStd or rawUrl", variantArg), false
+	}
+
+	return enc, vm.Value{}, true
+}
+
+// stringFunc wraps a function from string to string that can fail.
+func stringFunc(name string, fn func(string) (string, error)) vm.Value {
+	return vm.NewNativeFunction(name, func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+		strArg, ok := args.Get(0, vm.ValueTypeString)
+		if !ok {
+			return strArg, false
+		}
+
+		result, err := fn(strArg.GetString())
+		if err != nil {
+			return vm.NewError(err.Error(), strArg), false
+		}
+
+		return vm.NewString(result), true
+	})
+}
+
+// packField is a single field of a binary format, count is the repeat
+// count, or the length for s.
+type packField struct {
+	code  byte
+	count int
+}
+
+func packFieldSize(code byte) int {
+	switch code {
+	case 'b', 'B', 'x', 's', '?':
+		return 1
+	case 'h', 'H':
+		return 2
+	case 'i', 'I', 'f':
+		return 4
+	case 'q', 'Q', 'd':
+		return 8
+	default:
+		return 0
+	}
+}
+
+// maxPackSize bounds the number of bytes a binary format can describe,
+// so a large count is an error instead of a huge allocation.
+const maxPackSize = 1 << 26
+
+// packFormat is a parsed binary format, size is the number of bytes it
+// describes and values the number of values it packs.
+type packFormat struct {
+	order  binary.ByteOrder
+	fields []packField
+	size   int
+	values int
+}
+
+// parsePackFormat parses struct like formats, an optional byte order
+// (< little, > or ! big, = native) followed by fields like "2i", "h" or "5s".
+func parsePackFormat(format string) (packFormat, error) {
+	var order binary.ByteOrder = binary.LittleEndian
+	if len(format) > 0 {
+		switch format[0] {
+		case '<':
+			order = binary.LittleEndian
+			format = format[1:]
+		case '>', '!':
+			order = binary.BigEndian
+			format = format[1:]
+		case '=':
+			order = binary.NativeEndian
+			format = format[1:]
+		}
+	}
+
+	f := packFormat{order: order, fields: []packField{}}
+	for i := 0; i < len(format); i++ {
+		if format[i] == ' ' {
+			continue
+		}
+
+		start := i
+		for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+			i++
+		}
+
+		count := 1
+		if i > start {
+			n, err := strconv.Atoi(format[start:i])
+			if err != nil || n > maxPackSize {
+				return f, fmt.Errorf("binary format %q has a count over %d", format, maxPackSize)
+			}
+			count = n
+		}
+
+		if i >= len(format) {
+			return f, fmt.Errorf("binary format %q ends with a count", format)
+		}
+
+		code := format[i]
+		fieldSize := packFieldSize(code)
+		if fieldSize == 0 {
+			return f, fmt.Errorf("unknown binary format code %q", code)
+		}
+
+		f.fields = append(f.fields, packField{code: code, count: count})
+		f.size += fieldSize * count
+		if f.size > maxPackSize {
+			return f, fmt.Errorf("binary format %q is over %d bytes", format, maxPackSize)
+		}
+
+		switch code {
+		case 'x':
+		case 's':
+			f.values++
+		default:
+			f.values += count
+		}
+	}
+
+	return f, nil
+}
+
+func packInt(buf []byte, order binary.ByteOrder, code byte, val vm.Value) error {
+	if val.VType != vm.ValueTypeNumber {
+		return fmt.Errorf("binary.pack: %c expects a number, got %s", code, val.VType)
+	}
+
+	n := val.GetNumber()
+	if n != math.Trunc(n) {
+		return fmt.Errorf("binary.pack: %c expects an integer, got %v", code, n)
+	}
+
+	// hi is exclusive so the 64 bit bounds are exact as floats
+	var lo, hi float64
+	switch code {
+	case 'b':
+		lo, hi = math.MinInt8, math.MaxInt8+1
+	case 'B':
+		lo, hi = 0, math.MaxUint8+1
+	case 'h':
+		lo, hi = math.MinInt16, math.MaxInt16+1
+	case 'H':
+		lo, hi = 0, math.MaxUint16+1
+	case 'i':
+		lo, hi = math.MinInt32, math.MaxInt32+1
+	case 'I':
+		lo, hi = 0, math.MaxUint32+1
+	case 'q':
+		lo, hi = math.MinInt64, 1<<63
+	case 'Q':
+		lo, hi = 0, 1<<64
+	}
+	if n < lo || n >= hi {
+		return fmt.Errorf("binary.pack: %v is out of range for %c", n, code)
+	}
+
+	switch code {
+	case 'b':
+		buf[0] = byte(int8(n))
+	case 'B':
+		buf[0] = byte(n)
+	case 'h':
+		order.PutUint16(buf, uint16(int16(n)))
+	case 'H':
+		order.PutUint16(buf, uint16(n))
+	case 'i':
+		order.PutUint32(buf, uint32(int32(n)))
+	case 'I':
+		order.PutUint32(buf, uint32(n))
+	case 'q':
+		order.PutUint64(buf, uint64(int64(n)))
+	case 'Q':
+		order.PutUint64(buf, uint64(n))
+	}
+
+	return nil
+}
+
+func binaryPack(format string, values []vm.Value) ([]byte, error) {
+	f, err := parsePackFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.values != len(values) {
+		return nil, fmt.Errorf("binary.pack: format %q takes %d values, got %d", format, f.values, len(values))
+	}
+
+	order := f.order
+	buf := make([]byte, f.size)
+	off := 0
+	next := 0
+	nextValue := func() vm.Value {
+		next++
+		return values[next-1]
+	}
+
+	for _, field := range f.fields {
+		fieldSize := packFieldSize(field.code)
+
+		switch field.code {
+		case 'x':
+			off += field.count
+			continue
+
+		case 's':
+			val := nextValue()
+			if val.VType != vm.ValueTypeString && val.VType != vm.ValueTypeBytes {
+				return nil, fmt.Errorf("binary.pack: s expects a string or bytes, got %s", val.VType)
+			}
+			// shorter strings are padded with zeros, longer ones are cut
+			copy(buf[off:off+field.count], bytesOf(val))
+			off += field.count
+			continue
+		}
+
+		for range field.count {
+			val := nextValue()
+
+			dst := buf[off : off+fieldSize]
+			switch field.code {
+			case '?':
+				if val.IsTruthy() {
+					dst[0] = 1
+				}
+			case 'f', 'd':
+				if val.VType != vm.ValueTypeNumber {
+					return nil, fmt.Errorf("binary.pack: %c expects a number, got %s", field.code, val.VType)
+				}
+				if field.code == 'f' {
+					order.PutUint32(dst, math.Float32bits(float32(val.GetNumber())))
+				} else {
+					order.PutUint64(dst, math.Float64bits(val.GetNumber()))
+				}
+			default:
+				if err := packInt(dst, order, field.code, val); err != nil {
+					return nil, err
+				}
+			}
+			off += fieldSize
+		}
+	}
+
+	return buf, nil
+}
+
+func binaryUnpack(format string, b []byte) ([]vm.Value, error) {
+	f, err := parsePackFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) != f.size {
+		return nil, fmt.Errorf("binary.unpack: format %q needs %d bytes, got %d", format, f.size, len(b))
+	}
+
+	order := f.order
+	result := make([]vm.Value, 0, f.values)
+	off := 0
+	for _, field := range f.fields {
+		switch field.code {
+		case 'x':
+			off += field.count
+			continue
+		case 's':
+			result = append(result, vm.NewString(string(b[off:off+field.count])))
+			off += field.count
+			continue
+		}
+
+		fieldSize := packFieldSize(field.code)
+		for range field.count {
+			src := b[off : off+fieldSize]
+			var n float64
+			switch field.code {
+			case '?':
+				result = append(result, vm.NewBool(src[0] != 0))
+				off += fieldSize
+				continue
+			case 'b':
+				n = float64(int8(src[0]))
+			case 'B':
+				n = float64(src[0])
+			case 'h':
+				n = float64(int16(order.Uint16(src)))
+			case 'H':
+				n = float64(order.Uint16(src))
+			case 'i':
+				n = float64(int32(order.Uint32(src)))
+			case 'I':
+				n = float64(order.Uint32(src))
+			case 'q':
+				n = float64(int64(order.Uint64(src)))
+			case 'Q':
+				n = float64(order.Uint64(src))
+			case 'f':
+				n = float64(math.Float32frombits(order.Uint32(src)))
+			case 'd':
+				n = math.Float64frombits(order.Uint64(src))
+			}
+			result = append(result, vm.NewNumber(n))
+			off += fieldSize
+		}
+	}
+
+	return result, nil
+}
+
+func registerEncodingModule(builder *vm.RegistryBuilder) {
+	builder.RegisterModule("encoding", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				// base64 functions take an optional variant: std, url, rawStd or rawUrl,
+				// the raw variants have no padding.
+				"base64": vm.NewObject(map[string]vm.Value{
+					"encode": vm.NewNativeFunction("encode", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						data, errVal, ok := bytesArg(args, 0)
+						if !ok {
+							return errVal, false
+						}
+
+						enc, errVal, ok := base64Encoding(args, 1)
+						if !ok {
+							return errVal, false
+						}
+
+						return vm.NewString(enc.EncodeToString(data)), true
+					}),
+					"decode": vm.NewNativeFunction("decode", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						strArg, ok := args.Get(0, vm.ValueTypeString)
+						if !ok {
+							return strArg, false
+						}
+
+						enc, errVal, ok := base64Encoding(args, 1)
+						if !ok {
+							return errVal, false
+						}
+
+						data, err := enc.DecodeString(strArg.GetString())
+						if err != nil {
+							return vm.NewError("base64: "+err.Error(), strArg), false
+						}
+
+						return vm.NewString(string(data)), true
+					}),
+				}),
+
+				"hex": vm.NewObject(map[string]vm.Value{
+					"encode": vm.NewNativeFunction("encode", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						data, errVal, ok := bytesArg(args, 0)
+						if !ok {
+							return errVal, false
+						}
+
+						return vm.NewString(hex.EncodeToString(data)), true
+					}),
+					"decode": stringFunc("decode", func(s string) (string, error) {
+						data, err := hex.DecodeString(s)
+						if err != nil {
+							return "", fmt.Errorf("hex: %w", err)
+						}
+						return string(data), nil
+					}),
+				}),
+
+				"url": vm.NewObject(map[string]vm.Value{
+					"queryEscape": stringFunc("queryEscape", func(s string) (string, error) {
+						return url.QueryEscape(s), nil
+					}),
+					"queryUnescape": stringFunc("queryUnescape", url.QueryUnescape),
+					"pathEscape": stringFunc("pathEscape", func(s string) (string, error) {
+						return url.PathEscape(s), nil
+					}),
+					"pathUnescape": stringFunc("pathUnescape", url.PathUnescape),
+				}),
+
+				"binary": vm.NewObject(map[string]vm.Value{
+					// pack(format, ...values) packs values into bytes
+					"pack": vm.NewNativeFunction("pack", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						formatArg, ok := args.Get(0, vm.ValueTypeString)
+						if !ok {
+							return formatArg, false
+						}
+
+						data, err := binaryPack(formatArg.GetString(), args.Args[1:])
+						if err != nil {
+							return vm.NewError(err.Error(), formatArg), false
+						}
+
+						return vm.NewBytes(data), true
+					}),
+
+					// unpack(format, data) returns an array of the packed values
+					"unpack": vm.NewNativeFunction("unpack", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						formatArg, ok := args.Get(0, vm.ValueTypeString)
+						if !ok {
+							return formatArg, false
+						}
+
+						data, errVal, ok := bytesArg(args, 1)
+						if !ok {
+							return errVal, false
+						}
+
+						values, err := binaryUnpack(formatArg.GetString(), data)
+						if err != nil {
+							return vm.NewError(err.Error(), formatArg), false
+						}
+
+						return vm.NewArray(values), true
+					}),
+
+					"size": vm.NewNativeFunction("size", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						formatArg, ok := args.Get(0, vm.ValueTypeString)
+						if !ok {
+							return formatArg, false
+						}
+
+						f, err := parsePackFormat(formatArg.GetString())
+						if err != nil {
+							return vm.NewError(err.Error(), formatArg), false
+						}
+
+						return vm.NewNumber(float64(f.size)), true
+					}),
+				}),
+			},
+		)
+	})
+}
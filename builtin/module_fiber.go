@@ -1,7 +1,12 @@
 package builtin
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
 	"sync"
+	"time"
 
 	"github.com/joetifa2003/weaver/vm"
 )
@@ -16,7 +21,25 @@ func registerFiberModule(builder *vm.RegistryBuilder) {
 						return fnArg, false
 					}
 
-					return vm.NewTask(runFunc(v, fnArg)), true
+					if len(args.Args) < 2 {
+						return vm.NewTask(runFunc(v, fnArg)), true
+					}
+
+					optsArg, ok := args.Get(1, vm.ValueTypeObject)
+					if !ok {
+						return optsArg, false
+					}
+
+					opts := vm.TaskOptions{}
+					if priority, ok := optsArg.GetObject()["priority"]; ok {
+						priority, ok := vm.CheckValueType("run.priority", priority, vm.ValueTypeNumber)
+						if !ok {
+							return priority, false
+						}
+						opts.Priority = int(priority.GetNumber())
+					}
+
+					return vm.NewTask(v.Executor.RunWithOptions(v.Ctx, opts, fnArg)), true
 				}),
 
 				"wait": vm.NewNativeFunction("wait", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
@@ -26,14 +49,14 @@ func registerFiberModule(builder *vm.RegistryBuilder) {
 					}
 
 					if taskArg.VType == vm.ValueTypeTask {
-						return waitForTask(taskArg)
+						return waitForTask(v, taskArg)
 					} else {
 						vals := make([]vm.Value, 0, len(*taskArg.GetArray()))
 						for _, task := range *taskArg.GetArray() {
 							if err, ok := vm.CheckValueType("wait", task, vm.ValueTypeTask); !ok {
 								return err, false
 							}
-							val, ok := waitForTask(task)
+							val, ok := waitForTask(v, task)
 							if !ok {
 								return val, false
 							}
@@ -62,6 +85,67 @@ func registerFiberModule(builder *vm.RegistryBuilder) {
 					return l, true
 				}),
 
+				"newRWLock": vm.NewNativeFunction("newRWLock", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					return newRWLock(), true
+				}),
+
+				"newSemaphore": vm.NewNativeFunction("newSemaphore", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					nArg, ok := args.Get(0, vm.ValueTypeNumber)
+					if !ok {
+						return nArg, false
+					}
+
+					if nArg.GetNumber() < 1 {
+						return vm.NewError("semaphore size must be positive", nArg), false
+					}
+
+					return newSemaphore(int(nArg.GetNumber())), true
+				}),
+
+				"newWaitGroup": vm.NewNativeFunction("newWaitGroup", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					return newWaitGroup(), true
+				}),
+
+				"once": vm.NewNativeFunction("once", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					fnArg, ok := args.Get(0, vm.ValueTypeFunction)
+					if !ok {
+						return fnArg, false
+					}
+
+					return newOnce(fnArg), true
+				}),
+
+				"newCounter": vm.NewNativeFunction("newCounter", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					var initial int64
+					if len(args.Args) > 0 {
+						initialArg, ok := args.Get(0, vm.ValueTypeNumber)
+						if !ok {
+							return initialArg, false
+						}
+						initial = int64(initialArg.GetNumber())
+					}
+
+					return newCounter(initial), true
+				}),
+
+				"newAtomic": vm.NewNativeFunction("newAtomic", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					var initial vm.Value
+					if len(args.Args) > 0 {
+						initial = args.Args[0]
+					}
+
+					return newAtomic(initial), true
+				}),
+
+				"shared": vm.NewNativeFunction("shared", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					valArg, ok := args.Get(0, vm.ValueTypeObject, vm.ValueTypeArray)
+					if !ok {
+						return valArg, false
+					}
+
+					return newShared(valArg), true
+				}),
+
 				"newChannel": vm.NewNativeFunction("newChannel", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
 					var buffer int
 					if len(args.Args) > 0 {
@@ -70,6 +154,9 @@ func registerFiberModule(builder *vm.RegistryBuilder) {
 							return bufferArg, false
 						}
 						buffer = int(bufferArg.GetNumber())
+						if buffer < 0 {
+							return vm.NewError("buffer must not be negative", bufferArg), false
+						}
 					}
 					val := vm.Value{}
 					val.SetChannel(make(chan vm.Value, buffer))
@@ -88,9 +175,12 @@ func registerFiberModule(builder *vm.RegistryBuilder) {
 					}
 
 					ch := chArg.GetChannel()
-					ch <- valArg
-
-					return valArg, true
+					select {
+					case ch <- valArg:
+						return valArg, true
+					case <-v.Ctx.Done():
+						return vm.NewCancelled(), false
+					}
 				}),
 
 				"close": vm.NewNativeFunction("close", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
@@ -112,10 +202,48 @@ func registerFiberModule(builder *vm.RegistryBuilder) {
 					}
 
 					ch := chArg.GetChannel()
-					val := <-ch
+					select {
+					case val := <-ch:
+						return val, true
+					case <-v.Ctx.Done():
+						return vm.NewCancelled(), false
+					}
+				}),
+
+				"select": vm.NewNativeFunction("select", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					casesArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return casesArg, false
+					}
+
+					return selectCases(v, *casesArg.GetArray())
+				}),
+
+				"after": vm.NewNativeFunction("after", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					durationArg, ok := args.Get(0, vm.ValueTypeNumber)
+					if !ok {
+						return durationArg, false
+					}
+
+					ch := make(chan vm.Value, 1)
+					time.AfterFunc(time.Duration(durationArg.GetNumber())*time.Millisecond, func() {
+						ch <- vm.NewTime(time.Now())
+					})
+
+					val := vm.Value{}
+					val.SetChannel(ch)
 					return val, true
 				}),
 
+				"cap": vm.NewNativeFunction("cap", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					chArg, ok := args.Get(0, vm.ValueTypeChannel)
+					if !ok {
+						return chArg, false
+					}
+
+					return vm.NewNumber(float64(cap(chArg.GetChannel()))), true
+				}),
+
 				"onRecv": vm.NewNativeFunction("onRecv", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
 					chArg, ok := args.Get(0, vm.ValueTypeChannel)
 					if !ok {
@@ -128,10 +256,87 @@ func registerFiberModule(builder *vm.RegistryBuilder) {
 						return fnArg, false
 					}
 
-					for val := range ch {
-						v.RunFunction(fnArg, val)
+					for {
+						select {
+						case val, ok := <-ch:
+							if !ok {
+								return vm.Value{}, true
+							}
+							v.RunFunction(fnArg, val)
+						case <-v.Ctx.Done():
+							return vm.NewCancelled(), false
+						}
+					}
+				}),
+
+				"group": vm.NewNativeFunction("group", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					limit := 0
+					if len(args.Args) > 1 {
+						optionsArg, ok := args.Get(0, vm.ValueTypeObject)
+						if !ok {
+							return optionsArg, false
+						}
+
+						if limitArg, ok := optionsArg.GetObject()["limit"]; ok {
+							limitArg, ok := vm.CheckValueType("group.limit", limitArg, vm.ValueTypeNumber)
+							if !ok {
+								return limitArg, false
+							}
+							limit = int(limitArg.GetNumber())
+						}
 					}
 
+					fnArg, ok := args.Get(len(args.Args)-1, vm.ValueTypeFunction)
+					if !ok {
+						return fnArg, false
+					}
+
+					return runTaskGroup(v, limit, fnArg)
+				}),
+
+				"spawnIsolate": vm.NewNativeFunction("spawnIsolate", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					pathArg, ok := args.Get(0, vm.ValueTypeString)
+					if !ok {
+						return pathArg, false
+					}
+
+					opts := isolateOptions{maxRestarts: defaultMaxRestarts}
+					if len(args.Args) > 1 {
+						optsArg, ok := args.Get(1, vm.ValueTypeObject)
+						if !ok {
+							return optsArg, false
+						}
+
+						var errVal vm.Value
+						opts, errVal, ok = parseIsolateOptions(optsArg)
+						if !ok {
+							return errVal, false
+						}
+					}
+
+					return spawnIsolate(v, pathArg.GetString(), opts)
+				}),
+
+				"Cancelled": vm.Cancelled,
+
+				"cancelled": vm.NewNativeFunction("cancelled", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					return vm.NewBool(v.IsCancelled()), true
+				}),
+
+				"onCancel": vm.NewNativeFunction("onCancel", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					fnArg, ok := args.Get(0, vm.ValueTypeFunction, vm.ValueTypeNativeFunction)
+					if !ok {
+						return fnArg, false
+					}
+
+					// the task context is only cancelled when the task itself is
+					// cancelled, the callback is dropped when the task ends
+					executor := v.Executor
+					stop := context.AfterFunc(v.Ctx, func() {
+						executor.Run(fnArg)
+					})
+					v.AtTaskEnd(func() { stop() })
+
 					return vm.Value{}, true
 				}),
 			},
@@ -139,8 +344,8 @@ func registerFiberModule(builder *vm.RegistryBuilder) {
 	})
 }
 
-func waitForTask(taskArg vm.Value) (vm.Value, bool) {
-	val, ok := taskArg.GetTask().Wait()
+func waitForTask(v *vm.VM, taskArg vm.Value) (vm.Value, bool) {
+	val, ok := taskArg.GetTask().WaitContext(v.Ctx)
 	if !ok {
 		return val, false
 	}
@@ -149,6 +354,212 @@ func waitForTask(taskArg vm.Value) (vm.Value, bool) {
 }
 
 func runFunc(v *vm.VM, fnArg vm.Value, args ...vm.Value) *vm.ExecutorTask {
-	task := v.Executor.Run(fnArg, args...)
+	task := v.Executor.RunContext(v.Ctx, fnArg, args...)
 	return task
 }
+
+// taskGroup runs tasks that are cancelled together when one of them fails.
+type taskGroup struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	results []vm.Value
+	errs    []vm.Value
+}
+
+var errGroupFailed = errors.New("task group failed")
+
+func runTaskGroup(v *vm.VM, limit int, fn vm.Value) (vm.Value, bool) {
+	ctx, cancel := context.WithCancelCause(v.Ctx)
+	g := &taskGroup{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if limit > 0 {
+		g.sem = make(chan struct{}, limit)
+	}
+
+	groupObj := vm.NewNativeObject(g, map[string]vm.Value{
+		"run": vm.NewNativeFunction("group.run", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			fnArg, ok := args.Get(0, vm.ValueTypeFunction)
+			if !ok {
+				return fnArg, false
+			}
+
+			return g.run(v, fnArg, args.Args[1:])
+		}),
+		"cancel": vm.NewNativeFunction("group.cancel", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			g.cancel(context.Canceled)
+			return vm.Value{}, true
+		}),
+	})
+
+	bodyVal, bodyOk := v.RunFunction(fn, groupObj)
+	if !bodyOk {
+		g.cancel(errGroupFailed)
+	}
+
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+
+	g.wg.Wait()
+	cancel(nil)
+
+	if len(g.errs) > 0 {
+		return vm.NewWrappedError("fiber.group: task failed", vm.NewArray(g.errs), g.errs[0]), false
+	}
+
+	if !bodyOk {
+		return bodyVal, false
+	}
+
+	if v.IsCancelled() {
+		return vm.NewCancelled(), false
+	}
+
+	return vm.NewArray(g.results), true
+}
+
+func (g *taskGroup) run(v *vm.VM, fn vm.Value, args []vm.Value) (vm.Value, bool) {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		case <-g.ctx.Done():
+			return vm.NewCancelled(), false
+		}
+	}
+
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		g.release()
+		return vm.NewError("fiber.group: group is closed", vm.Value{}), false
+	}
+	idx := len(g.results)
+	g.results = append(g.results, vm.Value{})
+	g.wg.Add(1)
+	g.mu.Unlock()
+
+	task := v.Executor.RunContext(g.ctx, fn, args...)
+
+	go func() {
+		defer g.wg.Done()
+
+		val, ok := task.Join()
+		g.release()
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		g.results[idx] = val
+		if !ok && val.IsError() && !vm.IsCancelledErr(val) {
+			if len(g.errs) == 0 {
+				g.cancel(errGroupFailed)
+			}
+			g.errs = append(g.errs, val)
+		}
+	}()
+
+	return vm.NewTask(task), true
+}
+
+func (g *taskGroup) release() {
+	if g.sem != nil {
+		<-g.sem
+	}
+}
+
+// selectCases waits on the cases like Go's select statement.
+// A case is {recv: ch}, {send: ch, value: x} or {default: true},
+// with an optional fn that is called with the received or sent value,
+// a nil channel never becomes ready.
+// It returns {index, value, ok} or the result of the chosen case fn.
+func selectCases(v *vm.VM, cases []vm.Value) (vm.Value, bool) {
+	selectCases := make([]reflect.SelectCase, 0, len(cases)+1)
+	hasDefault := false
+
+	for i, c := range cases {
+		c, ok := vm.CheckValueType("select", c, vm.ValueTypeObject)
+		if !ok {
+			return c, false
+		}
+
+		obj := c.GetObject()
+		sc := reflect.SelectCase{}
+
+		if recv, ok := obj["recv"]; ok {
+			sc.Dir = reflect.SelectRecv
+			if recv.VType != vm.ValueTypeNil {
+				recv, ok := vm.CheckValueType("select.recv", recv, vm.ValueTypeChannel)
+				if !ok {
+					return recv, false
+				}
+				sc.Chan = reflect.ValueOf(recv.GetChannel())
+			}
+		} else if send, ok := obj["send"]; ok {
+			sc.Dir = reflect.SelectSend
+			sc.Send = reflect.ValueOf(obj["value"])
+			if send.VType != vm.ValueTypeNil {
+				send, ok := vm.CheckValueType("select.send", send, vm.ValueTypeChannel)
+				if !ok {
+					return send, false
+				}
+				sc.Chan = reflect.ValueOf(send.GetChannel())
+			}
+		} else if def, ok := obj["default"]; ok && def.IsTruthy() {
+			if hasDefault {
+				return vm.NewError("select: multiple default cases", vm.Value{}), false
+			}
+			hasDefault = true
+			sc.Dir = reflect.SelectDefault
+		} else {
+			return vm.NewError(fmt.Sprintf("select: case %d needs recv, send or default", i), c), false
+		}
+
+		selectCases = append(selectCases, sc)
+	}
+
+	if !hasDefault {
+		selectCases = append(selectCases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(v.Ctx.Done()),
+		})
+	}
+
+	chosen, recv, recvOK := reflect.Select(selectCases)
+	if chosen == len(cases) {
+		return vm.NewCancelled(), false
+	}
+
+	var val vm.Value
+	ok := true
+	switch selectCases[chosen].Dir {
+	case reflect.SelectRecv:
+		ok = recvOK
+		if recvOK {
+			val = recv.Interface().(vm.Value)
+		}
+	case reflect.SelectSend:
+		val = cases[chosen].GetObject()["value"]
+	}
+
+	if fn, ok := cases[chosen].GetObject()["fn"]; ok {
+		fn, ok := vm.CheckValueType("select.fn", fn, vm.ValueTypeFunction)
+		if !ok {
+			return fn, false
+		}
+
+		return v.RunFunction(fn, val)
+	}
+
+	return vm.NewObject(map[string]vm.Value{
+		"index": vm.NewNumber(float64(chosen)),
+		"value": val,
+		"ok":    vm.NewBool(ok),
+	}), true
+}
@@ -0,0 +1,286 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+// isolate runs a module in its own executor, it only talks to its parent
+// through messages that are copied when they are sent.
+type isolate struct {
+	path        string
+	fn          vm.Value
+	executor    *vm.Executor
+	ctx         context.Context
+	cancel      context.CancelFunc
+	inbox       chan vm.Value
+	outbox      chan vm.Value
+	done        chan struct{}
+	restart     bool
+	maxRestarts int
+	restarts    atomic.Int64
+
+	val vm.Value
+	ok  bool
+}
+
+const defaultMaxRestarts = 5
+
+type isolateOptions struct {
+	restart     bool
+	maxRestarts int
+	buffer      int
+}
+
+func parseIsolateOptions(val vm.Value) (isolateOptions, vm.Value, bool) {
+	opts := isolateOptions{maxRestarts: defaultMaxRestarts}
+	obj := val.GetObject()
+
+	if restart, ok := obj["restart"]; ok {
+		opts.restart = restart.IsTruthy()
+	}
+
+	if maxRestarts, ok := obj["maxRestarts"]; ok {
+		maxRestarts, ok := vm.CheckValueType("spawnIsolate.maxRestarts", maxRestarts, vm.ValueTypeNumber)
+		if !ok {
+			return opts, maxRestarts, false
+		}
+		opts.maxRestarts = int(maxRestarts.GetNumber())
+	}
+
+	if buffer, ok := obj["buffer"]; ok {
+		buffer, ok := vm.CheckValueType("spawnIsolate.buffer", buffer, vm.ValueTypeNumber)
+		if !ok {
+			return opts, buffer, false
+		}
+		opts.buffer = int(buffer.GetNumber())
+		if opts.buffer < 0 {
+			return opts, vm.NewError("buffer must not be negative", buffer), false
+		}
+	}
+
+	return opts, vm.Value{}, true
+}
+
+func spawnIsolate(v *vm.VM, path string, opts isolateOptions) (vm.Value, bool) {
+	absPath := modulePath(v, path)
+	fn, err := compileModule(absPath)
+	if err != nil {
+		return vm.NewErrFromErr(err), false
+	}
+
+	ctx, cancel := context.WithCancel(v.Ctx)
+	iso := &isolate{
+		path:        path,
+		fn:          fn,
+		executor:    v.Executor.Fork(),
+		ctx:         ctx,
+		cancel:      cancel,
+		inbox:       make(chan vm.Value, opts.buffer),
+		outbox:      make(chan vm.Value, opts.buffer),
+		done:        make(chan struct{}),
+		restart:     opts.restart,
+		maxRestarts: opts.maxRestarts,
+	}
+
+	go iso.supervise()
+
+	return iso.handle(), true
+}
+
+// supervise runs the isolate and restarts it when it crashes,
+// the last result is kept for wait.
+func (iso *isolate) supervise() {
+	defer close(iso.done)
+	defer close(iso.outbox)
+	defer iso.cancel()
+
+	for {
+		iso.val, iso.ok = iso.run()
+		if iso.ok || !iso.restart || iso.ctx.Err() != nil || int(iso.restarts.Load()) >= iso.maxRestarts {
+			return
+		}
+
+		iso.restarts.Add(1)
+		iso.executor = iso.executor.Fork()
+	}
+}
+
+// run evaluates the module and calls the function it returns with the mailbox.
+func (iso *isolate) run() (vm.Value, bool) {
+	worker, ok := iso.executor.RunContext(iso.ctx, iso.fn).Join()
+	if !ok {
+		return worker, false
+	}
+
+	if worker.VType != vm.ValueTypeFunction {
+		return vm.NewError(fmt.Sprintf("isolate %s must return a function, got %s", iso.path, worker.VType), vm.Value{}), false
+	}
+
+	return iso.executor.RunContext(iso.ctx, worker, iso.mailbox()).Join()
+}
+
+// mailbox is what the isolate uses to talk to its parent.
+func (iso *isolate) mailbox() vm.Value {
+	messages := vm.Value{}
+	messages.SetChannel(iso.inbox)
+
+	return vm.NewObject(map[string]vm.Value{
+		"messages": messages,
+		"send": vm.NewNativeFunction("send", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			msgArg, ok := args.Get(0)
+			if !ok {
+				return msgArg, false
+			}
+
+			msg, ok := cloneMessage(msgArg)
+			if !ok {
+				return msg, false
+			}
+
+			select {
+			case iso.outbox <- msg:
+				return vm.Value{}, true
+			case <-v.Ctx.Done():
+				return vm.NewCancelled(), false
+			}
+		}),
+		"recv": vm.NewNativeFunction("recv", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			select {
+			case msg := <-iso.inbox:
+				return msg, true
+			case <-v.Ctx.Done():
+				return vm.NewCancelled(), false
+			}
+		}),
+	})
+}
+
+// handle is what the parent uses to talk to the isolate.
+func (iso *isolate) handle() vm.Value {
+	messages := vm.Value{}
+	messages.SetChannel(iso.outbox)
+
+	return vm.NewObject(map[string]vm.Value{
+		"messages": messages,
+		"send": vm.NewNativeFunction("send", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			msgArg, ok := args.Get(0)
+			if !ok {
+				return msgArg, false
+			}
+
+			msg, ok := cloneMessage(msgArg)
+			if !ok {
+				return msg, false
+			}
+
+			select {
+			case iso.inbox <- msg:
+				return vm.Value{}, true
+			case <-iso.done:
+				return vm.NewError(fmt.Sprintf("isolate %s exited", iso.path), vm.Value{}), false
+			case <-v.Ctx.Done():
+				return vm.NewCancelled(), false
+			}
+		}),
+		"recv": vm.NewNativeFunction("recv", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			select {
+			case msg, ok := <-iso.outbox:
+				if !ok {
+					return vm.NewError(fmt.Sprintf("isolate %s exited", iso.path), vm.Value{}), false
+				}
+				return msg, true
+			case <-v.Ctx.Done():
+				return vm.NewCancelled(), false
+			}
+		}),
+		"stop": vm.NewNativeFunction("stop", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			iso.cancel()
+			return vm.Value{}, true
+		}),
+		"restarts": vm.NewNativeFunction("restarts", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			return vm.NewNumber(float64(iso.restarts.Load())), true
+		}),
+		"wait": vm.NewNativeFunction("wait", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			select {
+			case <-iso.done:
+			case <-v.Ctx.Done():
+				return vm.NewCancelled(), false
+			}
+
+			if !iso.ok && iso.val.IsError() && !vm.IsCancelledErr(iso.val) {
+				return vm.NewWrappedError(
+					fmt.Sprintf("isolate %s exited", iso.path),
+					vm.NewObject(map[string]vm.Value{
+						"restarts": vm.NewNumber(float64(iso.restarts.Load())),
+					}),
+					iso.val,
+				), false
+			}
+
+			return cloneMessage(iso.val)
+		}),
+	})
+}
+
+// maxMessageDepth stops cloning cyclic messages.
+const maxMessageDepth = 1000
+
+// cloneMessage copies a value sent between isolates, functions and other
+// values holding state can't cross the boundary.
+func cloneMessage(val vm.Value) (vm.Value, bool) {
+	return cloneMessageDepth(val, 0)
+}
+
+func cloneMessageDepth(val vm.Value, depth int) (vm.Value, bool) {
+	if depth > maxMessageDepth {
+		return vm.NewError("message is nested too deeply or cyclic", vm.Value{}), false
+	}
+
+	switch val.VType {
+	case vm.ValueTypeNil, vm.ValueTypeNumber, vm.ValueTypeString, vm.ValueTypeBytes, vm.ValueTypeBool, vm.ValueTypeTime:
+		return val, true
+
+	case vm.ValueTypeArray:
+		arr := *val.GetArray()
+		res := make([]vm.Value, len(arr))
+		for i, v := range arr {
+			c, ok := cloneMessageDepth(v, depth+1)
+			if !ok {
+				return c, false
+			}
+			res[i] = c
+		}
+		return vm.NewArray(res), true
+
+	case vm.ValueTypeObject:
+		obj := val.GetObject()
+		res := make(map[string]vm.Value, len(obj))
+		for k, v := range obj {
+			c, ok := cloneMessageDepth(v, depth+1)
+			if !ok {
+				return c, false
+			}
+			res[k] = c
+		}
+		return vm.NewObject(res), true
+
+	case vm.ValueTypeError:
+		err := val.GetError()
+		data, ok := cloneMessageDepth(err.Data(), depth+1)
+		if !ok {
+			return data, false
+		}
+		cause, ok := cloneMessageDepth(err.Cause(), depth+1)
+		if !ok {
+			return cause, false
+		}
+		return err.Clone(data, cause), true
+
+	default:
+		return vm.NewError(fmt.Sprintf("cannot send %s to an isolate", val.VType), val), false
+	}
+}
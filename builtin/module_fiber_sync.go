@@ -0,0 +1,545 @@
+package builtin
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+// withLock runs the optional callback in args while holding the lock,
+// the lock is released even when the callback raises an error.
+func withLock(v *vm.VM, args vm.NativeFunctionArgs, lock func() (vm.Value, bool), unlock func()) (vm.Value, bool) {
+	if len(args.Args) == 0 {
+		return lock()
+	}
+
+	fnArg, ok := args.Get(0, vm.ValueTypeFunction)
+	if !ok {
+		return fnArg, false
+	}
+
+	if val, ok := lock(); !ok {
+		return val, false
+	}
+	defer unlock()
+
+	return v.RunFunction(fnArg)
+}
+
+// rwLock tracks the writer and the number of readers so an unbalanced
+// unlock raises an error instead of the fatal error sync.RWMutex throws.
+type rwLock struct {
+	l sync.RWMutex
+
+	mu      sync.Mutex
+	writer  bool
+	readers int
+}
+
+func (rw *rwLock) lock() {
+	rw.l.Lock()
+
+	rw.mu.Lock()
+	rw.writer = true
+	rw.mu.Unlock()
+}
+
+func (rw *rwLock) unlock() bool {
+	rw.mu.Lock()
+	if !rw.writer {
+		rw.mu.Unlock()
+		return false
+	}
+	rw.writer = false
+	rw.mu.Unlock()
+
+	rw.l.Unlock()
+	return true
+}
+
+func (rw *rwLock) rlock() {
+	rw.l.RLock()
+
+	rw.mu.Lock()
+	rw.readers++
+	rw.mu.Unlock()
+}
+
+func (rw *rwLock) runlock() bool {
+	rw.mu.Lock()
+	if rw.readers == 0 {
+		rw.mu.Unlock()
+		return false
+	}
+	rw.readers--
+	rw.mu.Unlock()
+
+	rw.l.RUnlock()
+	return true
+}
+
+func newRWLock() vm.Value {
+	rw := &rwLock{}
+
+	return vm.NewNativeObject(rw, map[string]vm.Value{
+		"lock": vm.NewNativeFunction("lock", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			return withLock(v, args, func() (vm.Value, bool) {
+				rw.lock()
+				return vm.Value{}, true
+			}, func() { rw.unlock() })
+		}),
+		"unlock": vm.NewNativeFunction("unlock", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			if !rw.unlock() {
+				return vm.NewError("unlock of an unlocked rwlock", vm.Value{}), false
+			}
+			return vm.Value{}, true
+		}),
+		"rlock": vm.NewNativeFunction("rlock", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			return withLock(v, args, func() (vm.Value, bool) {
+				rw.rlock()
+				return vm.Value{}, true
+			}, func() { rw.runlock() })
+		}),
+		"runlock": vm.NewNativeFunction("runlock", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			if !rw.runlock() {
+				return vm.NewError("runlock of an rwlock without readers", vm.Value{}), false
+			}
+			return vm.Value{}, true
+		}),
+	})
+}
+
+func newSemaphore(n int) vm.Value {
+	sem := make(chan struct{}, n)
+
+	acquire := func(v *vm.VM) (vm.Value, bool) {
+		select {
+		case sem <- struct{}{}:
+			return vm.Value{}, true
+		case <-v.Ctx.Done():
+			return vm.NewCancelled(), false
+		}
+	}
+
+	release := func() {
+		<-sem
+	}
+
+	return vm.NewNativeObject(sem, map[string]vm.Value{
+		"acquire": vm.NewNativeFunction("acquire", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			return withLock(v, args, func() (vm.Value, bool) { return acquire(v) }, release)
+		}),
+		"tryAcquire": vm.NewNativeFunction("tryAcquire", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			select {
+			case sem <- struct{}{}:
+				return vm.NewBool(true), true
+			default:
+				return vm.NewBool(false), true
+			}
+		}),
+		"release": vm.NewNativeFunction("release", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			select {
+			case <-sem:
+				return vm.Value{}, true
+			default:
+				return vm.NewError("semaphore released more than acquired", vm.Value{}), false
+			}
+		}),
+	})
+}
+
+// waitGroup is a sync.WaitGroup whose wait can be cancelled.
+type waitGroup struct {
+	mu    sync.Mutex
+	count int
+	done  chan struct{}
+}
+
+func (wg *waitGroup) add(n int) bool {
+	wg.mu.Lock()
+	defer wg.mu.Unlock()
+
+	if wg.count+n < 0 {
+		return false
+	}
+
+	if wg.count == 0 && n > 0 {
+		wg.done = make(chan struct{})
+	}
+
+	wg.count += n
+	if wg.count == 0 && n < 0 {
+		close(wg.done)
+	}
+
+	return true
+}
+
+func (wg *waitGroup) wait() <-chan struct{} {
+	wg.mu.Lock()
+	defer wg.mu.Unlock()
+
+	if wg.count == 0 {
+		return nil
+	}
+
+	return wg.done
+}
+
+func newWaitGroup() vm.Value {
+	wg := &waitGroup{}
+
+	add := func(n int) (vm.Value, bool) {
+		if !wg.add(n) {
+			return vm.NewError("negative wait group counter", vm.Value{}), false
+		}
+		return vm.Value{}, true
+	}
+
+	return vm.NewNativeObject(wg, map[string]vm.Value{
+		"add": vm.NewNativeFunction("add", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			n := 1
+			if len(args.Args) > 0 {
+				nArg, ok := args.Get(0, vm.ValueTypeNumber)
+				if !ok {
+					return nArg, false
+				}
+				n = int(nArg.GetNumber())
+			}
+
+			return add(n)
+		}),
+		"done": vm.NewNativeFunction("done", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			return add(-1)
+		}),
+		"run": vm.NewNativeFunction("run", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			fnArg, ok := args.Get(0, vm.ValueTypeFunction)
+			if !ok {
+				return fnArg, false
+			}
+
+			add(1)
+			task := runFunc(v, fnArg, args.Args[1:]...)
+			go func() {
+				task.Join()
+				add(-1)
+			}()
+
+			return vm.NewTask(task), true
+		}),
+		"wait": vm.NewNativeFunction("wait", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			done := wg.wait()
+			if done == nil {
+				return vm.Value{}, true
+			}
+
+			select {
+			case <-done:
+				return vm.Value{}, true
+			case <-v.Ctx.Done():
+				return vm.NewCancelled(), false
+			}
+		}),
+	})
+}
+
+// newOnce returns a function that calls fn the first time it's called,
+// later and concurrent calls get the same result or error.
+func newOnce(fn vm.Value) vm.Value {
+	var (
+		once sync.Once
+		val  vm.Value
+		ok   bool
+	)
+
+	return vm.NewNativeFunction("once", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+		once.Do(func() {
+			val, ok = v.RunFunction(fn, args.Args...)
+		})
+
+		return val, ok
+	})
+}
+
+func newCounter(initial int64) vm.Value {
+	c := &atomic.Int64{}
+	c.Store(initial)
+
+	return vm.NewNativeObject(c, map[string]vm.Value{
+		"load": vm.NewNativeFunction("load", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			return vm.NewNumber(float64(c.Load())), true
+		}),
+		"store": vm.NewNativeFunction("store", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			nArg, ok := args.Get(0, vm.ValueTypeNumber)
+			if !ok {
+				return nArg, false
+			}
+
+			c.Store(int64(nArg.GetNumber()))
+			return vm.Value{}, true
+		}),
+		"add": vm.NewNativeFunction("add", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			delta := int64(1)
+			if len(args.Args) > 0 {
+				nArg, ok := args.Get(0, vm.ValueTypeNumber)
+				if !ok {
+					return nArg, false
+				}
+				delta = int64(nArg.GetNumber())
+			}
+
+			return vm.NewNumber(float64(c.Add(delta))), true
+		}),
+		"swap": vm.NewNativeFunction("swap", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			nArg, ok := args.Get(0, vm.ValueTypeNumber)
+			if !ok {
+				return nArg, false
+			}
+
+			return vm.NewNumber(float64(c.Swap(int64(nArg.GetNumber())))), true
+		}),
+		"compareAndSwap": vm.NewNativeFunction("compareAndSwap", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			oldArg, ok := args.Get(0, vm.ValueTypeNumber)
+			if !ok {
+				return oldArg, false
+			}
+
+			newArg, ok := args.Get(1, vm.ValueTypeNumber)
+			if !ok {
+				return newArg, false
+			}
+
+			return vm.NewBool(c.CompareAndSwap(int64(oldArg.GetNumber()), int64(newArg.GetNumber()))), true
+		}),
+	})
+}
+
+// atomicValue holds any value, compareAndSwap compares with ==.
+type atomicValue struct {
+	mu  sync.Mutex
+	val vm.Value
+}
+
+func newAtomic(initial vm.Value) vm.Value {
+	a := &atomicValue{val: initial}
+
+	return vm.NewNativeObject(a, map[string]vm.Value{
+		"load": vm.NewNativeFunction("load", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			return a.val, true
+		}),
+		"store": vm.NewNativeFunction("store", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			val, ok := args.Get(0)
+			if !ok {
+				return val, false
+			}
+
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			a.val = val
+			return vm.Value{}, true
+		}),
+		"swap": vm.NewNativeFunction("swap", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			val, ok := args.Get(0)
+			if !ok {
+				return val, false
+			}
+
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			old := a.val
+			a.val = val
+			return old, true
+		}),
+		"compareAndSwap": vm.NewNativeFunction("compareAndSwap", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			oldArg, ok := args.Get(0)
+			if !ok {
+				return oldArg, false
+			}
+
+			newArg, ok := args.Get(1)
+			if !ok {
+				return newArg, false
+			}
+
+			a.mu.Lock()
+			defer a.mu.Unlock()
+
+			var eq vm.Value
+			a.val.Equal(&oldArg, &eq)
+			if !eq.GetBool() {
+				return vm.NewBool(false), true
+			}
+
+			a.val = newArg
+			return vm.NewBool(true), true
+		}),
+	})
+}
+
+// sharedValue guards the value of fiber.shared, callbacks records the VMs
+// running a read or update callback so using the same shared value from
+// inside one raises an error instead of deadlocking.
+type sharedValue struct {
+	l sync.RWMutex
+
+	mu        sync.Mutex
+	callbacks map[*vm.VM]bool
+}
+
+func (s *sharedValue) inCallback(v *vm.VM) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.callbacks[v]
+}
+
+func (s *sharedValue) setInCallback(v *vm.VM, in bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if in {
+		s.callbacks[v] = true
+	} else {
+		delete(s.callbacks, v)
+	}
+}
+
+// newShared wraps a copy of an object or array so fibers can only reach it
+// while holding its lock. Values are copied going in and out, read gets a
+// frozen copy and only update can change the value in place, a reference
+// kept from inside update escapes the lock so don't store it.
+func newShared(val vm.Value) vm.Value {
+	s := &sharedValue{callbacks: map[*vm.VM]bool{}}
+	inner := val.DeepCopy()
+
+	reentrant := vm.NewError("a shared value can't be used inside its own read or update callback", vm.Value{})
+
+	withRead := func(v *vm.VM, fn func() (vm.Value, bool)) (vm.Value, bool) {
+		if s.inCallback(v) {
+			return reentrant, false
+		}
+
+		s.l.RLock()
+		defer s.l.RUnlock()
+		return fn()
+	}
+
+	withWrite := func(v *vm.VM, fn func() (vm.Value, bool)) (vm.Value, bool) {
+		if s.inCallback(v) {
+			return reentrant, false
+		}
+
+		s.l.Lock()
+		defer s.l.Unlock()
+		return fn()
+	}
+
+	runCallback := func(v *vm.VM, fn vm.Value, arg vm.Value) (vm.Value, bool) {
+		s.setInCallback(v, true)
+		defer s.setInCallback(v, false)
+
+		res, ok := v.RunFunction(fn, arg)
+		if !ok {
+			return res, false
+		}
+		return res.DeepCopy(), true
+	}
+
+	return vm.NewNativeObject(s, map[string]vm.Value{
+		"get": vm.NewNativeFunction("get", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			idx, ok := args.Get(0, vm.ValueTypeNumber, vm.ValueTypeString)
+			if !ok {
+				return idx, false
+			}
+
+			return withRead(v, func() (vm.Value, bool) {
+				if inner.VType == vm.ValueTypeArray && idx.VType == vm.ValueTypeNumber {
+					i := int(idx.GetNumber())
+					if i < 0 || i >= len(*inner.GetArray()) {
+						return vm.NewError(vm.ErrIndexOutOfRange.Error(), idx), false
+					}
+				}
+
+				var res vm.Value
+				inner.Index(&idx, &res)
+				return res.DeepCopy(), true
+			})
+		}),
+		"set": vm.NewNativeFunction("set", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			idx, ok := args.Get(0, vm.ValueTypeNumber, vm.ValueTypeString)
+			if !ok {
+				return idx, false
+			}
+
+			val, ok := args.Get(1)
+			if !ok {
+				return val, false
+			}
+
+			return withWrite(v, func() (vm.Value, bool) {
+				if err := inner.SetIndex(&idx, val.DeepCopy()); err != nil {
+					return vm.NewErrFromErr(err), false
+				}
+				return val, true
+			})
+		}),
+		"push": vm.NewNativeFunction("push", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			val, ok := args.Get(0)
+			if !ok {
+				return val, false
+			}
+
+			return withWrite(v, func() (vm.Value, bool) {
+				if inner.VType != vm.ValueTypeArray {
+					return vm.NewError("push on a shared "+inner.VType.String(), vm.Value{}), false
+				}
+
+				arr := inner.GetArray()
+				*arr = append(*arr, val.DeepCopy())
+				return val, true
+			})
+		}),
+		"len": vm.NewNativeFunction("len", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			return withRead(v, func() (vm.Value, bool) {
+				switch inner.VType {
+				case vm.ValueTypeArray:
+					return vm.NewNumber(float64(len(*inner.GetArray()))), true
+				case vm.ValueTypeObject:
+					return vm.NewNumber(float64(len(inner.GetObject()))), true
+				default:
+					return vm.NewError("len on a shared "+inner.VType.String(), vm.Value{}), false
+				}
+			})
+		}),
+		"read": vm.NewNativeFunction("read", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			fnArg, ok := args.Get(0, vm.ValueTypeFunction)
+			if !ok {
+				return fnArg, false
+			}
+
+			return withRead(v, func() (vm.Value, bool) {
+				c := inner.DeepCopy()
+				c.Freeze()
+				return runCallback(v, fnArg, c)
+			})
+		}),
+		"update": vm.NewNativeFunction("update", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			fnArg, ok := args.Get(0, vm.ValueTypeFunction)
+			if !ok {
+				return fnArg, false
+			}
+
+			return withWrite(v, func() (vm.Value, bool) {
+				return runCallback(v, fnArg, inner)
+			})
+		}),
+		"snapshot": vm.NewNativeFunction("snapshot", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			return withRead(v, func() (vm.Value, bool) {
+				return inner.DeepCopy(), true
+			})
+		}),
+	})
+}
@@ -1,10 +1,13 @@
 package builtin
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/go-chi/chi/v5"
 
@@ -45,7 +48,7 @@ func registerHTTPModule(builder *vm.RegistryBuilder) {
 				}
 
 				// Create and make the request
-				req, err, ok := createRequest(strings.ToUpper(method.GetString()), url.GetString(), vm.NativeFunctionArgs{
+				req, err, ok := createRequest(v.Ctx, strings.ToUpper(method.GetString()), url.GetString(), vm.NativeFunctionArgs{
 					Args: []vm.Value{optionsArg},
 					Name: "request",
 				})
@@ -90,7 +93,7 @@ func registerHTTPModule(builder *vm.RegistryBuilder) {
 					return urlArg, false
 				}
 
-				req, err, ok := createRequest(strings.ToUpper(method), urlArg.GetString(), args)
+				req, err, ok := createRequest(v.Ctx, strings.ToUpper(method), urlArg.GetString(), args)
 				if !ok {
 					return err, false
 				}
@@ -103,10 +106,10 @@ func registerHTTPModule(builder *vm.RegistryBuilder) {
 	})
 }
 
-func createRequest(method string, url string, args vm.NativeFunctionArgs) (*http.Request, vm.Value, bool) {
+func createRequest(ctx context.Context, method string, url string, args vm.NativeFunctionArgs) (*http.Request, vm.Value, bool) {
 	var err error
 
-	req, err := http.NewRequest(method, url, nil)
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		return nil, vm.NewErrFromErr(err), false
 	}
@@ -123,12 +126,16 @@ func createRequest(method string, url string, args vm.NativeFunctionArgs) (*http
 	options := optionsArg.GetObject()
 
 	if body, ok := options["body"]; ok {
-		stringifiedBody, ok := stringify(body)
-		if !ok {
-			return nil, stringifiedBody, false
-		}
+		if body.VType == vm.ValueTypeBytes {
+			req.Body = io.NopCloser(bytes.NewReader(body.GetBytes()))
+		} else {
+			stringifiedBody, ok := stringify(body)
+			if !ok {
+				return nil, stringifiedBody, false
+			}
 
-		req.Body = io.NopCloser(strings.NewReader(stringifiedBody.GetString()))
+			req.Body = io.NopCloser(strings.NewReader(stringifiedBody.GetString()))
+		}
 	}
 
 	headers, ok := options["headers"]
@@ -150,6 +157,9 @@ func makeRequest(req *http.Request) (vm.Value, bool) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
+		if req.Context().Err() != nil {
+			return vm.NewCancelled(), false
+		}
 		return vm.NewError(err.Error(), vm.Value{}), false
 	}
 	defer resp.Body.Close()
@@ -173,6 +183,7 @@ func createResponseObject(resp *http.Response, body []byte) (vm.Value, bool) {
 		"status":     vm.NewString(resp.Status),
 		"headers":    vm.NewObject(headers),
 		"body":       vm.NewString(string(body)),
+		"bodyBytes":  vm.NewBytes(body),
 	})
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		return obj, true
@@ -265,7 +276,7 @@ func runHandler(v *vm.VM, handlerArg vm.Value, req *http.Request, w http.Respons
 		status:  http.StatusOK,
 	}
 
-	task := runFunc(v, handlerArg, makeRequestObject(req), makeResponseObject(&response))
+	task := v.Executor.RunContext(req.Context(), handlerArg, makeRequestObject(req), makeResponseObject(&response))
 	val, _ := task.Wait()
 	if val.IsError() {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -287,6 +298,12 @@ func runHandler(v *vm.VM, handlerArg vm.Value, req *http.Request, w http.Respons
 		}
 		w.WriteHeader(response.status)
 		w.Write([]byte(str.String()))
+	case vm.ValueTypeBytes:
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		w.WriteHeader(response.status)
+		w.Write(val.GetBytes())
 	default:
 		if w.Header().Get("Content-Type") == "" {
 			w.Header().Set("Content-Type", "text/plain")
@@ -297,6 +314,19 @@ func runHandler(v *vm.VM, handlerArg vm.Value, req *http.Request, w http.Respons
 }
 
 func makeRequestObject(req *http.Request) vm.Value {
+	// the body can only be read once, so it's cached for getBody and getBodyBytes
+	var (
+		bodyOnce sync.Once
+		body     []byte
+		bodyErr  error
+	)
+	readBody := func() ([]byte, error) {
+		bodyOnce.Do(func() {
+			body, bodyErr = io.ReadAll(req.Body)
+		})
+		return body, bodyErr
+	}
+
 	return vm.NewObject(map[string]vm.Value{
 		"method": vm.NewString(req.Method),
 		"url":    vm.NewString(req.URL.String()),
@@ -325,6 +355,22 @@ func makeRequestObject(req *http.Request) vm.Value {
 
 			return vm.NewString(chi.URLParam(req, keyArg.GetString())), true
 		}),
+		"getBody": vm.NewNativeFunction("getBody", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			body, err := readBody()
+			if err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+
+			return vm.NewString(string(body)), true
+		}),
+		"getBodyBytes": vm.NewNativeFunction("getBodyBytes", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			body, err := readBody()
+			if err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+
+			return vm.NewBytes(body), true
+		}),
 	})
 }
 
@@ -46,17 +46,31 @@ func registerIOModule(builder *vm.RegistryBuilder) {
 
 					return vm.NewString(string(file)), true
 				}),
+				"readBytes": vm.NewNativeFunction("readBytes", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					pathArg, ok := args.Get(0, vm.ValueTypeString)
+					if !ok {
+						return pathArg, false
+					}
+
+					data, err := os.ReadFile(pathArg.GetString())
+					if err != nil {
+						return vm.NewError(err.Error(), vm.Value{}), false
+					}
+
+					return vm.NewBytes(data), true
+				}),
+				"open": vm.NewNativeFunction("open", ioOpen),
 				"writeFile": vm.NewNativeFunction("writeFile", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
 					pathArg, ok := args.Get(0, vm.ValueTypeString)
 					if !ok {
 						return pathArg, false
 					}
-					contentArg, ok := args.Get(1, vm.ValueTypeString)
+					content, errVal, ok := bytesArg(args, 1)
 					if !ok {
-						return contentArg, false
+						return errVal, false
 					}
 
-					err := os.WriteFile(pathArg.GetString(), []byte(contentArg.GetString()), 0644)
+					err := os.WriteFile(pathArg.GetString(), content, 0644)
 					if err != nil {
 						return vm.NewError(err.Error(), vm.Value{}), false
 					}
@@ -210,8 +224,11 @@ func registerIOModule(builder *vm.RegistryBuilder) {
 						return v.String()
 					})
 
-					cmd := exec.Command(cmdArg.GetString(), cmdArgs...)
+					cmd := exec.CommandContext(v.Ctx, cmdArg.GetString(), cmdArgs...)
 					output, err := cmd.CombinedOutput()
+					if v.IsCancelled() {
+						return vm.NewCancelled(), false
+					}
 					if err != nil {
 						return vm.NewError(err.Error(), vm.NewString(string(output))), false
 					}
@@ -0,0 +1,131 @@
+package builtin
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+var fileModes = map[string]int{
+	"r":  os.O_RDONLY,
+	"w":  os.O_WRONLY | os.O_CREATE | os.O_TRUNC,
+	"a":  os.O_WRONLY | os.O_CREATE | os.O_APPEND,
+	"r+": os.O_RDWR,
+	"w+": os.O_RDWR | os.O_CREATE | os.O_TRUNC,
+	"a+": os.O_RDWR | os.O_CREATE | os.O_APPEND,
+}
+
+// ioOpen opens a file with a mode like "r", "w" or "a", the handle wraps
+// an *os.File so modules that stream, like json.decoder, can use it directly.
+func ioOpen(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	pathArg, ok := args.Get(0, vm.ValueTypeString)
+	if !ok {
+		return pathArg, false
+	}
+
+	mode := "r"
+	if args.Len() > 1 {
+		modeArg, ok := args.Get(1, vm.ValueTypeString)
+		if !ok {
+			return modeArg, false
+		}
+		mode = modeArg.GetString()
+	}
+
+	flag, ok := fileModes[mode]
+	if !ok {
+		return vm.NewError("unknown file mode, expected r, w, a, r+, w+ or a+", vm.NewString(mode)), false
+	}
+
+	f, err := os.OpenFile(pathArg.GetString(), flag, 0644)
+	if err != nil {
+		return vm.NewError(err.Error(), vm.Value{}), false
+	}
+
+	return newFile(f), true
+}
+
+func newFile(f *os.File) vm.Value {
+	return vm.NewNativeObject(f, map[string]vm.Value{
+		"path": vm.NewString(f.Name()),
+
+		// read reads up to n bytes, or the rest of the file without n,
+		// it returns nil at the end of the file.
+		"read": vm.NewNativeFunction("read", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			data, errVal, ok := fileRead(f, args)
+			if !ok || data == nil {
+				return errVal, ok
+			}
+
+			return vm.NewString(string(data)), true
+		}),
+
+		// readBytes is like read but returns bytes
+		"readBytes": vm.NewNativeFunction("readBytes", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			data, errVal, ok := fileRead(f, args)
+			if !ok || data == nil {
+				return errVal, ok
+			}
+
+			return vm.NewBytes(data), true
+		}),
+
+		// write writes strings and bytes
+		"write": vm.NewNativeFunction("write", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			for i := range args.Len() {
+				data, errVal, ok := bytesArg(args, i)
+				if !ok {
+					return errVal, false
+				}
+
+				if _, err := f.Write(data); err != nil {
+					return vm.NewError(err.Error(), vm.Value{}), false
+				}
+			}
+
+			return vm.Value{}, true
+		}),
+
+		"close": vm.NewNativeFunction("close", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			if err := f.Close(); err != nil {
+				return vm.NewError(err.Error(), vm.Value{}), false
+			}
+
+			return vm.Value{}, true
+		}),
+	})
+}
+
+// fileRead reads n bytes, or everything without n, the data is nil at the
+// end of the file.
+func fileRead(f io.Reader, args vm.NativeFunctionArgs) ([]byte, vm.Value, bool) {
+	if args.Len() == 0 {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, vm.NewError(err.Error(), vm.Value{}), false
+		}
+		if len(data) == 0 {
+			return nil, vm.Value{}, true
+		}
+
+		return data, vm.Value{}, true
+	}
+
+	nArg, ok := args.Get(0, vm.ValueTypeNumber)
+	if !ok {
+		return nil, nArg, false
+	}
+
+	buf := make([]byte, int(nArg.GetNumber()))
+	n, err := f.Read(buf)
+	if errors.Is(err, io.EOF) {
+		return nil, vm.Value{}, true
+	}
+	if err != nil {
+		return nil, vm.NewError(err.Error(), vm.Value{}), false
+	}
+
+	return buf[:n], vm.Value{}, true
+}
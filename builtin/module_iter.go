@@ -0,0 +1,428 @@
+package builtin
+
+import (
+	"iter"
+	"slices"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+// iterArg reads an iterable argument, anything a for (x in expr) loop accepts.
+func iterArg(args vm.NativeFunctionArgs, i int) (vm.IterFunc, vm.Value, bool) {
+	val, ok := args.Get(i)
+	if !ok {
+		return nil, val, false
+	}
+
+	src, ok := iterSource(val)
+	if !ok {
+		return nil, vm.NewError("value is not iterable", val), false
+	}
+
+	return src, vm.Value{}, true
+}
+
+// iterCall runs a callback from inside a lazy iterator, v is the VM
+// consuming the iterator.
+func iterCall(v *vm.VM, fn vm.Value, args ...vm.Value) vm.Value {
+	res, ok := v.RunFunction(fn, args...)
+	if !ok {
+		raiseIterError(res)
+	}
+
+	return res
+}
+
+// iterSizeArg reads a positive size argument, used by take, skip, chunk and window.
+func iterSizeArg(args vm.NativeFunctionArgs, i int, allowZero bool) (int, vm.Value, bool) {
+	nArg, ok := args.Get(i, vm.ValueTypeNumber)
+	if !ok {
+		return 0, nArg, false
+	}
+
+	n := int(nArg.GetNumber())
+	if n < 0 || (n == 0 && !allowZero) {
+		return 0, vm.NewError("[iter."+args.Name+"]: invalid size", nArg), false
+	}
+
+	return n, vm.Value{}, true
+}
+
+// iterFunc registers a combinator taking an iterable and a callback.
+func iterFunc(name string, fn func(v *vm.VM, seq iter.Seq[vm.Value], cb vm.Value) iter.Seq[vm.Value]) vm.Value {
+	return vm.NewNativeFunction(name, func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+		src, errVal, ok := iterArg(args, 0)
+		if !ok {
+			return errVal, false
+		}
+
+		cb, ok := args.Get(1, vm.ValueTypeFunction)
+		if !ok {
+			return cb, false
+		}
+
+		return vm.NewIterFunc(func(v *vm.VM) iter.Seq[vm.Value] {
+			return fn(v, src(v), cb)
+		}), true
+	})
+}
+
+func registerIterModule(builder *vm.RegistryBuilder) {
+	builder.RegisterModule("iter", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				// range(stop) or range(start, stop, [step]), stop is exclusive.
+				"range": vm.NewNativeFunction("range", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					bounds := []float64{0, 0, 1}
+					switch args.Len() {
+					case 1:
+						stopArg, ok := args.Get(0, vm.ValueTypeNumber)
+						if !ok {
+							return stopArg, false
+						}
+						bounds[1] = stopArg.GetNumber()
+					case 2, 3:
+						for i := range args.Len() {
+							arg, ok := args.Get(i, vm.ValueTypeNumber)
+							if !ok {
+								return arg, false
+							}
+							bounds[i] = arg.GetNumber()
+						}
+					default:
+						return vm.NewError("invalid number of arguments", vm.Value{}), false
+					}
+
+					start, stop, step := bounds[0], bounds[1], bounds[2]
+					if step == 0 {
+						return vm.NewError("[iter.range]: step must not be zero", vm.Value{}), false
+					}
+
+					return vm.NewIter(func(yield func(vm.Value) bool) {
+						for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+							if !yield(vm.NewNumber(i)) {
+								return
+							}
+						}
+					}), true
+				}),
+
+				"from": vm.NewNativeFunction("from", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					src, errVal, ok := iterArg(args, 0)
+					if !ok {
+						return errVal, false
+					}
+
+					return vm.NewIterFunc(src), true
+				}),
+
+				"map": iterFunc("map", func(v *vm.VM, seq iter.Seq[vm.Value], fn vm.Value) iter.Seq[vm.Value] {
+					return func(yield func(vm.Value) bool) {
+						for val := range seq {
+							if !yield(iterCall(v, fn, val)) {
+								return
+							}
+						}
+					}
+				}),
+
+				"filter": iterFunc("filter", func(v *vm.VM, seq iter.Seq[vm.Value], fn vm.Value) iter.Seq[vm.Value] {
+					return func(yield func(vm.Value) bool) {
+						for val := range seq {
+							keep := iterCall(v, fn, val)
+							if keep.IsTruthy() && !yield(val) {
+								return
+							}
+						}
+					}
+				}),
+
+				"takeWhile": iterFunc("takeWhile", func(v *vm.VM, seq iter.Seq[vm.Value], fn vm.Value) iter.Seq[vm.Value] {
+					return func(yield func(vm.Value) bool) {
+						for val := range seq {
+							keep := iterCall(v, fn, val)
+							if !keep.IsTruthy() || !yield(val) {
+								return
+							}
+						}
+					}
+				}),
+
+				"take": vm.NewNativeFunction("take", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					src, errVal, ok := iterArg(args, 0)
+					if !ok {
+						return errVal, false
+					}
+
+					n, errVal, ok := iterSizeArg(args, 1, true)
+					if !ok {
+						return errVal, false
+					}
+
+					return vm.NewIterFunc(func(v *vm.VM) iter.Seq[vm.Value] {
+						return func(yield func(vm.Value) bool) {
+							if n == 0 {
+								return
+							}
+
+							i := 0
+							for val := range src(v) {
+								i++
+								if !yield(val) || i == n {
+									return
+								}
+							}
+						}
+					}), true
+				}),
+
+				"skip": vm.NewNativeFunction("skip", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					src, errVal, ok := iterArg(args, 0)
+					if !ok {
+						return errVal, false
+					}
+
+					n, errVal, ok := iterSizeArg(args, 1, true)
+					if !ok {
+						return errVal, false
+					}
+
+					return vm.NewIterFunc(func(v *vm.VM) iter.Seq[vm.Value] {
+						return func(yield func(vm.Value) bool) {
+							i := 0
+							for val := range src(v) {
+								i++
+								if i > n && !yield(val) {
+									return
+								}
+							}
+						}
+					}), true
+				}),
+
+				"enumerate": vm.NewNativeFunction("enumerate", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					src, errVal, ok := iterArg(args, 0)
+					if !ok {
+						return errVal, false
+					}
+
+					return vm.NewIterFunc(func(v *vm.VM) iter.Seq[vm.Value] {
+						return func(yield func(vm.Value) bool) {
+							i := 0
+							for val := range src(v) {
+								if !yield(vm.NewArray([]vm.Value{vm.NewNumber(float64(i)), val})) {
+									return
+								}
+								i++
+							}
+						}
+					}), true
+				}),
+
+				"zip": vm.NewNativeFunction("zip", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					srcs := make([]vm.IterFunc, args.Len())
+					for i := range args.Len() {
+						src, errVal, ok := iterArg(args, i)
+						if !ok {
+							return errVal, false
+						}
+						srcs[i] = src
+					}
+
+					return vm.NewIterFunc(func(v *vm.VM) iter.Seq[vm.Value] {
+						seqs := make([]iter.Seq[vm.Value], len(srcs))
+						for i, src := range srcs {
+							seqs[i] = src(v)
+						}
+
+						return func(yield func(vm.Value) bool) {
+							if len(seqs) == 0 {
+								return
+							}
+
+							nexts := make([]func() (vm.Value, bool), len(seqs))
+							for i, seq := range seqs {
+								next, stop := iter.Pull(seq)
+								defer stop()
+								nexts[i] = next
+							}
+
+							for {
+								tuple := make([]vm.Value, len(nexts))
+								for i, next := range nexts {
+									val, ok := next()
+									if !ok {
+										return
+									}
+									tuple[i] = val
+								}
+
+								if !yield(vm.NewArray(tuple)) {
+									return
+								}
+							}
+						}
+					}), true
+				}),
+
+				"chain": vm.NewNativeFunction("chain", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					srcs := make([]vm.IterFunc, args.Len())
+					for i := range args.Len() {
+						src, errVal, ok := iterArg(args, i)
+						if !ok {
+							return errVal, false
+						}
+						srcs[i] = src
+					}
+
+					return vm.NewIterFunc(func(v *vm.VM) iter.Seq[vm.Value] {
+						seqs := make([]iter.Seq[vm.Value], len(srcs))
+						for i, src := range srcs {
+							seqs[i] = src(v)
+						}
+
+						return func(yield func(vm.Value) bool) {
+							for _, seq := range seqs {
+								for val := range seq {
+									if !yield(val) {
+										return
+									}
+								}
+							}
+						}
+					}), true
+				}),
+
+				"chunk": vm.NewNativeFunction("chunk", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					src, errVal, ok := iterArg(args, 0)
+					if !ok {
+						return errVal, false
+					}
+
+					n, errVal, ok := iterSizeArg(args, 1, false)
+					if !ok {
+						return errVal, false
+					}
+
+					return vm.NewIterFunc(func(v *vm.VM) iter.Seq[vm.Value] {
+						return func(yield func(vm.Value) bool) {
+							chunk := make([]vm.Value, 0, n)
+							for val := range src(v) {
+								chunk = append(chunk, val)
+								if len(chunk) == n {
+									if !yield(vm.NewArray(chunk)) {
+										return
+									}
+									chunk = make([]vm.Value, 0, n)
+								}
+							}
+
+							if len(chunk) > 0 {
+								yield(vm.NewArray(chunk))
+							}
+						}
+					}), true
+				}),
+
+				"window": vm.NewNativeFunction("window", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					src, errVal, ok := iterArg(args, 0)
+					if !ok {
+						return errVal, false
+					}
+
+					n, errVal, ok := iterSizeArg(args, 1, false)
+					if !ok {
+						return errVal, false
+					}
+
+					return vm.NewIterFunc(func(v *vm.VM) iter.Seq[vm.Value] {
+						return func(yield func(vm.Value) bool) {
+							window := make([]vm.Value, 0, n)
+							for val := range src(v) {
+								if len(window) == n {
+									window = window[1:]
+								}
+								window = append(window, val)
+
+								if len(window) == n && !yield(vm.NewArray(slices.Clone(window))) {
+									return
+								}
+							}
+						}
+					}), true
+				}),
+
+				"collect": vm.NewNativeFunction("collect", func(v *vm.VM, args vm.NativeFunctionArgs) (res vm.Value, ok bool) {
+					defer catchIterError(&res, &ok)
+
+					src, errVal, ok := iterArg(args, 0)
+					if !ok {
+						return errVal, false
+					}
+
+					result := []vm.Value{}
+					for val := range src(v) {
+						result = append(result, val)
+					}
+
+					return vm.NewArray(result), true
+				}),
+
+				"reduce": vm.NewNativeFunction("reduce", func(v *vm.VM, args vm.NativeFunctionArgs) (res vm.Value, ok bool) {
+					defer catchIterError(&res, &ok)
+
+					src, errVal, ok := iterArg(args, 0)
+					if !ok {
+						return errVal, false
+					}
+
+					fnArg, ok := args.Get(1, vm.ValueTypeFunction)
+					if !ok {
+						return fnArg, false
+					}
+
+					var acc vm.Value
+					hasAcc := args.Len() > 2
+					if hasAcc {
+						acc, _ = args.Get(2)
+					}
+
+					for val := range src(v) {
+						if !hasAcc {
+							acc, hasAcc = val, true
+							continue
+						}
+
+						acc = iterCall(v, fnArg, acc, val)
+					}
+
+					if !hasAcc {
+						return vm.NewError("reduce of empty iterator with no initial value", vm.Value{}), false
+					}
+
+					return acc, true
+				}),
+
+				"forEach": vm.NewNativeFunction("forEach", func(v *vm.VM, args vm.NativeFunctionArgs) (res vm.Value, ok bool) {
+					defer catchIterError(&res, &ok)
+
+					src, errVal, ok := iterArg(args, 0)
+					if !ok {
+						return errVal, false
+					}
+
+					fnArg, ok := args.Get(1, vm.ValueTypeFunction)
+					if !ok {
+						return fnArg, false
+					}
+
+					for val := range src(v) {
+						iterCall(v, fnArg, val)
+					}
+
+					return vm.Value{}, true
+				}),
+			},
+		)
+	})
+}
@@ -1,7 +1,18 @@
 package builtin
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joetifa2003/weaver/vm"
 )
@@ -10,51 +21,524 @@ func registerJSONModule(builder *vm.RegistryBuilder) {
 	builder.RegisterModule("json", func() vm.Value {
 		return vm.NewObject(
 			map[string]vm.Value{
+				// parse(data, [reviver | {reviver, exact}]), objects keep the key
+				// order of the document.
 				"parse": vm.NewNativeFunction("parse", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
 					dataArg, ok := args.Get(0, vm.ValueTypeString)
 					if !ok {
 						return dataArg, false
 					}
 
-					data := dataArg.String()
-					var result interface{}
-					err := json.Unmarshal([]byte(data), &result)
-					if err != nil {
-						return vm.NewError(err.Error(), vm.Value{}), false
+					opts, errVal, ok := parseJSONOptions(args, 1)
+					if !ok {
+						return errVal, false
+					}
+
+					val, errVal, ok := decodeJSON(dataArg.GetString(), opts.exact)
+					if !ok {
+						return errVal, false
+					}
+
+					if opts.reviver.VType != vm.ValueTypeNil {
+						return reviveJSON(v, opts.reviver, vm.NewString(""), val)
 					}
 
-					return valufiyJSON(result), true
+					return val, true
 				}),
+
+				// stringify(value, {indent, sortKeys}), with sortKeys false parsed
+				// objects keep their key order, others are still sorted.
 				"stringify": vm.NewNativeFunction("stringify", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
 					dataArg, ok := args.Get(0)
 					if !ok {
 						return dataArg, false
 					}
 
-					res, ok := stringify(dataArg)
+					enc := jsonEncoder{sortKeys: true, visiting: map[any]bool{}}
+					if args.Len() > 1 {
+						optsArg, ok := args.Get(1, vm.ValueTypeObject)
+						if !ok {
+							return optsArg, false
+						}
+
+						opts := optsArg.GetObject()
+						if indent, ok := opts["indent"]; ok {
+							switch indent.VType {
+							case vm.ValueTypeNumber:
+								enc.indent = strings.Repeat(" ", max(int(indent.GetNumber()), 0))
+							case vm.ValueTypeString:
+								enc.indent = indent.GetString()
+							default:
+								return vm.NewError("json.stringify: indent must be a number or a string", indent), false
+							}
+						}
+						if sortKeys, ok := opts["sortKeys"]; ok {
+							enc.sortKeys = sortKeys.IsTruthy()
+						}
+					}
+
+					if err := enc.encode(dataArg, 0); err != nil {
+						return vm.NewErrFromErr(err), false
+					}
+
+					return vm.NewString(enc.buf.String()), true
+				}),
+
+				// decoder(source, {array, exact}) iterates the values of a string or reader,
+				// one after another like NDJSON or, with array, the items of a top level array.
+				"decoder": vm.NewNativeFunction("decoder", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					src, ok := args.Get(0, vm.ValueTypeString, vm.ValueTypeNativeObject)
 					if !ok {
-						return res, false
+						return src, false
 					}
 
-					return res, true
+					var r io.Reader
+					if src.VType == vm.ValueTypeString {
+						r = strings.NewReader(src.GetString())
+					} else if reader, ok := src.GetNativeObject().Obj.(io.Reader); ok {
+						r = reader
+					} else {
+						return vm.NewError("json.decoder: expected a string or a reader", src), false
+					}
+
+					opts, errVal, ok := parseJSONOptions(args, 1)
+					if !ok {
+						return errVal, false
+					}
+
+					return vm.NewIter(decodeJSONStream(r, opts)), true
 				}),
 			},
 		)
 	})
 }
 
-func stringify(v vm.Value) (vm.Value, bool) {
-	val := goifyValue(v)
-	b, err := json.Marshal(val)
+type jsonOptions struct {
+	reviver vm.Value
+	// exact keeps integers that don't fit in a float64 as strings.
+	exact bool
+	// array streams the items of a top level array.
+	array bool
+}
+
+func parseJSONOptions(args vm.NativeFunctionArgs, i int) (jsonOptions, vm.Value, bool) {
+	var opts jsonOptions
+	if args.Len() <= i {
+		return opts, vm.Value{}, true
+	}
+
+	optsArg, ok := args.Get(i, vm.ValueTypeFunction, vm.ValueTypeObject)
+	if !ok {
+		return opts, optsArg, false
+	}
+
+	if optsArg.VType == vm.ValueTypeFunction {
+		opts.reviver = optsArg
+		return opts, vm.Value{}, true
+	}
+
+	m := optsArg.GetObject()
+	if reviver, ok := m["reviver"]; ok {
+		if errVal, ok := vm.CheckValueType("json", reviver, vm.ValueTypeFunction); !ok {
+			return opts, errVal, false
+		}
+		opts.reviver = reviver
+	}
+	exact, array := m["exact"], m["array"]
+	opts.exact = exact.IsTruthy()
+	opts.array = array.IsTruthy()
+
+	return opts, vm.Value{}, true
+}
+
+// decodeJSON decodes a single JSON document, trailing data is an error.
+func decodeJSON(data string, exact bool) (vm.Value, vm.Value, bool) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+
+	result, err := decodeJSONValue(dec, exact, 0)
+	if err != nil {
+		return vm.Value{}, jsonError(err, data, dec.InputOffset()), false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return vm.Value{}, jsonError(errors.New("invalid character after top-level value"), data, dec.InputOffset()), false
+	}
+
+	return result, vm.Value{}, true
+}
+
+// maxJSONDepth is how deeply arrays and objects can be nested.
+const maxJSONDepth = 10000
+
+// decodeJSONValue reads the next value of dec, objects keep the key order
+// of the input. io.EOF is only returned when there's no value left.
+func decodeJSONValue(dec *json.Decoder, exact bool, depth int) (vm.Value, error) {
+	tok, err := dec.Token()
 	if err != nil {
-		return vm.NewError(err.Error(), vm.Value{}), false
+		return vm.Value{}, err
+	}
+
+	val, err := decodeJSONToken(dec, tok, exact, depth)
+	if err == io.EOF {
+		return val, io.ErrUnexpectedEOF
 	}
 
-	return vm.NewString(string(b)), true
+	return val, err
 }
 
-func valufiyJSON(v interface{}) vm.Value {
+func decodeJSONToken(dec *json.Decoder, tok json.Token, exact bool, depth int) (vm.Value, error) {
+	switch tok := tok.(type) {
+	case json.Delim:
+		if depth >= maxJSONDepth {
+			return vm.Value{}, errors.New("exceeded max depth")
+		}
+
+		if tok == '[' {
+			arr := []vm.Value{}
+			for dec.More() {
+				item, err := decodeJSONValue(dec, exact, depth+1)
+				if err != nil {
+					return vm.Value{}, err
+				}
+				arr = append(arr, item)
+			}
+			if _, err := dec.Token(); err != nil {
+				return vm.Value{}, err
+			}
+			return vm.NewArray(arr), nil
+		}
+
+		m := map[string]vm.Value{}
+		keys := []string{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return vm.Value{}, err
+			}
+			item, err := decodeJSONValue(dec, exact, depth+1)
+			if err != nil {
+				return vm.Value{}, err
+			}
+			k := key.(string)
+			if _, ok := m[k]; !ok {
+				keys = append(keys, k)
+			}
+			m[k] = item
+		}
+		if _, err := dec.Token(); err != nil {
+			return vm.Value{}, err
+		}
+		return vm.NewOrderedObject(m, keys), nil
+
+	case json.Number:
+		return jsonNumber(tok, exact), nil
+
+	default:
+		return valufiyValue(tok), nil
+	}
+}
+
+// jsonNumber converts a decoded number, with exact integers that
+// would lose precision as a number are kept as strings.
+func jsonNumber(n json.Number, exact bool) vm.Value {
+	f, _ := n.Float64()
+	if exact && !strings.ContainsAny(n.String(), ".eE") {
+		if i, err := n.Int64(); err != nil || int64(f) != i {
+			return vm.NewString(n.String())
+		}
+	}
+	return vm.NewNumber(f)
+}
+
+// jsonErrorOffset returns the offset a decoding error happened at,
+// end is used when the input ended too early.
+func jsonErrorOffset(err error, offset int64, end int64) (error, int64) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		// the offset is right after the invalid character
+		return err, max(syntaxErr.Offset-1, 0)
+	case errors.As(err, &typeErr):
+		return err, typeErr.Offset
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return errors.New("unexpected end of JSON input"), end
+	default:
+		return err, offset
+	}
+}
+
+func newJSONError(err error, offset int64, line int, column int) vm.Value {
+	return vm.NewError(
+		fmt.Sprintf("json: %s at line %d, column %d", err, line, column),
+		vm.NewObject(map[string]vm.Value{
+			"line":   vm.NewNumber(float64(line)),
+			"column": vm.NewNumber(float64(column)),
+			"offset": vm.NewNumber(float64(offset)),
+		}),
+	)
+}
+
+// jsonError reports where in data a decoding error happened.
+func jsonError(err error, data string, offset int64) vm.Value {
+	err, offset = jsonErrorOffset(err, offset, int64(len(data)))
+	offset = min(offset, int64(len(data)))
+
+	before := data[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := int(offset) - strings.LastIndexByte(before, '\n')
+
+	return newJSONError(err, offset, line, column)
+}
+
+// jsonPosition tracks lines of a stream for error positions, it only keeps
+// the input the decoder hasn't consumed yet.
+type jsonPosition struct {
+	r io.Reader
+	// buf holds the input starting at offset base
+	buf  []byte
+	base int64
+	// line and lineStart are the line number and its offset at base
+	line      int
+	lineStart int64
+}
+
+func (p *jsonPosition) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.buf = append(p.buf, b[:n]...)
+	return n, err
+}
+
+func (p *jsonPosition) end() int64 {
+	return p.base + int64(len(p.buf))
+}
+
+// consume forgets the input before offset.
+func (p *jsonPosition) consume(offset int64) {
+	n := int(offset - p.base)
+	for i, c := range p.buf[:n] {
+		if c == '\n' {
+			p.line++
+			p.lineStart = p.base + int64(i) + 1
+		}
+	}
+
+	p.buf = append(p.buf[:0], p.buf[n:]...)
+	p.base = offset
+}
+
+func (p *jsonPosition) error(err error, offset int64) vm.Value {
+	err, offset = jsonErrorOffset(err, offset, p.end())
+	offset = max(min(offset, p.end()), p.base)
+	p.consume(offset)
+
+	return newJSONError(err, offset, p.line+1, int(offset-p.lineStart)+1)
+}
+
+// reviveJSON calls reviver(key, value) bottom up like JavaScript's JSON.parse,
+// the result replaces the value.
+func reviveJSON(v *vm.VM, reviver vm.Value, key vm.Value, val vm.Value) (vm.Value, bool) {
+	switch val.VType {
+	case vm.ValueTypeObject:
+		m := val.GetObject()
+		for _, k := range val.ObjectKeys() {
+			revived, ok := reviveJSON(v, reviver, vm.NewString(k), m[k])
+			if !ok {
+				return revived, false
+			}
+			m[k] = revived
+		}
+
+	case vm.ValueTypeArray:
+		arr := *val.GetArray()
+		for i, item := range arr {
+			revived, ok := reviveJSON(v, reviver, vm.NewNumber(float64(i)), item)
+			if !ok {
+				return revived, false
+			}
+			arr[i] = revived
+		}
+	}
+
+	return v.RunFunction(reviver, key, val)
+}
+
+func decodeJSONStream(r io.Reader, opts jsonOptions) func(yield func(vm.Value) bool) {
+	return func(yield func(vm.Value) bool) {
+		pos := &jsonPosition{r: r}
+		dec := json.NewDecoder(pos)
+		dec.UseNumber()
+
+		fail := func(err error) {
+			raiseIterError(pos.error(err, dec.InputOffset()))
+		}
+
+		if opts.array {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				fail(err)
+			}
+			if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+				fail(errors.New("expected a top level array"))
+			}
+		}
+
+		for !opts.array || dec.More() {
+			item, err := decodeJSONValue(dec, opts.exact, 0)
+			if err == io.EOF && !opts.array {
+				return
+			}
+			if err != nil {
+				fail(err)
+			}
+
+			pos.consume(dec.InputOffset())
+			if !yield(item) {
+				return
+			}
+		}
+
+		if _, err := dec.Token(); err != nil {
+			fail(err)
+		}
+	}
+}
+
+type jsonEncoder struct {
+	buf      bytes.Buffer
+	indent   string
+	sortKeys bool
+	visiting map[any]bool
+}
+
+func (e *jsonEncoder) newline(level int) {
+	if e.indent == "" {
+		return
+	}
+
+	e.buf.WriteByte('\n')
+	e.buf.WriteString(strings.Repeat(e.indent, level))
+}
+
+func (e *jsonEncoder) writeString(s string) {
+	// unlike json.Marshal, <, > and & are kept as they are
+	enc := json.NewEncoder(&e.buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	e.buf.Truncate(e.buf.Len() - 1)
+}
+
+func (e *jsonEncoder) enter(ptr any) error {
+	if e.visiting[ptr] {
+		return errors.New("json: cannot stringify a cyclic value")
+	}
+
+	e.visiting[ptr] = true
+	return nil
+}
+
+func (e *jsonEncoder) encode(v vm.Value, level int) error {
+	switch v.VType {
+	case vm.ValueTypeString:
+		e.writeString(v.GetString())
+
+	case vm.ValueTypeBool:
+		e.buf.WriteString(strconv.FormatBool(v.GetBool()))
+
+	case vm.ValueTypeNumber:
+		n := v.GetNumber()
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return fmt.Errorf("json: unsupported number %v", n)
+		}
+
+		b, _ := json.Marshal(n)
+		e.buf.Write(b)
+
+	case vm.ValueTypeTime:
+		e.writeString(v.GetTime().Format(time.RFC3339Nano))
+
+	case vm.ValueTypeBytes:
+		e.writeString(base64.StdEncoding.EncodeToString(v.GetBytes()))
+
+	case vm.ValueTypeArray:
+		arr := v.GetArray()
+		if err := e.enter(arr); err != nil {
+			return err
+		}
+		defer delete(e.visiting, arr)
+
+		e.buf.WriteByte('[')
+		for i, item := range *arr {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.newline(level + 1)
+			if err := e.encode(item, level+1); err != nil {
+				return err
+			}
+		}
+		if len(*arr) > 0 {
+			e.newline(level)
+		}
+		e.buf.WriteByte(']')
+
+	case vm.ValueTypeObject:
+		m := v.GetObject()
+		ptr := reflect.ValueOf(m).UnsafePointer()
+		if err := e.enter(ptr); err != nil {
+			return err
+		}
+		defer delete(e.visiting, ptr)
+
+		keys := v.ObjectKeys()
+		if e.sortKeys {
+			slices.Sort(keys)
+		}
+
+		e.buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.newline(level + 1)
+			e.writeString(k)
+			e.buf.WriteByte(':')
+			if e.indent != "" {
+				e.buf.WriteByte(' ')
+			}
+			if err := e.encode(m[k], level+1); err != nil {
+				return err
+			}
+		}
+		if len(keys) > 0 {
+			e.newline(level)
+		}
+		e.buf.WriteByte('}')
+
+	default:
+		e.buf.WriteString("null")
+	}
+
+	return nil
+}
+
+func stringify(v vm.Value) (vm.Value, bool) {
+	enc := jsonEncoder{sortKeys: true, visiting: map[any]bool{}}
+	if err := enc.encode(v, 0); err != nil {
+		return vm.NewErrFromErr(err), false
+	}
+
+	return vm.NewString(enc.buf.String()), true
+}
+
+// valufiyValue converts decoded JSON, YAML and TOML values.
+func valufiyValue(v any) vm.Value {
 	switch v := v.(type) {
+	case nil:
+		return vm.Value{}
 	case string:
 		return vm.NewString(v)
 	case bool:
@@ -67,54 +551,103 @@ func valufiyJSON(v interface{}) vm.Value {
 		return vm.NewNumber(float64(v))
 	case int32:
 		return vm.NewNumber(float64(v))
+	case int64:
+		return vm.NewNumber(float64(v))
+	case uint64:
+		return vm.NewNumber(float64(v))
 	case float64:
 		return vm.NewNumber(v)
 	case float32:
 		return vm.NewNumber(float64(v))
-	case map[string]interface{}:
-		m := make(map[string]vm.Value)
+	case time.Time:
+		return vm.NewTime(v)
+	case map[string]any:
+		m := make(map[string]vm.Value, len(v))
 		for k, v := range v {
-			m[k] = valufiyJSON(v)
+			m[k] = valufiyValue(v)
 		}
 		return vm.NewObject(m)
-	case []interface{}:
+	case []any:
 		a := make([]vm.Value, len(v))
 		for i, v := range v {
-			a[i] = valufiyJSON(v)
+			a[i] = valufiyValue(v)
+		}
+		return vm.NewArray(a)
+	case []map[string]any:
+		a := make([]vm.Value, len(v))
+		for i, v := range v {
+			a[i] = valufiyValue(v)
 		}
 		return vm.NewArray(a)
 	default:
-		panic("valuify json: unsupported type")
+		panic(fmt.Sprintf("valuify: unsupported type %T", v))
 	}
 }
 
-func goifyValue(v vm.Value) interface{} {
+// goifyValue converts a value to plain Go values for encoders like YAML and
+// TOML, integral numbers become integers so they aren't written as floats
+// and cyclic values are an error.
+func goifyValue(v vm.Value) (any, error) {
+	return goifyValueVisiting(v, map[any]bool{})
+}
+
+func goifyValueVisiting(v vm.Value, visiting map[any]bool) (any, error) {
 	switch v.VType {
+	case vm.ValueTypeNil:
+		return nil, nil
 	case vm.ValueTypeString:
-		return v.GetString()
-
+		return v.GetString(), nil
 	case vm.ValueTypeBool:
-		return v.GetBool()
-
+		return v.GetBool(), nil
 	case vm.ValueTypeNumber:
-		return v.GetNumber()
-
-	case vm.ValueTypeObject:
-		m := make(map[string]interface{})
-		for k, v := range v.GetObject() {
-			m[k] = goifyValue(v)
+		n := v.GetNumber()
+		if n == math.Trunc(n) && math.Abs(n) < 1<<63 {
+			return int64(n), nil
 		}
-		return m
+		return n, nil
+	case vm.ValueTypeTime:
+		return v.GetTime(), nil
+	case vm.ValueTypeBytes:
+		return v.GetBytes(), nil
 
 	case vm.ValueTypeArray:
-		a := make([]interface{}, len(*v.GetArray()))
-		for i, v := range *v.GetArray() {
-			a[i] = goifyValue(v)
+		arr := v.GetArray()
+		if visiting[arr] {
+			return nil, errors.New("cannot encode a cyclic value")
+		}
+		visiting[arr] = true
+		defer delete(visiting, arr)
+
+		result := make([]any, len(*arr))
+		for i, item := range *arr {
+			goItem, err := goifyValueVisiting(item, visiting)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = goItem
 		}
+		return result, nil
 
-		return a
+	case vm.ValueTypeObject:
+		m := v.GetObject()
+		ptr := reflect.ValueOf(m).UnsafePointer()
+		if visiting[ptr] {
+			return nil, errors.New("cannot encode a cyclic value")
+		}
+		visiting[ptr] = true
+		defer delete(visiting, ptr)
+
+		result := make(map[string]any, len(m))
+		for k, item := range m {
+			goItem, err := goifyValueVisiting(item, visiting)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = goItem
+		}
+		return result, nil
 
 	default:
-		return nil
+		return nil, fmt.Errorf("cannot encode a value of type %s", v.VType)
 	}
 }
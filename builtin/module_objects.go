@@ -0,0 +1,357 @@
+package builtin
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+// objectFields returns the fields of an object, or the method table of a
+// native object, which can be inspected but not modified.
+func objectFields(val vm.Value) map[string]vm.Value {
+	if val.VType == vm.ValueTypeNativeObject {
+		return val.GetNativeObject().Methods
+	}
+
+	return val.GetObject()
+}
+
+func objectKeys(m map[string]vm.Value) []string {
+	return slices.Sorted(maps.Keys(m))
+}
+
+// objectKeyList reads the keys argument of pick and omit.
+func objectKeyList(name string, val vm.Value) ([]string, vm.Value, bool) {
+	keys := []string{}
+	for _, k := range *val.GetArray() {
+		if errVal, ok := vm.CheckValueType(name, k, vm.ValueTypeString); !ok {
+			return nil, errVal, false
+		}
+
+		keys = append(keys, k.GetString())
+	}
+
+	return keys, vm.Value{}, true
+}
+
+func deepMerge(dst, src map[string]vm.Value) {
+	for k, val := range src {
+		cur, ok := dst[k]
+		if ok && cur.VType == vm.ValueTypeObject && val.VType == vm.ValueTypeObject {
+			merged := maps.Clone(cur.GetObject())
+			deepMerge(merged, val.GetObject())
+			dst[k] = vm.NewObject(merged)
+			continue
+		}
+
+		dst[k] = val
+	}
+}
+
+// objectPath walks a dotted path through objects, native objects and arrays.
+func objectPath(val vm.Value, path string) (vm.Value, bool) {
+	for _, part := range strings.Split(path, ".") {
+		switch val.VType {
+		case vm.ValueTypeObject, vm.ValueTypeNativeObject:
+			next, ok := objectFields(val)[part]
+			if !ok {
+				return vm.Value{}, false
+			}
+			val = next
+
+		case vm.ValueTypeArray:
+			idx, err := strconv.Atoi(part)
+			arr := *val.GetArray()
+			if err != nil || idx < 0 || idx >= len(arr) {
+				return vm.Value{}, false
+			}
+			val = arr[idx]
+
+		default:
+			return vm.Value{}, false
+		}
+	}
+
+	return val, true
+}
+
+func registerObjectsModule(builder *vm.RegistryBuilder) {
+	builder.RegisterModule("objects", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				"keys": vm.NewNativeFunction("keys", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject, vm.ValueTypeNativeObject)
+					if !ok {
+						return objArg, false
+					}
+
+					keys := objectKeys(objectFields(objArg))
+					result := make([]vm.Value, len(keys))
+					for i, k := range keys {
+						result[i] = vm.NewString(k)
+					}
+
+					return vm.NewArray(result), true
+				}),
+
+				"values": vm.NewNativeFunction("values", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject, vm.ValueTypeNativeObject)
+					if !ok {
+						return objArg, false
+					}
+
+					m := objectFields(objArg)
+					result := []vm.Value{}
+					for _, k := range objectKeys(m) {
+						result = append(result, m[k])
+					}
+
+					return vm.NewArray(result), true
+				}),
+
+				"entries": vm.NewNativeFunction("entries", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject, vm.ValueTypeNativeObject)
+					if !ok {
+						return objArg, false
+					}
+
+					m := objectFields(objArg)
+					result := []vm.Value{}
+					for _, k := range objectKeys(m) {
+						result = append(result, vm.NewArray([]vm.Value{vm.NewString(k), m[k]}))
+					}
+
+					return vm.NewArray(result), true
+				}),
+
+				"fromEntries": vm.NewNativeFunction("fromEntries", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					arrArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return arrArg, false
+					}
+
+					m := map[string]vm.Value{}
+					for i, entry := range *arrArg.GetArray() {
+						if entry.VType != vm.ValueTypeArray || len(*entry.GetArray()) != 2 {
+							return vm.NewError(fmt.Sprintf("fromEntries: entry %d must be a [key, value] pair", i), entry), false
+						}
+
+						pair := *entry.GetArray()
+						if errVal, ok := vm.CheckValueType("fromEntries", pair[0], vm.ValueTypeString); !ok {
+							return errVal, false
+						}
+
+						m[pair[0].GetString()] = pair[1]
+					}
+
+					return vm.NewObject(m), true
+				}),
+
+				"has": vm.NewNativeFunction("has", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject, vm.ValueTypeNativeObject)
+					if !ok {
+						return objArg, false
+					}
+
+					keyArg, ok := args.Get(1, vm.ValueTypeString)
+					if !ok {
+						return keyArg, false
+					}
+
+					_, has := objectFields(objArg)[keyArg.GetString()]
+					return vm.NewBool(has), true
+				}),
+
+				"delete": vm.NewNativeFunction("delete", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject)
+					if !ok {
+						return objArg, false
+					}
+
+					keyArg, ok := args.Get(1, vm.ValueTypeString)
+					if !ok {
+						return keyArg, false
+					}
+
+					m := objArg.GetObject()
+					key := keyArg.GetString()
+					_, has := m[key]
+					if errVal, ok := v.Mutate(objArg, func() {
+						delete(m, key)
+					}); !ok {
+						return errVal, false
+					}
+
+					return vm.NewBool(has), true
+				}),
+
+				"merge": vm.NewNativeFunction("merge", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					m := map[string]vm.Value{}
+					for i := range args.Len() {
+						objArg, ok := args.Get(i, vm.ValueTypeObject)
+						if !ok {
+							return objArg, false
+						}
+
+						maps.Copy(m, objArg.GetObject())
+					}
+
+					return vm.NewObject(m), true
+				}),
+
+				"deepMerge": vm.NewNativeFunction("deepMerge", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					m := map[string]vm.Value{}
+					for i := range args.Len() {
+						objArg, ok := args.Get(i, vm.ValueTypeObject)
+						if !ok {
+							return objArg, false
+						}
+
+						deepMerge(m, objArg.GetObject())
+					}
+
+					return vm.NewObject(m), true
+				}),
+
+				"clone": vm.NewNativeFunction("clone", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject)
+					if !ok {
+						return objArg, false
+					}
+
+					return vm.NewObject(maps.Clone(objArg.GetObject())), true
+				}),
+
+				"deepClone": vm.NewNativeFunction("deepClone", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject)
+					if !ok {
+						return objArg, false
+					}
+
+					return objArg.DeepCopy(), true
+				}),
+
+				"pick": vm.NewNativeFunction("pick", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject, vm.ValueTypeNativeObject)
+					if !ok {
+						return objArg, false
+					}
+
+					keysArg, ok := args.Get(1, vm.ValueTypeArray)
+					if !ok {
+						return keysArg, false
+					}
+
+					keys, errVal, ok := objectKeyList("pick", keysArg)
+					if !ok {
+						return errVal, false
+					}
+
+					src := objectFields(objArg)
+					m := map[string]vm.Value{}
+					for _, k := range keys {
+						if val, ok := src[k]; ok {
+							m[k] = val
+						}
+					}
+
+					return vm.NewObject(m), true
+				}),
+
+				"omit": vm.NewNativeFunction("omit", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject, vm.ValueTypeNativeObject)
+					if !ok {
+						return objArg, false
+					}
+
+					keysArg, ok := args.Get(1, vm.ValueTypeArray)
+					if !ok {
+						return keysArg, false
+					}
+
+					keys, errVal, ok := objectKeyList("omit", keysArg)
+					if !ok {
+						return errVal, false
+					}
+
+					m := maps.Clone(objectFields(objArg))
+					for _, k := range keys {
+						delete(m, k)
+					}
+
+					return vm.NewObject(m), true
+				}),
+
+				"mapValues": vm.NewNativeFunction("mapValues", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject)
+					if !ok {
+						return objArg, false
+					}
+
+					fnArg, ok := args.Get(1, vm.ValueTypeFunction)
+					if !ok {
+						return fnArg, false
+					}
+
+					src := objArg.GetObject()
+					m := make(map[string]vm.Value, len(src))
+					for _, k := range objectKeys(src) {
+						mapped, ok := v.RunFunction(fnArg, src[k], vm.NewString(k))
+						if !ok {
+							return mapped, false
+						}
+
+						m[k] = mapped
+					}
+
+					return vm.NewObject(m), true
+				}),
+
+				"freeze": vm.NewNativeFunction("freeze", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject)
+					if !ok {
+						return objArg, false
+					}
+
+					objArg.Freeze()
+					return objArg, true
+				}),
+
+				"isFrozen": vm.NewNativeFunction("isFrozen", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject)
+					if !ok {
+						return objArg, false
+					}
+
+					return vm.NewBool(objArg.IsFrozen()), true
+				}),
+
+				"get": vm.NewNativeFunction("get", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject, vm.ValueTypeNativeObject, vm.ValueTypeArray)
+					if !ok {
+						return objArg, false
+					}
+
+					pathArg, ok := args.Get(1, vm.ValueTypeString)
+					if !ok {
+						return pathArg, false
+					}
+
+					if val, ok := objectPath(objArg, pathArg.GetString()); ok {
+						return val, true
+					}
+
+					if args.Len() > 2 {
+						return args.Get(2)
+					}
+
+					return vm.Value{}, true
+				}),
+			},
+		)
+	})
+}
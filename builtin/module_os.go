@@ -0,0 +1,213 @@
+package builtin
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+// osSignals are the signals onSignal can handle, they exist on every
+// platform weaver builds for.
+var osSignals = map[string]os.Signal{
+	"SIGINT":  os.Interrupt,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGQUIT": syscall.SIGQUIT,
+}
+
+// osOnSignal runs fn with the signal name every time the process gets the
+// signal, instead of the default behaviour of exiting. Handlers run one at
+// a time, the returned function stops handling the signal.
+func osOnSignal(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	nameArg, ok := args.Get(0, vm.ValueTypeString)
+	if !ok {
+		return nameArg, false
+	}
+
+	sig, ok := osSignals[nameArg.GetString()]
+	if !ok {
+		return vm.NewError("unknown signal, expected SIGINT, SIGTERM, SIGHUP or SIGQUIT", nameArg), false
+	}
+
+	fnArg, ok := args.Get(1, vm.ValueTypeFunction, vm.ValueTypeNativeFunction)
+	if !ok {
+		return fnArg, false
+	}
+
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sig)
+
+	executor := v.Executor
+	go func() {
+		for {
+			select {
+			case <-ch:
+				val, _ := executor.Run(fnArg, nameArg).Wait()
+				if val.IsError() {
+					fmt.Fprintln(os.Stderr, val.String())
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var stopOnce sync.Once
+	return vm.NewNativeFunction("stop", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+		stopOnce.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+
+		return vm.Value{}, true
+	}), true
+}
+
+func registerOSModule(builder *vm.RegistryBuilder) {
+	builder.RegisterModule("os", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				"env": vm.NewObject(map[string]vm.Value{
+					// get(name, default?) returns default, or nil, when name isn't set
+					"get": vm.NewNativeFunction("get", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						nameArg, ok := args.Get(0, vm.ValueTypeString)
+						if !ok {
+							return nameArg, false
+						}
+
+						if val, ok := os.LookupEnv(nameArg.GetString()); ok {
+							return vm.NewString(val), true
+						}
+
+						if args.Len() > 1 {
+							return args.Args[1], true
+						}
+
+						return vm.Value{}, true
+					}),
+
+					"set": vm.NewNativeFunction("set", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						nameArg, ok := args.Get(0, vm.ValueTypeString)
+						if !ok {
+							return nameArg, false
+						}
+
+						valArg, ok := args.Get(1, vm.ValueTypeString)
+						if !ok {
+							return valArg, false
+						}
+
+						if err := os.Setenv(nameArg.GetString(), valArg.GetString()); err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						return vm.Value{}, true
+					}),
+
+					"unset": vm.NewNativeFunction("unset", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						nameArg, ok := args.Get(0, vm.ValueTypeString)
+						if !ok {
+							return nameArg, false
+						}
+
+						if err := os.Unsetenv(nameArg.GetString()); err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+
+						return vm.Value{}, true
+					}),
+
+					"all": vm.NewNativeFunction("all", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						env := map[string]vm.Value{}
+						for _, kv := range os.Environ() {
+							k, val, _ := strings.Cut(kv, "=")
+							env[k] = vm.NewString(val)
+						}
+
+						return vm.NewObject(env), true
+					}),
+				}),
+
+				// args returns the arguments after the script, weaver run file.wvr -- a b
+				// gives ["a", "b"]
+				"args": vm.NewNativeFunction("args", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					res := []vm.Value{}
+					for _, arg := range v.Executor.Args() {
+						res = append(res, vm.NewString(arg))
+					}
+
+					return vm.NewArray(res), true
+				}),
+
+				// exit(code = 0) exits the process through the executor's exit
+				// handler, without one, or when the handler returns, it raises
+				// an "exit status N" error with the code as data so the script stops.
+				"exit": vm.NewNativeFunction("exit", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					code := 0
+					if args.Len() > 0 {
+						codeArg, ok := args.Get(0, vm.ValueTypeNumber)
+						if !ok {
+							return codeArg, false
+						}
+
+						n := codeArg.GetNumber()
+						if n != float64(int(n)) {
+							return vm.NewError("exit code must be an integer", codeArg), false
+						}
+						code = int(n)
+					}
+
+					v.Executor.Exit(code)
+
+					return vm.NewError(fmt.Sprintf("exit status %d", code), vm.NewNumber(float64(code))), false
+				}),
+
+				"pid":      vm.NewNumber(float64(os.Getpid())),
+				"platform": vm.NewString(runtime.GOOS),
+				"arch":     vm.NewString(runtime.GOARCH),
+
+				"hostname": vm.NewNativeFunction("hostname", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					name, err := os.Hostname()
+					if err != nil {
+						return vm.NewErrFromErr(err), false
+					}
+
+					return vm.NewString(name), true
+				}),
+
+				"cwd": vm.NewNativeFunction("cwd", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					dir, err := os.Getwd()
+					if err != nil {
+						return vm.NewErrFromErr(err), false
+					}
+
+					return vm.NewString(dir), true
+				}),
+
+				// chdir changes the working directory of the whole process,
+				// every fiber sees the change.
+				"chdir": vm.NewNativeFunction("chdir", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					dirArg, ok := args.Get(0, vm.ValueTypeString)
+					if !ok {
+						return dirArg, false
+					}
+
+					if err := os.Chdir(dirArg.GetString()); err != nil {
+						return vm.NewErrFromErr(err), false
+					}
+
+					return vm.Value{}, true
+				}),
+
+				"onSignal": vm.NewNativeFunction("onSignal", osOnSignal),
+			},
+		)
+	})
+}
@@ -1,6 +1,7 @@
 package builtin
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -81,16 +82,18 @@ func registerPluginModule(r *vm.RegistryBuilder) {
 						if idx < 0 || int(idx) >= len(pCtx.args.Args) {
 							return -1
 						}
-						str := pCtx.args.Args[idx].GetString()
-						bytes := []byte(str)
+						data, ok := pluginValueBytes(pCtx.args.Args[idx])
+						if !ok {
+							return -1
+						}
 
-						copyLen := int32(len(bytes))
+						copyLen := int32(len(data))
 						if copyLen > maxLen {
 							copyLen = maxLen
 						}
 
-						m.Memory().Write(uint32(ptr), bytes[:copyLen])
-						return int32(len(bytes)) // Return the full length so caller knows if it was truncated
+						m.Memory().Write(uint32(ptr), data[:copyLen])
+						return int32(len(data)) // Return the full length so caller knows if it was truncated
 					}).Export("get_arg_str").
 					NewFunctionBuilder().
 					WithFunc(func(ctx context.Context, m api.Module, val float64) {
@@ -145,6 +148,15 @@ func registerPluginModule(r *vm.RegistryBuilder) {
 						return -1
 					}).Export("value_new_string").
 					NewFunctionBuilder().
+					WithFunc(func(ctx context.Context, m api.Module, ptr int32, length int32) int32 {
+						pCtx := ctx.Value(pluginCallContextKey{}).(*pluginCallContext)
+						if data, ok := m.Memory().Read(uint32(ptr), uint32(length)); ok {
+							// Read returns a view of the guest memory, so it's copied
+							return pCtx.addHandle(vm.NewBytes(bytes.Clone(data)))
+						}
+						return -1
+					}).Export("value_new_bytes").
+					NewFunctionBuilder().
 					WithFunc(func(ctx context.Context, m api.Module) int32 {
 						pCtx := ctx.Value(pluginCallContextKey{}).(*pluginCallContext)
 						return pCtx.addHandle(vm.NewObject(map[string]vm.Value{}))
@@ -160,7 +172,7 @@ func registerPluginModule(r *vm.RegistryBuilder) {
 						pCtx := ctx.Value(pluginCallContextKey{}).(*pluginCallContext)
 						obj := pCtx.getHandle(objHandle)
 						val := pCtx.getHandle(valHandle)
-						if obj == nil || val == nil {
+						if obj == nil || val == nil || obj.IsFrozen() {
 							return
 						}
 						keyBytes, ok := m.Memory().Read(uint32(keyPtr), uint32(keyLen))
@@ -174,7 +186,7 @@ func registerPluginModule(r *vm.RegistryBuilder) {
 						pCtx := ctx.Value(pluginCallContextKey{}).(*pluginCallContext)
 						arr := pCtx.getHandle(arrHandle)
 						val := pCtx.getHandle(valHandle)
-						if arr == nil || val == nil {
+						if arr == nil || val == nil || arr.IsFrozen() {
 							return
 						}
 						arrSlice := arr.GetArray()
@@ -208,24 +220,9 @@ func registerPluginModule(r *vm.RegistryBuilder) {
 						return v.GetNumber()
 					}).Export("value_get_number").
 					NewFunctionBuilder().
-					WithFunc(func(ctx context.Context, m api.Module, handle int32, ptr int32, maxLen int32) int32 {
-						pCtx := ctx.Value(pluginCallContextKey{}).(*pluginCallContext)
-						v := pCtx.getHandle(handle)
-						if v == nil {
-							return -1
-						}
-						str := v.GetString()
-						bytes := []byte(str)
-						if ptr == 0 && maxLen == 0 {
-							return int32(len(bytes))
-						}
-						copyLen := int32(len(bytes))
-						if copyLen > maxLen {
-							copyLen = maxLen
-						}
-						m.Memory().Write(uint32(ptr), bytes[:copyLen])
-						return int32(len(bytes))
-					}).Export("value_get_string").
+					WithFunc(pluginValueGetBytes).Export("value_get_string").
+					NewFunctionBuilder().
+					WithFunc(pluginValueGetBytes).Export("value_get_bytes").
 					NewFunctionBuilder().
 					WithFunc(func(ctx context.Context, m api.Module, handle int32) int32 {
 						pCtx := ctx.Value(pluginCallContextKey{}).(*pluginCallContext)
@@ -357,3 +354,39 @@ func registerPluginModule(r *vm.RegistryBuilder) {
 		})
 	})
 }
+
+// pluginValueGetBytes copies a string or bytes value into guest memory and
+// returns its full length, a zero ptr and maxLen only ask for the length.
+func pluginValueGetBytes(ctx context.Context, m api.Module, handle int32, ptr int32, maxLen int32) int32 {
+	pCtx := ctx.Value(pluginCallContextKey{}).(*pluginCallContext)
+	v := pCtx.getHandle(handle)
+	if v == nil {
+		return -1
+	}
+	data, ok := pluginValueBytes(*v)
+	if !ok {
+		return -1
+	}
+	if ptr == 0 && maxLen == 0 {
+		return int32(len(data))
+	}
+	copyLen := int32(len(data))
+	if copyLen > maxLen {
+		copyLen = maxLen
+	}
+	m.Memory().Write(uint32(ptr), data[:copyLen])
+	return int32(len(data))
+}
+
+// pluginValueBytes returns the contents of a string or bytes value,
+// both are passed to plugins as raw memory.
+func pluginValueBytes(v vm.Value) ([]byte, bool) {
+	switch v.VType {
+	case vm.ValueTypeString:
+		return []byte(v.GetString()), true
+	case vm.ValueTypeBytes:
+		return v.GetBytes(), true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,342 @@
+package builtin
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+// regexCacheSize caps regexCache, regex(...) match cases use literal
+// patterns but __regexMatch can be called with any string.
+const regexCacheSize = 256
+
+// regexCache holds the compiled patterns of __regexMatch, when it's full an
+// arbitrary pattern is evicted.
+var regexCache = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: map[string]*regexp.Regexp{}}
+
+func compileCachedRegex(pattern string) (*regexp.Regexp, error) {
+	regexCache.Lock()
+	re, ok := regexCache.m[pattern]
+	regexCache.Unlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	regexCache.Lock()
+	defer regexCache.Unlock()
+
+	if len(regexCache.m) >= regexCacheSize {
+		for k := range regexCache.m {
+			delete(regexCache.m, k)
+			break
+		}
+	}
+	regexCache.m[pattern] = re
+
+	return re, nil
+}
+
+func regexArg(args vm.NativeFunctionArgs, i int, compile func(string) (*regexp.Regexp, error)) (*regexp.Regexp, vm.Value, bool) {
+	patternArg, ok := args.Get(i, vm.ValueTypeString)
+	if !ok {
+		return nil, patternArg, false
+	}
+
+	re, err := compile(patternArg.GetString())
+	if err != nil {
+		return nil, vm.NewError(err.Error(), patternArg), false
+	}
+
+	return re, vm.Value{}, true
+}
+
+// regexCaptures returns the full match followed by every group,
+// groups that didn't participate in the match are nil.
+func regexCaptures(s string, loc []int) vm.Value {
+	captures := make([]vm.Value, len(loc)/2)
+	for i := range captures {
+		if loc[2*i] >= 0 {
+			captures[i] = vm.NewString(s[loc[2*i]:loc[2*i+1]])
+		}
+	}
+
+	return vm.NewArray(captures)
+}
+
+func regexGroups(re *regexp.Regexp, s string, loc []int) vm.Value {
+	groups := map[string]vm.Value{}
+	for i, name := range re.SubexpNames() {
+		if i == 0 || name == "" {
+			continue
+		}
+
+		var val vm.Value
+		if loc[2*i] >= 0 {
+			val = vm.NewString(s[loc[2*i]:loc[2*i+1]])
+		}
+		groups[name] = val
+	}
+
+	return vm.NewObject(groups)
+}
+
+// regexLimit reads the optional count argument of findAll and split,
+// a negative count means no limit like in Go's regexp.
+func regexLimit(args vm.NativeFunctionArgs, i int) (int, vm.Value, bool) {
+	if args.Len() <= i {
+		return -1, vm.Value{}, true
+	}
+
+	nArg, ok := args.Get(i, vm.ValueTypeNumber)
+	if !ok {
+		return 0, nArg, false
+	}
+
+	return int(nArg.GetNumber()), vm.Value{}, true
+}
+
+func newRegex(re *regexp.Regexp) vm.Value {
+	return vm.NewNativeObject(re, map[string]vm.Value{
+		"pattern": vm.NewString(re.String()),
+
+		"test": vm.NewNativeFunction("test", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			strArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return strArg, false
+			}
+
+			return vm.NewBool(re.MatchString(strArg.GetString())), true
+		}),
+
+		"find": vm.NewNativeFunction("find", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			strArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return strArg, false
+			}
+
+			s := strArg.GetString()
+			loc := re.FindStringIndex(s)
+			if loc == nil {
+				return vm.Value{}, true
+			}
+
+			return vm.NewString(s[loc[0]:loc[1]]), true
+		}),
+
+		"findAll": vm.NewNativeFunction("findAll", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			strArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return strArg, false
+			}
+
+			n, errVal, ok := regexLimit(args, 1)
+			if !ok {
+				return errVal, false
+			}
+
+			result := []vm.Value{}
+			for _, m := range re.FindAllString(strArg.GetString(), n) {
+				result = append(result, vm.NewString(m))
+			}
+
+			return vm.NewArray(result), true
+		}),
+
+		"captures": vm.NewNativeFunction("captures", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			strArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return strArg, false
+			}
+
+			s := strArg.GetString()
+			loc := re.FindStringSubmatchIndex(s)
+			if loc == nil {
+				return vm.Value{}, true
+			}
+
+			return regexCaptures(s, loc), true
+		}),
+
+		"capturesAll": vm.NewNativeFunction("capturesAll", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			strArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return strArg, false
+			}
+
+			n, errVal, ok := regexLimit(args, 1)
+			if !ok {
+				return errVal, false
+			}
+
+			s := strArg.GetString()
+			result := []vm.Value{}
+			for _, loc := range re.FindAllStringSubmatchIndex(s, n) {
+				result = append(result, regexCaptures(s, loc))
+			}
+
+			return vm.NewArray(result), true
+		}),
+
+		"groups": vm.NewNativeFunction("groups", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			strArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return strArg, false
+			}
+
+			s := strArg.GetString()
+			loc := re.FindStringSubmatchIndex(s)
+			if loc == nil {
+				return vm.Value{}, true
+			}
+
+			return regexGroups(re, s, loc), true
+		}),
+
+		// replace takes a replacement string, which can use $1 and ${name},
+		// or a function called with the match and its captures.
+		"replace": vm.NewNativeFunction("replace", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			strArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return strArg, false
+			}
+
+			replArg, ok := args.Get(1, vm.ValueTypeString, vm.ValueTypeFunction)
+			if !ok {
+				return replArg, false
+			}
+
+			s := strArg.GetString()
+			if replArg.VType == vm.ValueTypeString {
+				return vm.NewString(re.ReplaceAllString(s, replArg.GetString())), true
+			}
+
+			var errVal vm.Value
+			failed := false
+			result := []byte{}
+			last := 0
+			for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+				r, ok := v.RunFunction(replArg, vm.NewString(s[loc[0]:loc[1]]), regexCaptures(s, loc))
+				if !ok {
+					errVal, failed = r, true
+					break
+				}
+
+				if errVal, ok = vm.CheckValueType("replace", r, vm.ValueTypeString); !ok {
+					failed = true
+					break
+				}
+
+				result = append(result, s[last:loc[0]]...)
+				result = append(result, r.GetString()...)
+				last = loc[1]
+			}
+			if failed {
+				return errVal, false
+			}
+			result = append(result, s[last:]...)
+
+			return vm.NewString(string(result)), true
+		}),
+
+		"split": vm.NewNativeFunction("split", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			strArg, ok := args.Get(0, vm.ValueTypeString)
+			if !ok {
+				return strArg, false
+			}
+
+			n, errVal, ok := regexLimit(args, 1)
+			if !ok {
+				return errVal, false
+			}
+
+			result := []vm.Value{}
+			for _, part := range re.Split(strArg.GetString(), n) {
+				result = append(result, vm.NewString(part))
+			}
+
+			return vm.NewArray(result), true
+		}),
+	})
+}
+
+func registerRegexModule(builder *vm.RegistryBuilder) {
+	compile := func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+		re, errVal, ok := regexArg(args, 0, regexp.Compile)
+		if !ok {
+			return errVal, false
+		}
+
+		return newRegex(re), true
+	}
+
+	// __regexMatch is what regex(...) match cases compile to, it returns nil
+	// when s doesn't match, otherwise the captures or the named groups.
+	builder.RegisterFunc("__regexMatch", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+		re, errVal, ok := regexArg(args, 0, compileCachedRegex)
+		if !ok {
+			return errVal, false
+		}
+
+		strArg, ok := args.Get(1, vm.ValueTypeString)
+		if !ok {
+			return strArg, false
+		}
+
+		namedArg, ok := args.Get(2, vm.ValueTypeBool)
+		if !ok {
+			return namedArg, false
+		}
+
+		s := strArg.GetString()
+		loc := re.FindStringSubmatchIndex(s)
+		if loc == nil {
+			return vm.Value{}, true
+		}
+
+		if namedArg.GetBool() {
+			return regexGroups(re, s, loc), true
+		}
+
+		return regexCaptures(s, loc), true
+	})
+
+	builder.RegisterModule("regex", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				"compile": vm.NewNativeFunction("compile", compile),
+
+				"test": vm.NewNativeFunction("test", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					re, errVal, ok := regexArg(args, 0, regexp.Compile)
+					if !ok {
+						return errVal, false
+					}
+
+					strArg, ok := args.Get(1, vm.ValueTypeString)
+					if !ok {
+						return strArg, false
+					}
+
+					return vm.NewBool(re.MatchString(strArg.GetString())), true
+				}),
+
+				"quote": vm.NewNativeFunction("quote", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					strArg, ok := args.Get(0, vm.ValueTypeString)
+					if !ok {
+						return strArg, false
+					}
+
+					return vm.NewString(regexp.QuoteMeta(strArg.GetString())), true
+				}),
+			},
+		)
+	})
+}
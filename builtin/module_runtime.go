@@ -0,0 +1,35 @@
+package builtin
+
+import (
+	"runtime"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+func registerRuntimeModule(builder *vm.RegistryBuilder) {
+	builder.RegisterModule("runtime", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				"metrics": vm.NewNativeFunction("metrics", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					m := v.Executor.Metrics()
+
+					return vm.NewObject(map[string]vm.Value{
+						"active":    vm.NewNumber(float64(m.Active)),
+						"queued":    vm.NewNumber(float64(m.Queued)),
+						"completed": vm.NewNumber(float64(m.Completed)),
+						"failed":    vm.NewNumber(float64(m.Failed)),
+						"poolSize":  vm.NewNumber(float64(m.PoolSize)),
+					}), true
+				}),
+
+				"numCPU": vm.NewNativeFunction("numCPU", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					return vm.NewNumber(float64(runtime.NumCPU())), true
+				}),
+
+				"numGoroutine": vm.NewNativeFunction("numGoroutine", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					return vm.NewNumber(float64(runtime.NumGoroutine())), true
+				}),
+			},
+		)
+	})
+}
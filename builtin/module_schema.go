@@ -0,0 +1,563 @@
+package builtin
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+// jsonSchema is a compiled JSON Schema, a subset of draft 2020-12.
+type jsonSchema struct {
+	// always is set for the true and false schemas
+	always *bool
+
+	types    []string
+	enum     []vm.Value
+	constant *vm.Value
+
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *jsonSchema
+	minProperties        *int
+	maxProperties        *int
+
+	items       *jsonSchema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	allOf []*jsonSchema
+	anyOf []*jsonSchema
+	oneOf []*jsonSchema
+	not   *jsonSchema
+}
+
+type schemaError struct {
+	path    string
+	keyword string
+	message string
+}
+
+func compileSchema(val vm.Value, path string) (*jsonSchema, error) {
+	if val.VType == vm.ValueTypeBool {
+		b := val.GetBool()
+		return &jsonSchema{always: &b}, nil
+	}
+
+	if val.VType != vm.ValueTypeObject {
+		return nil, fmt.Errorf("schema at %q must be an object or a bool, got %s", path, val.VType)
+	}
+
+	s := &jsonSchema{}
+	m := val.GetObject()
+
+	invalid := func(keyword string, expected string) error {
+		return fmt.Errorf("schema keyword %q at %q must be %s", keyword, path, expected)
+	}
+
+	nonNegative := func(keyword string, dst **int) error {
+		v, ok := m[keyword]
+		if !ok {
+			return nil
+		}
+		if v.VType != vm.ValueTypeNumber || v.GetNumber() < 0 || v.GetNumber() != math.Trunc(v.GetNumber()) {
+			return invalid(keyword, "a non negative integer")
+		}
+		n := int(v.GetNumber())
+		*dst = &n
+		return nil
+	}
+
+	number := func(keyword string, dst **float64) error {
+		v, ok := m[keyword]
+		if !ok {
+			return nil
+		}
+		if v.VType != vm.ValueTypeNumber {
+			return invalid(keyword, "a number")
+		}
+		n := v.GetNumber()
+		*dst = &n
+		return nil
+	}
+
+	subSchemas := func(keyword string, dst *[]*jsonSchema) error {
+		v, ok := m[keyword]
+		if !ok {
+			return nil
+		}
+		if v.VType != vm.ValueTypeArray || len(*v.GetArray()) == 0 {
+			return invalid(keyword, "a non empty array")
+		}
+		for i, item := range *v.GetArray() {
+			sub, err := compileSchema(item, fmt.Sprintf("%s/%s/%d", path, keyword, i))
+			if err != nil {
+				return err
+			}
+			*dst = append(*dst, sub)
+		}
+		return nil
+	}
+
+	subSchema := func(keyword string, dst **jsonSchema) error {
+		v, ok := m[keyword]
+		if !ok {
+			return nil
+		}
+		sub, err := compileSchema(v, path+"/"+keyword)
+		if err != nil {
+			return err
+		}
+		*dst = sub
+		return nil
+	}
+
+	if t, ok := m["type"]; ok {
+		var names []vm.Value
+		switch t.VType {
+		case vm.ValueTypeString:
+			names = []vm.Value{t}
+		case vm.ValueTypeArray:
+			names = *t.GetArray()
+		default:
+			return nil, invalid("type", "a string or an array of strings")
+		}
+
+		for _, name := range names {
+			if name.VType != vm.ValueTypeString {
+				return nil, invalid("type", "a string or an array of strings")
+			}
+			switch name.GetString() {
+			case "null", "boolean", "object", "array", "number", "integer", "string":
+				s.types = append(s.types, name.GetString())
+			default:
+				return nil, fmt.Errorf("unknown type %q at %q", name.GetString(), path)
+			}
+		}
+	}
+
+	if e, ok := m["enum"]; ok {
+		if e.VType != vm.ValueTypeArray {
+			return nil, invalid("enum", "an array")
+		}
+		s.enum = *e.GetArray()
+	}
+
+	if c, ok := m["const"]; ok {
+		s.constant = &c
+	}
+
+	if props, ok := m["properties"]; ok {
+		if props.VType != vm.ValueTypeObject {
+			return nil, invalid("properties", "an object")
+		}
+		s.properties = map[string]*jsonSchema{}
+		for k, v := range props.GetObject() {
+			sub, err := compileSchema(v, path+"/properties/"+k)
+			if err != nil {
+				return nil, err
+			}
+			s.properties[k] = sub
+		}
+	}
+
+	if req, ok := m["required"]; ok {
+		if req.VType != vm.ValueTypeArray {
+			return nil, invalid("required", "an array of strings")
+		}
+		for _, k := range *req.GetArray() {
+			if k.VType != vm.ValueTypeString {
+				return nil, invalid("required", "an array of strings")
+			}
+			s.required = append(s.required, k.GetString())
+		}
+	}
+
+	if p, ok := m["pattern"]; ok {
+		if p.VType != vm.ValueTypeString {
+			return nil, invalid("pattern", "a string")
+		}
+		re, err := regexp.Compile(p.GetString())
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern at %q: %w", path, err)
+		}
+		s.pattern = re
+	}
+
+	if u, ok := m["uniqueItems"]; ok {
+		s.uniqueItems = u.IsTruthy()
+	}
+
+	for _, err := range []error{
+		subSchema("additionalProperties", &s.additionalProperties),
+		subSchema("items", &s.items),
+		subSchema("not", &s.not),
+		subSchemas("allOf", &s.allOf),
+		subSchemas("anyOf", &s.anyOf),
+		subSchemas("oneOf", &s.oneOf),
+		nonNegative("minProperties", &s.minProperties),
+		nonNegative("maxProperties", &s.maxProperties),
+		nonNegative("minItems", &s.minItems),
+		nonNegative("maxItems", &s.maxItems),
+		nonNegative("minLength", &s.minLength),
+		nonNegative("maxLength", &s.maxLength),
+		number("minimum", &s.minimum),
+		number("maximum", &s.maximum),
+		number("exclusiveMinimum", &s.exclusiveMinimum),
+		number("exclusiveMaximum", &s.exclusiveMaximum),
+		number("multipleOf", &s.multipleOf),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.multipleOf != nil && *s.multipleOf <= 0 {
+		return nil, invalid("multipleOf", "a positive number")
+	}
+
+	return s, nil
+}
+
+func schemaTypeOf(val vm.Value) string {
+	switch val.VType {
+	case vm.ValueTypeNil:
+		return "null"
+	case vm.ValueTypeBool:
+		return "boolean"
+	case vm.ValueTypeObject:
+		return "object"
+	case vm.ValueTypeArray:
+		return "array"
+	case vm.ValueTypeNumber:
+		return "number"
+	case vm.ValueTypeString:
+		return "string"
+	default:
+		return val.VType.String()
+	}
+}
+
+func schemaHasType(val vm.Value, t string) bool {
+	actual := schemaTypeOf(val)
+	if t == "integer" {
+		return actual == "number" && val.GetNumber() == math.Trunc(val.GetNumber())
+	}
+
+	return actual == t
+}
+
+// schemaEqual compares JSON values structurally, enum, const and uniqueItems use it.
+func schemaEqual(a, b vm.Value) bool {
+	if a.VType != b.VType {
+		return false
+	}
+
+	switch a.VType {
+	case vm.ValueTypeArray:
+		x, y := *a.GetArray(), *b.GetArray()
+		return slices.EqualFunc(x, y, schemaEqual)
+	case vm.ValueTypeObject:
+		return maps.EqualFunc(a.GetObject(), b.GetObject(), schemaEqual)
+	default:
+		return valuesEqual(a, b)
+	}
+}
+
+// schemaPointer escapes a JSON pointer segment.
+func schemaPointer(path string, segment string) string {
+	segment = strings.ReplaceAll(segment, "~", "~0")
+	segment = strings.ReplaceAll(segment, "/", "~1")
+	return path + "/" + segment
+}
+
+func formatSchemaNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+func (s *jsonSchema) validate(val vm.Value, path string, errs []schemaError) []schemaError {
+	fail := func(keyword string, format string, args ...any) {
+		errs = append(errs, schemaError{path: path, keyword: keyword, message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.always != nil {
+		if !*s.always {
+			fail("false", "no value is allowed here")
+		}
+		return errs
+	}
+
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(t string) bool { return schemaHasType(val, t) }) {
+		fail("type", "must be %s, got %s", strings.Join(s.types, " or "), schemaTypeOf(val))
+		return errs
+	}
+
+	if s.enum != nil && !slices.ContainsFunc(s.enum, func(e vm.Value) bool { return schemaEqual(e, val) }) {
+		fail("enum", "must be one of the allowed values")
+	}
+
+	if s.constant != nil && !schemaEqual(*s.constant, val) {
+		fail("const", "must be equal to the constant value")
+	}
+
+	switch val.VType {
+	case vm.ValueTypeObject:
+		m := val.GetObject()
+		for _, k := range s.required {
+			if _, ok := m[k]; !ok {
+				fail("required", "missing required property %q", k)
+			}
+		}
+
+		if s.minProperties != nil && len(m) < *s.minProperties {
+			fail("minProperties", "must have at least %d properties", *s.minProperties)
+		}
+		if s.maxProperties != nil && len(m) > *s.maxProperties {
+			fail("maxProperties", "must have at most %d properties", *s.maxProperties)
+		}
+
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			if sub, ok := s.properties[k]; ok {
+				errs = sub.validate(m[k], schemaPointer(path, k), errs)
+			} else if s.additionalProperties != nil {
+				if s.additionalProperties.always != nil && !*s.additionalProperties.always {
+					errs = append(errs, schemaError{
+						path:    schemaPointer(path, k),
+						keyword: "additionalProperties",
+						message: fmt.Sprintf("property %q is not allowed", k),
+					})
+					continue
+				}
+				errs = s.additionalProperties.validate(m[k], schemaPointer(path, k), errs)
+			}
+		}
+
+	case vm.ValueTypeArray:
+		arr := *val.GetArray()
+		if s.minItems != nil && len(arr) < *s.minItems {
+			fail("minItems", "must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(arr) > *s.maxItems {
+			fail("maxItems", "must have at most %d items", *s.maxItems)
+		}
+
+		if s.uniqueItems {
+		unique:
+			for i := range arr {
+				for j := range i {
+					if schemaEqual(arr[i], arr[j]) {
+						fail("uniqueItems", "items %d and %d must be unique", j, i)
+						break unique
+					}
+				}
+			}
+		}
+
+		if s.items != nil {
+			for i, item := range arr {
+				errs = s.items.validate(item, schemaPointer(path, strconv.Itoa(i)), errs)
+			}
+		}
+
+	case vm.ValueTypeString:
+		str := val.GetString()
+		n := utf8.RuneCountInString(str)
+		if s.minLength != nil && n < *s.minLength {
+			fail("minLength", "must be at least %d characters long", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			fail("maxLength", "must be at most %d characters long", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			fail("pattern", "must match pattern %q", s.pattern.String())
+		}
+
+	case vm.ValueTypeNumber:
+		n := val.GetNumber()
+		if s.minimum != nil && n < *s.minimum {
+			fail("minimum", "must be >= %s", formatSchemaNumber(*s.minimum))
+		}
+		if s.maximum != nil && n > *s.maximum {
+			fail("maximum", "must be <= %s", formatSchemaNumber(*s.maximum))
+		}
+		if s.exclusiveMinimum != nil && n <= *s.exclusiveMinimum {
+			fail("exclusiveMinimum", "must be > %s", formatSchemaNumber(*s.exclusiveMinimum))
+		}
+		if s.exclusiveMaximum != nil && n >= *s.exclusiveMaximum {
+			fail("exclusiveMaximum", "must be < %s", formatSchemaNumber(*s.exclusiveMaximum))
+		}
+		if s.multipleOf != nil {
+			q := n / *s.multipleOf
+			if math.Abs(q-math.Round(q)) > 1e-9 {
+				fail("multipleOf", "must be a multiple of %s", formatSchemaNumber(*s.multipleOf))
+			}
+		}
+	}
+
+	for _, sub := range s.allOf {
+		errs = sub.validate(val, path, errs)
+	}
+
+	if len(s.anyOf) > 0 {
+		matched := slices.ContainsFunc(s.anyOf, func(sub *jsonSchema) bool {
+			return len(sub.validate(val, path, nil)) == 0
+		})
+		if !matched {
+			fail("anyOf", "must match at least one schema in anyOf")
+		}
+	}
+
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if len(sub.validate(val, path, nil)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			fail("oneOf", "must match exactly one schema in oneOf, matched %d", matches)
+		}
+	}
+
+	if s.not != nil && len(s.not.validate(val, path, nil)) == 0 {
+		fail("not", "must not match the schema in not")
+	}
+
+	return errs
+}
+
+func schemaErrorsValue(errs []schemaError) vm.Value {
+	result := make([]vm.Value, len(errs))
+	for i, err := range errs {
+		result[i] = vm.NewObject(map[string]vm.Value{
+			"path":    vm.NewString(err.path),
+			"keyword": vm.NewString(err.keyword),
+			"message": vm.NewString(err.message),
+		})
+	}
+
+	return vm.NewArray(result)
+}
+
+// schemaArg compiles a schema given as an object, a bool or a JSON string.
+func schemaArg(args vm.NativeFunctionArgs, i int) (*jsonSchema, vm.Value, bool) {
+	val, ok := args.Get(i, vm.ValueTypeObject, vm.ValueTypeBool, vm.ValueTypeString)
+	if !ok {
+		return nil, val, false
+	}
+
+	if val.VType == vm.ValueTypeString {
+		decoded, errVal, ok := decodeJSON(val.GetString(), false)
+		if !ok {
+			return nil, errVal, false
+		}
+		val = decoded
+	}
+
+	s, err := compileSchema(val, "")
+	if err != nil {
+		return nil, vm.NewError("schema: "+err.Error(), vm.Value{}), false
+	}
+
+	return s, vm.Value{}, true
+}
+
+func newSchema(s *jsonSchema) vm.Value {
+	return vm.NewNativeObject(s, map[string]vm.Value{
+		// validate returns {valid, errors}, errors have a JSON pointer path,
+		// the failed keyword and a message.
+		"validate": vm.NewNativeFunction("validate", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			val, ok := args.Get(0)
+			if !ok {
+				return val, false
+			}
+
+			errs := s.validate(val, "", nil)
+			return vm.NewObject(map[string]vm.Value{
+				"valid":  vm.NewBool(len(errs) == 0),
+				"errors": schemaErrorsValue(errs),
+			}), true
+		}),
+
+		"isValid": vm.NewNativeFunction("isValid", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			val, ok := args.Get(0)
+			if !ok {
+				return val, false
+			}
+
+			return vm.NewBool(len(s.validate(val, "", nil)) == 0), true
+		}),
+
+		// assert returns the value when it's valid, otherwise it raises
+		// an error with the list of errors as its data.
+		"assert": vm.NewNativeFunction("assert", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			val, ok := args.Get(0)
+			if !ok {
+				return val, false
+			}
+
+			errs := s.validate(val, "", nil)
+			if len(errs) > 0 {
+				msg := fmt.Sprintf("schema validation failed: %s %s", errs[0].path, errs[0].message)
+				if errs[0].path == "" {
+					msg = "schema validation failed: " + errs[0].message
+				}
+				return vm.NewError(msg, schemaErrorsValue(errs)), false
+			}
+
+			return val, true
+		}),
+	})
+}
+
+func registerSchemaModule(builder *vm.RegistryBuilder) {
+	builder.RegisterModule("schema", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				"compile": vm.NewNativeFunction("compile", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					s, errVal, ok := schemaArg(args, 0)
+					if !ok {
+						return errVal, false
+					}
+
+					return newSchema(s), true
+				}),
+
+				"validate": vm.NewNativeFunction("validate", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					s, errVal, ok := schemaArg(args, 0)
+					if !ok {
+						return errVal, false
+					}
+
+					val, ok := args.Get(1)
+					if !ok {
+						return val, false
+					}
+
+					errs := s.validate(val, "", nil)
+					return vm.NewObject(map[string]vm.Value{
+						"valid":  vm.NewBool(len(errs) == 0),
+						"errors": schemaErrorsValue(errs),
+					}), true
+				}),
+			},
+		)
+	})
+}
@@ -2,6 +2,7 @@ package builtin
 
 import (
 	"strings"
+	"unicode/utf8"
 
 	"github.com/joetifa2003/weaver/internal/pkg/helpers"
 	"github.com/joetifa2003/weaver/vm"
@@ -103,58 +104,8 @@ func registerStringModule(builder *vm.RegistryBuilder) {
 					if !ok {
 						return formatStrArg, false
 					}
-					formatStr := formatStrArg.GetString()
-					formatArgs := args.Args[1:]
 
-					var result strings.Builder
-					argIndex := 0
-
-					for i := 0; i < len(formatStr); i++ {
-						char := formatStr[i]
-
-						switch char {
-						case '\\':
-							// Check for escape sequence
-							if i+1 < len(formatStr) {
-								nextChar := formatStr[i+1]
-								if nextChar == '{' || nextChar == '}' || nextChar == '\\' {
-									// Append the escaped character
-									result.WriteByte(nextChar)
-									i++ // Skip the next character
-								} else {
-									// Not a valid escape sequence, append the backslash literally
-									result.WriteByte(char)
-								}
-							} else {
-								// Backslash at the end of the string, append it literally
-								result.WriteByte(char)
-							}
-						case '{':
-							// Check if next char is '}' for placeholder
-							if i+1 < len(formatStr) && formatStr[i+1] == '}' {
-								if argIndex >= len(formatArgs) {
-									// Not enough arguments provided for placeholders, append "{}" literally
-									result.WriteString("{}")
-								} else {
-									arg := formatArgs[argIndex]
-									if arg.IsError() { // Propagate errors from arguments
-										return arg, false
-									}
-									result.WriteString(arg.String()) // Append string representation of the arg
-									argIndex++
-								}
-								i++ // Skip the '}'
-							} else {
-								// It's just a literal '{', append it
-								result.WriteByte(char)
-							}
-						default:
-							// Append regular character
-							result.WriteByte(char)
-						}
-					}
-
-					return vm.NewString(result.String()), true
+					return formatString(formatStrArg.GetString(), args.Args[1:])
 				}),
 				"replace": vm.NewNativeFunction("replace", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
 					strArg, ok := args.Get(0, vm.ValueTypeString)
@@ -191,7 +142,8 @@ func registerStringModule(builder *vm.RegistryBuilder) {
 						return startArg, false
 					}
 
-					str := strArg.GetString()
+					// indices count runes, not bytes
+					str := []rune(strArg.GetString())
 					start := int(startArg.GetNumber())
 					end := len(str) // Default to end of string
 
@@ -214,7 +166,7 @@ func registerStringModule(builder *vm.RegistryBuilder) {
 						return vm.NewString(""), true // Return empty string for invalid ranges
 					}
 
-					return vm.NewString(str[start:end]), true
+					return vm.NewString(string(str[start:end])), true
 				}),
 				"indexOf": vm.NewNativeFunction("indexOf", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
 					strArg, ok := args.Get(0, vm.ValueTypeString)
@@ -226,7 +178,7 @@ func registerStringModule(builder *vm.RegistryBuilder) {
 						return substrArg, false
 					}
 
-					return vm.NewNumber(float64(strings.Index(strArg.GetString(), substrArg.GetString()))), true
+					return vm.NewNumber(float64(runeIndex(strArg.GetString(), strings.Index(strArg.GetString(), substrArg.GetString())))), true
 				}),
 				"lastIndexOf": vm.NewNativeFunction("lastIndexOf", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
 					strArg, ok := args.Get(0, vm.ValueTypeString)
@@ -238,7 +190,7 @@ func registerStringModule(builder *vm.RegistryBuilder) {
 						return substrArg, false
 					}
 
-					return vm.NewNumber(float64(strings.LastIndex(strArg.GetString(), substrArg.GetString()))), true
+					return vm.NewNumber(float64(runeIndex(strArg.GetString(), strings.LastIndex(strArg.GetString(), substrArg.GetString())))), true
 				}),
 				"padStart": vm.NewNativeFunction("padStart", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
 					strArg, ok := args.Get(0, vm.ValueTypeString)
@@ -286,14 +238,29 @@ func registerStringModule(builder *vm.RegistryBuilder) {
 
 					return vm.NewString(padString(str, targetLength, padStr, false)), true
 				}),
+
+				"length":         vm.NewNativeFunction("length", stringsLength),
+				"bytes":          vm.NewNativeFunction("bytes", stringsBytes),
+				"runes":          vm.NewNativeFunction("runes", stringsRunes),
+				"chars":          vm.NewNativeFunction("chars", stringsChars),
+				"graphemes":      vm.NewNativeFunction("graphemes", stringsGraphemes),
+				"codePointAt":    vm.NewNativeFunction("codePointAt", stringsCodePointAt),
+				"fromCodePoints": vm.NewNativeFunction("fromCodePoints", stringsFromCodePoints),
+				"repeat":         vm.NewNativeFunction("repeat", stringsRepeat),
+				"title":          vm.NewNativeFunction("title", stringsTitle),
+				"fold":           vm.NewNativeFunction("fold", stringsFold),
+				"equalFold":      vm.NewNativeFunction("equalFold", stringsEqualFold),
+				"normalize":      vm.NewNativeFunction("normalize", stringsNormalize),
+				"builder":        vm.NewNativeFunction("builder", stringsBuilder),
 			},
 		)
 	})
 }
 
-// Helper function for padding
+// Helper function for padding, lengths count runes
 func padString(str string, targetLength int, padString string, padStart bool) string {
-	if len(str) >= targetLength {
+	strLen := utf8.RuneCountInString(str)
+	if strLen >= targetLength {
 		return str
 	}
 
@@ -301,14 +268,24 @@ func padString(str string, targetLength int, padString string, padStart bool) st
 		padString = " " // Default pad string is space
 	}
 
-	padLen := targetLength - len(str)
-	repeatCount := padLen / len(padString)
-	remainingPad := padLen % len(padString)
+	pad := []rune(padString)
+	padLen := targetLength - strLen
+	repeatCount := padLen / len(pad)
+	remainingPad := padLen % len(pad)
 
-	padding := strings.Repeat(padString, repeatCount) + padString[:remainingPad]
+	padding := strings.Repeat(padString, repeatCount) + string(pad[:remainingPad])
 
 	if padStart {
 		return padding + str
 	}
 	return str + padding
 }
+
+// runeIndex converts a byte index of s to a rune index, -1 stays -1.
+func runeIndex(s string, byteIdx int) int {
+	if byteIdx < 0 {
+		return byteIdx
+	}
+
+	return utf8.RuneCountInString(s[:byteIdx])
+}
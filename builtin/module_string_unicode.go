@@ -0,0 +1,311 @@
+package builtin
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+func stringsArray(parts []string) vm.Value {
+	result := make([]vm.Value, len(parts))
+	for i, part := range parts {
+		result[i] = vm.NewString(part)
+	}
+
+	return vm.NewArray(result)
+}
+
+func stringsLength(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	strArg, ok := args.Get(0, vm.ValueTypeString)
+	if !ok {
+		return strArg, false
+	}
+
+	return vm.NewNumber(float64(utf8.RuneCountInString(strArg.GetString()))), true
+}
+
+func stringsBytes(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	strArg, ok := args.Get(0, vm.ValueTypeString)
+	if !ok {
+		return strArg, false
+	}
+
+	str := strArg.GetString()
+	result := make([]vm.Value, len(str))
+	for i := range len(str) {
+		result[i] = vm.NewNumber(float64(str[i]))
+	}
+
+	return vm.NewArray(result), true
+}
+
+func stringsRunes(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	strArg, ok := args.Get(0, vm.ValueTypeString)
+	if !ok {
+		return strArg, false
+	}
+
+	result := []vm.Value{}
+	for _, r := range strArg.GetString() {
+		result = append(result, vm.NewNumber(float64(r)))
+	}
+
+	return vm.NewArray(result), true
+}
+
+func stringsChars(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	strArg, ok := args.Get(0, vm.ValueTypeString)
+	if !ok {
+		return strArg, false
+	}
+
+	result := []vm.Value{}
+	for _, r := range strArg.GetString() {
+		result = append(result, vm.NewString(string(r)))
+	}
+
+	return vm.NewArray(result), true
+}
+
+func stringsGraphemes(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	strArg, ok := args.Get(0, vm.ValueTypeString)
+	if !ok {
+		return strArg, false
+	}
+
+	return stringsArray(graphemes(strArg.GetString())), true
+}
+
+// graphemes splits s into user perceived characters, it keeps combining
+// marks, variation selectors, emoji modifiers, zero width joiner sequences
+// and regional indicator pairs (flags) with the rune before them.
+func graphemes(s string) []string {
+	result := []string{}
+	start := 0
+	prev := rune(-1)
+	regional := 0
+
+	for i, r := range s {
+		if prev != -1 && !graphemeExtends(prev, r, regional) {
+			result = append(result, s[start:i])
+			start = i
+			regional = 0
+		}
+
+		if isRegionalIndicator(r) {
+			regional++
+		}
+		prev = r
+	}
+
+	if start < len(s) {
+		result = append(result, s[start:])
+	}
+
+	return result
+}
+
+func graphemeExtends(prev, r rune, regional int) bool {
+	switch {
+	case prev == '\r' && r == '\n':
+		return true
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc):
+		return true
+	case r == '\u200d' || prev == '\u200d':
+		return true
+	case unicode.Is(unicode.Variation_Selector, r):
+		return true
+	case r >= 0x1f3fb && r <= 0x1f3ff: // emoji skin tone modifiers
+		return true
+	case isRegionalIndicator(prev) && isRegionalIndicator(r):
+		return regional%2 == 1
+	default:
+		return false
+	}
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+func stringsCodePointAt(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	strArg, ok := args.Get(0, vm.ValueTypeString)
+	if !ok {
+		return strArg, false
+	}
+
+	idxArg, ok := args.Get(1, vm.ValueTypeNumber)
+	if !ok {
+		return idxArg, false
+	}
+
+	idx := int(idxArg.GetNumber())
+	i := 0
+	for _, r := range strArg.GetString() {
+		if i == idx {
+			return vm.NewNumber(float64(r)), true
+		}
+		i++
+	}
+
+	return vm.Value{}, true
+}
+
+func stringsFromCodePoints(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	var sb strings.Builder
+	for i := range args.Len() {
+		cpArg, ok := args.Get(i, vm.ValueTypeNumber)
+		if !ok {
+			return cpArg, false
+		}
+
+		r := rune(cpArg.GetNumber())
+		if !utf8.ValidRune(r) {
+			return vm.NewError("invalid code point", cpArg), false
+		}
+		sb.WriteRune(r)
+	}
+
+	return vm.NewString(sb.String()), true
+}
+
+func stringsRepeat(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	strArg, ok := args.Get(0, vm.ValueTypeString)
+	if !ok {
+		return strArg, false
+	}
+
+	countArg, ok := args.Get(1, vm.ValueTypeNumber)
+	if !ok {
+		return countArg, false
+	}
+
+	count := int(countArg.GetNumber())
+	if count < 0 {
+		return vm.NewError("repeat count must not be negative", countArg), false
+	}
+
+	return vm.NewString(strings.Repeat(strArg.GetString(), count)), true
+}
+
+func stringsTitle(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	strArg, ok := args.Get(0, vm.ValueTypeString)
+	if !ok {
+		return strArg, false
+	}
+
+	return vm.NewString(cases.Title(language.Und).String(strArg.GetString())), true
+}
+
+func stringsFold(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	strArg, ok := args.Get(0, vm.ValueTypeString)
+	if !ok {
+		return strArg, false
+	}
+
+	return vm.NewString(cases.Fold().String(strArg.GetString())), true
+}
+
+func stringsEqualFold(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	aArg, ok := args.Get(0, vm.ValueTypeString)
+	if !ok {
+		return aArg, false
+	}
+
+	bArg, ok := args.Get(1, vm.ValueTypeString)
+	if !ok {
+		return bArg, false
+	}
+
+	fold := cases.Fold()
+	return vm.NewBool(fold.String(aArg.GetString()) == fold.String(bArg.GetString())), true
+}
+
+// stringsNormalize normalizes to NFC unless another form is given.
+func stringsNormalize(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	strArg, ok := args.Get(0, vm.ValueTypeString)
+	if !ok {
+		return strArg, false
+	}
+
+	form := norm.NFC
+	if args.Len() > 1 {
+		formArg, ok := args.Get(1, vm.ValueTypeString)
+		if !ok {
+			return formArg, false
+		}
+
+		switch formArg.GetString() {
+		case "NFC":
+			form = norm.NFC
+		case "NFD":
+			form = norm.NFD
+		case "NFKC":
+			form = norm.NFKC
+		case "NFKD":
+			form = norm.NFKD
+		default:
+			return vm.NewError("unknown normalization form, expected NFC, NFD, NFKC or NFKD", formArg), false
+		}
+	}
+
+	return vm.NewString(form.String(strArg.GetString())), true
+}
+
+type stringBuilder struct {
+	mu sync.Mutex
+	sb strings.Builder
+}
+
+func (b *stringBuilder) write(args vm.NativeFunctionArgs, newline bool) (vm.Value, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, arg := range args.Args {
+		if arg.IsError() {
+			return arg, false
+		}
+		b.sb.WriteString(arg.String())
+	}
+
+	if newline {
+		b.sb.WriteByte('\n')
+	}
+
+	return vm.Value{}, true
+}
+
+// stringsBuilder accumulates strings without copying on every write
+// like repeated + does.
+func stringsBuilder(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+	b := &stringBuilder{}
+
+	return vm.NewNativeObject(b, map[string]vm.Value{
+		"write": vm.NewNativeFunction("write", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			return b.write(args, false)
+		}),
+		"writeLine": vm.NewNativeFunction("writeLine", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			return b.write(args, true)
+		}),
+		"toString": vm.NewNativeFunction("toString", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			return vm.NewString(b.sb.String()), true
+		}),
+		"reset": vm.NewNativeFunction("reset", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			b.sb.Reset()
+			return vm.Value{}, true
+		}),
+	}), true
+}
@@ -3,6 +3,7 @@ package builtin
 import (
 	"time"
 
+	"github.com/joetifa2003/weaver/internal/pkg/cron"
 	"github.com/joetifa2003/weaver/vm"
 )
 
@@ -170,11 +171,19 @@ func registerTimeModule(builder *vm.RegistryBuilder) {
 				return vm.NewTime(t.AddDate(int(yearsArg.GetNumber()), int(monthsArg.GetNumber()), int(daysArg.GetNumber()))), true
 			}),
 
+			// after(t1, t2) compares times, after(duration, fn) calls fn once the duration passes.
 			"after": vm.NewNativeFunction("after", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
-				time1Arg, ok := args.Get(0, vm.ValueTypeTime)
+				time1Arg, ok := args.Get(0, vm.ValueTypeTime, vm.ValueTypeNumber)
 				if !ok {
 					return time1Arg, false
 				}
+				if time1Arg.VType == vm.ValueTypeNumber {
+					fnArg, ok := args.Get(1, vm.ValueTypeFunction)
+					if !ok {
+						return fnArg, false
+					}
+					return scheduleAfter(v, time.Duration(time1Arg.GetNumber()), fnArg), true
+				}
 				time2Arg, ok := args.Get(1, vm.ValueTypeTime)
 				if !ok {
 					return time2Arg, false
@@ -484,6 +493,78 @@ func registerTimeModule(builder *vm.RegistryBuilder) {
 				return vm.NewTime(t.In(loc)), true
 			}),
 
+			// --- Scheduling ---
+			"every": vm.NewNativeFunction("every", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+				durationArg, ok := args.Get(0, vm.ValueTypeNumber)
+				if !ok {
+					return durationArg, false
+				}
+				fnArg, ok := args.Get(1, vm.ValueTypeFunction)
+				if !ok {
+					return fnArg, false
+				}
+
+				d := time.Duration(durationArg.GetNumber())
+				if d <= 0 {
+					return vm.NewError("every duration must be positive", durationArg), false
+				}
+
+				return scheduleEvery(v, d, fnArg), true
+			}),
+
+			"ticker": vm.NewNativeFunction("ticker", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+				durationArg, ok := args.Get(0, vm.ValueTypeNumber)
+				if !ok {
+					return durationArg, false
+				}
+
+				d := time.Duration(durationArg.GetNumber())
+				if d <= 0 {
+					return vm.NewError("ticker duration must be positive", durationArg), false
+				}
+
+				return newTicker(v, d), true
+			}),
+
+			"cron": vm.NewNativeFunction("cron", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+				exprArg, ok := args.Get(0, vm.ValueTypeString)
+				if !ok {
+					return exprArg, false
+				}
+				fnArg, ok := args.Get(1, vm.ValueTypeFunction)
+				if !ok {
+					return fnArg, false
+				}
+
+				loc := time.Local
+				if len(args.Args) > 2 {
+					optsArg, ok := args.Get(2, vm.ValueTypeObject)
+					if !ok {
+						return optsArg, false
+					}
+
+					if tz, ok := optsArg.GetObject()["tz"]; ok {
+						tz, ok := vm.CheckValueType("cron.tz", tz, vm.ValueTypeString)
+						if !ok {
+							return tz, false
+						}
+
+						var err error
+						loc, err = time.LoadLocation(tz.GetString())
+						if err != nil {
+							return vm.NewErrFromErr(err), false
+						}
+					}
+				}
+
+				s, err := cron.Parse(exprArg.GetString())
+				if err != nil {
+					return vm.NewErrFromErr(err), false
+				}
+
+				return scheduleCron(v, s, loc, fnArg), true
+			}),
+
 			"getZone": vm.NewNativeFunction("getZone", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
 				timeArg, ok := args.Get(0, vm.ValueTypeTime)
 				if !ok {
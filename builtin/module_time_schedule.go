@@ -0,0 +1,160 @@
+package builtin
+
+import (
+	"context"
+	"time"
+
+	"github.com/joetifa2003/weaver/internal/pkg/cron"
+	"github.com/joetifa2003/weaver/vm"
+)
+
+// scheduleHandle controls callbacks started by time.after, time.every and time.cron.
+type scheduleHandle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	runs   int
+	err    vm.Value
+}
+
+// schedule calls fn through the executor each time the wait returned by next passes,
+// it stops when next returns false, the handle or the calling task is cancelled,
+// or fn raises an error.
+func schedule(v *vm.VM, fn vm.Value, next func(now time.Time) (time.Duration, bool)) vm.Value {
+	ctx, cancel := context.WithCancel(v.Ctx)
+	h := &scheduleHandle{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	executor := v.Executor
+
+	go func() {
+		defer close(h.done)
+		defer cancel()
+
+		for {
+			d, ok := next(time.Now())
+			if !ok {
+				return
+			}
+
+			timer := time.NewTimer(d)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+
+			val, ok := executor.RunContext(ctx, fn).Join()
+			h.runs++
+			if !ok {
+				if ctx.Err() == nil {
+					h.err = val
+				}
+				return
+			}
+		}
+	}()
+
+	return h.value()
+}
+
+func (h *scheduleHandle) value() vm.Value {
+	return vm.NewNativeObject(h, map[string]vm.Value{
+		"cancel": vm.NewNativeFunction("cancel", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			h.cancel()
+			return vm.Value{}, true
+		}),
+		// wait waits until the schedule stops and raises the error that stopped it.
+		"wait": vm.NewNativeFunction("wait", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			select {
+			case <-h.done:
+			case <-v.Ctx.Done():
+				return vm.NewCancelled(), false
+			}
+
+			if h.err.IsError() {
+				return h.err, false
+			}
+
+			return vm.NewNumber(float64(h.runs)), true
+		}),
+	})
+}
+
+func scheduleAfter(v *vm.VM, d time.Duration, fn vm.Value) vm.Value {
+	fired := false
+	return schedule(v, fn, func(now time.Time) (time.Duration, bool) {
+		if fired {
+			return 0, false
+		}
+		fired = true
+		return d, true
+	})
+}
+
+func scheduleEvery(v *vm.VM, d time.Duration, fn vm.Value) vm.Value {
+	return schedule(v, fn, func(now time.Time) (time.Duration, bool) {
+		return d, true
+	})
+}
+
+func scheduleCron(v *vm.VM, s *cron.Schedule, loc *time.Location, fn vm.Value) vm.Value {
+	return schedule(v, fn, func(now time.Time) (time.Duration, bool) {
+		next := s.Next(now.In(loc))
+		if next.IsZero() {
+			return 0, false
+		}
+		return next.Sub(now), true
+	})
+}
+
+// newTicker sends the time to its channel every d, like time.Ticker it drops ticks
+// for slow receivers, the channel is closed when it's stopped.
+func newTicker(v *vm.VM, d time.Duration) vm.Value {
+	ctx, cancel := context.WithCancel(v.Ctx)
+	ticker := time.NewTicker(d)
+	ch := make(chan vm.Value, 1)
+
+	go func() {
+		defer close(ch)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case t := <-ticker.C:
+				select {
+				case ch <- vm.NewTime(t):
+				default:
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	c := vm.Value{}
+	c.SetChannel(ch)
+
+	return vm.NewObject(map[string]vm.Value{
+		"c": c,
+		"stop": vm.NewNativeFunction("stop", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			cancel()
+			return vm.Value{}, true
+		}),
+		"reset": vm.NewNativeFunction("reset", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			dArg, ok := args.Get(0, vm.ValueTypeNumber)
+			if !ok {
+				return dArg, false
+			}
+
+			d := time.Duration(dArg.GetNumber())
+			if d <= 0 {
+				return vm.NewError("ticker duration must be positive", dArg), false
+			}
+
+			ticker.Reset(d)
+			return vm.Value{}, true
+		}),
+	})
+}
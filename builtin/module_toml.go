@@ -0,0 +1,211 @@
+package builtin
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+func tomlError(err error) vm.Value {
+	var parseErr toml.ParseError
+	if !errors.As(err, &parseErr) {
+		return vm.NewErrFromErr(err)
+	}
+
+	return vm.NewError(
+		parseErr.Error(),
+		vm.NewObject(map[string]vm.Value{
+			"line":   vm.NewNumber(float64(parseErr.Position.Line)),
+			"column": vm.NewNumber(float64(parseErr.Position.Col)),
+		}),
+	)
+}
+
+// tomlOrder holds the keys of each table in the order of the document,
+// tables are found by their key path.
+type tomlOrder map[string][]string
+
+func newTOMLOrder(md toml.MetaData) tomlOrder {
+	order := tomlOrder{}
+	seen := map[string]bool{}
+	for _, key := range md.Keys() {
+		for i := range key {
+			parent, child := key[:i].String(), key[:i+1].String()
+			if !seen[child] {
+				seen[child] = true
+				order[parent] = append(order[parent], key[i])
+			}
+		}
+	}
+	return order
+}
+
+// value converts a decoded value at path, tables in arrays share the path
+// of the array.
+func (o tomlOrder) value(path toml.Key, v any) vm.Value {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]vm.Value, len(v))
+		for k, item := range v {
+			m[k] = o.value(append(slices.Clip(path), k), item)
+		}
+		return vm.NewOrderedObject(m, slices.Clone(o[path.String()]))
+	case []map[string]any:
+		a := make([]vm.Value, len(v))
+		for i, item := range v {
+			a[i] = o.value(path, item)
+		}
+		return vm.NewArray(a)
+	case []any:
+		a := make([]vm.Value, len(v))
+		for i, item := range v {
+			a[i] = o.value(path, item)
+		}
+		return vm.NewArray(a)
+	default:
+		return valufiyValue(v)
+	}
+}
+
+// tomlEncoder writes tables with the keys in the order of the object, like
+// the toml package it writes values before tables. Values other than tables
+// are written by the toml package.
+type tomlEncoder struct {
+	buf    bytes.Buffer
+	indent string
+}
+
+// isTOMLTable reports whether v is written as a table or an array of tables.
+func isTOMLTable(v vm.Value) bool {
+	switch v.VType {
+	case vm.ValueTypeObject:
+		return true
+	case vm.ValueTypeArray:
+		arr := *v.GetArray()
+		for _, item := range arr {
+			if item.VType != vm.ValueTypeObject {
+				return false
+			}
+		}
+		return len(arr) > 0
+	default:
+		return false
+	}
+}
+
+func (e *tomlEncoder) table(path toml.Key, obj vm.Value) error {
+	m := obj.GetObject()
+	keys := obj.ObjectKeys()
+
+	for _, k := range keys {
+		v := m[k]
+		if v.VType == vm.ValueTypeNil || isTOMLTable(v) {
+			continue
+		}
+
+		goVal, err := goifyValue(v)
+		if err != nil {
+			return err
+		}
+
+		e.buf.WriteString(strings.Repeat(e.indent, len(path)))
+		if err := toml.NewEncoder(&e.buf).Encode(map[string]any{k: goVal}); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range keys {
+		v := m[k]
+		if !isTOMLTable(v) {
+			continue
+		}
+
+		key := append(slices.Clip(path), k)
+		if v.VType == vm.ValueTypeObject {
+			if len(key) == 1 && e.buf.Len() > 0 {
+				e.buf.WriteByte('\n')
+			}
+			e.header(key, "[", "]")
+			if err := e.table(key, v); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, item := range *v.GetArray() {
+			if e.buf.Len() > 0 {
+				e.buf.WriteByte('\n')
+			}
+			e.header(key, "[[", "]]")
+			if err := e.table(key, item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (e *tomlEncoder) header(key toml.Key, open string, close string) {
+	e.buf.WriteString(strings.Repeat(e.indent, len(key)-1))
+	e.buf.WriteString(open)
+	e.buf.WriteString(key.String())
+	e.buf.WriteString(close)
+	e.buf.WriteByte('\n')
+}
+
+func registerTOMLModule(builder *vm.RegistryBuilder) {
+	builder.RegisterModule("toml", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				// parse returns an object that keeps the key order of the
+				// document, dates and times become time values.
+				"parse": vm.NewNativeFunction("parse", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					dataArg, ok := args.Get(0, vm.ValueTypeString)
+					if !ok {
+						return dataArg, false
+					}
+
+					var result map[string]any
+					md, err := toml.Decode(dataArg.GetString(), &result)
+					if err != nil {
+						return tomlError(err), false
+					}
+
+					return newTOMLOrder(md).value(nil, result), true
+				}),
+
+				// stringify(object, {indent}), parsed objects keep their key
+				// order and others are written with sorted keys. Nil values
+				// are left out since TOML has no null.
+				"stringify": vm.NewNativeFunction("stringify", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					objArg, ok := args.Get(0, vm.ValueTypeObject)
+					if !ok {
+						return objArg, false
+					}
+
+					indent, errVal, ok := indentOption("toml", args, 1, 2)
+					if !ok {
+						return errVal, false
+					}
+
+					if _, err := goifyValue(objArg); err != nil {
+						return vm.NewError("toml: "+err.Error(), objArg), false
+					}
+
+					enc := tomlEncoder{indent: strings.Repeat(" ", indent)}
+					if err := enc.table(nil, objArg); err != nil {
+						return vm.NewErrFromErr(err), false
+					}
+
+					return vm.NewString(enc.buf.String()), true
+				}),
+			},
+		)
+	})
+}
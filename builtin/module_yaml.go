@@ -0,0 +1,351 @@
+package builtin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/joetifa2003/weaver/vm"
+)
+
+// yamlAliasRatio bounds how many values a document can expand to through
+// aliases, relative to the number of nodes it has, so documents like the
+// billion laughs attack fail instead of exhausting memory.
+const yamlAliasRatio = 10
+
+// yamlConverter converts decoded nodes, budget is the number of values
+// left before the document is rejected.
+type yamlConverter struct {
+	visiting map[*yaml.Node]bool
+	budget   int
+}
+
+func newYAMLConverter(n *yaml.Node) *yamlConverter {
+	return &yamlConverter{
+		visiting: map[*yaml.Node]bool{},
+		budget:   yamlAliasRatio*yamlNodeCount(n) + 1000,
+	}
+}
+
+// yamlNodeCount counts the nodes of a document without following aliases.
+func yamlNodeCount(n *yaml.Node) int {
+	count := 1
+	for _, child := range n.Content {
+		count += yamlNodeCount(child)
+	}
+	return count
+}
+
+// value converts a decoded node, timestamps become times and merge keys
+// (<<) are resolved, explicit keys win over merged ones.
+func (c *yamlConverter) value(n *yaml.Node) (vm.Value, error) {
+	if c.visiting[n] {
+		return vm.Value{}, fmt.Errorf("yaml: line %d: alias refers to itself", n.Line)
+	}
+	c.budget--
+	if c.budget < 0 {
+		return vm.Value{}, fmt.Errorf("yaml: line %d: document expands to too many values through aliases", n.Line)
+	}
+	c.visiting[n] = true
+	defer delete(c.visiting, n)
+
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return vm.Value{}, nil
+		}
+		return c.value(n.Content[0])
+
+	case yaml.AliasNode:
+		return c.value(n.Alias)
+
+	case yaml.ScalarNode:
+		if n.ShortTag() == "!!timestamp" {
+			var t time.Time
+			if err := n.Decode(&t); err != nil {
+				return vm.Value{}, err
+			}
+			return vm.NewTime(t), nil
+		}
+
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return vm.Value{}, err
+		}
+		return valufiyValue(v), nil
+
+	case yaml.SequenceNode:
+		result := make([]vm.Value, len(n.Content))
+		for i, item := range n.Content {
+			val, err := c.value(item)
+			if err != nil {
+				return vm.Value{}, err
+			}
+			result[i] = val
+		}
+		return vm.NewArray(result), nil
+
+	case yaml.MappingNode:
+		result := yamlMapping{m: map[string]vm.Value{}, keys: []string{}}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, item := n.Content[i], n.Content[i+1]
+
+			val, err := c.value(item)
+			if err != nil {
+				return vm.Value{}, err
+			}
+
+			if key.Kind == yaml.ScalarNode && key.ShortTag() == "!!merge" {
+				if err := result.merge(val, key.Line); err != nil {
+					return vm.Value{}, err
+				}
+				continue
+			}
+
+			if key.Kind != yaml.ScalarNode {
+				return vm.Value{}, fmt.Errorf("yaml: line %d: only scalar keys are supported", key.Line)
+			}
+			result.set(key.Value, val)
+		}
+
+		return vm.NewOrderedObject(result.m, result.keys), nil
+
+	default:
+		return vm.Value{}, fmt.Errorf("yaml: line %d: unsupported node", n.Line)
+	}
+}
+
+// yamlMapping builds an object with the keys in the order they appear.
+type yamlMapping struct {
+	m    map[string]vm.Value
+	keys []string
+}
+
+func (y *yamlMapping) set(k string, v vm.Value) {
+	if _, ok := y.m[k]; !ok {
+		y.keys = append(y.keys, k)
+	}
+	y.m[k] = v
+}
+
+// merge adds the keys of a merged mapping that aren't set yet, keys set
+// explicitly after it still replace them and earlier mappings in a sequence
+// win over later ones.
+func (y *yamlMapping) merge(val vm.Value, line int) error {
+	switch val.VType {
+	case vm.ValueTypeObject:
+		m := val.GetObject()
+		for _, k := range val.ObjectKeys() {
+			if _, ok := y.m[k]; !ok {
+				y.set(k, m[k])
+			}
+		}
+	case vm.ValueTypeArray:
+		for _, item := range *val.GetArray() {
+			if err := y.merge(item, line); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("yaml: line %d: merge value must be a mapping or a sequence of mappings", line)
+	}
+
+	return nil
+}
+
+func parseYAML(data string) ([]vm.Value, error) {
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	docs := []vm.Value{}
+	for {
+		var n yaml.Node
+		err := dec.Decode(&n)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		val, err := newYAMLConverter(&n).value(&n)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, val)
+	}
+
+	return docs, nil
+}
+
+// maxIndent bounds the indent option of the yaml and toml encoders.
+const maxIndent = 16
+
+// indentOption reads the indent option of the object at args[i], def is used
+// when it's missing.
+func indentOption(module string, args vm.NativeFunctionArgs, i int, def int) (int, vm.Value, bool) {
+	if args.Len() <= i {
+		return def, vm.Value{}, true
+	}
+
+	optsArg, ok := args.Get(i, vm.ValueTypeObject)
+	if !ok {
+		return 0, optsArg, false
+	}
+
+	indentArg, ok := optsArg.GetObject()["indent"]
+	if !ok {
+		return def, vm.Value{}, true
+	}
+
+	if errVal, ok := vm.CheckValueType("indent", indentArg, vm.ValueTypeNumber); !ok {
+		return 0, errVal, false
+	}
+
+	n := indentArg.GetNumber()
+	if n < 0 || n > maxIndent || n != float64(int(n)) {
+		return 0, vm.NewError(fmt.Sprintf("%s: indent must be an integer from 0 to %d", module, maxIndent), indentArg), false
+	}
+
+	return int(n), vm.Value{}, true
+}
+
+// yamlNode converts v to a node so objects are written in the order of
+// their keys, v must already be checked by goifyValue.
+func yamlNode(v vm.Value) (*yaml.Node, error) {
+	n := &yaml.Node{}
+	switch v.VType {
+	case vm.ValueTypeObject:
+		n.Kind = yaml.MappingNode
+		m := v.GetObject()
+		for _, k := range v.ObjectKeys() {
+			key := &yaml.Node{}
+			if err := key.Encode(k); err != nil {
+				return nil, err
+			}
+			item, err := yamlNode(m[k])
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, key, item)
+		}
+
+	case vm.ValueTypeArray:
+		n.Kind = yaml.SequenceNode
+		for _, item := range *v.GetArray() {
+			itemNode, err := yamlNode(item)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, itemNode)
+		}
+
+	default:
+		goVal, err := goifyValue(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := n.Encode(goVal); err != nil {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+// stringifyYAML writes each value as a document, parsed objects keep their
+// key order and other objects are written with sorted keys.
+func stringifyYAML(args vm.NativeFunctionArgs, docs []vm.Value) (vm.Value, bool) {
+	indent, errVal, ok := indentOption("yaml", args, 1, 2)
+	if !ok {
+		return errVal, false
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(indent)
+	for _, doc := range docs {
+		if _, err := goifyValue(doc); err != nil {
+			return vm.NewError("yaml: "+err.Error(), doc), false
+		}
+
+		n, err := yamlNode(doc)
+		if err != nil {
+			return vm.NewErrFromErr(err), false
+		}
+
+		if err := enc.Encode(n); err != nil {
+			return vm.NewErrFromErr(err), false
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return vm.NewErrFromErr(err), false
+	}
+
+	return vm.NewString(buf.String()), true
+}
+
+func registerYAMLModule(builder *vm.RegistryBuilder) {
+	builder.RegisterModule("yaml", func() vm.Value {
+		return vm.NewObject(
+			map[string]vm.Value{
+				// parse returns the first document, or nil for an empty stream.
+				// Mappings become objects that keep the key order.
+				"parse": vm.NewNativeFunction("parse", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					dataArg, ok := args.Get(0, vm.ValueTypeString)
+					if !ok {
+						return dataArg, false
+					}
+
+					docs, err := parseYAML(dataArg.GetString())
+					if err != nil {
+						return vm.NewErrFromErr(err), false
+					}
+
+					if len(docs) == 0 {
+						return vm.Value{}, true
+					}
+
+					return docs[0], true
+				}),
+
+				"parseAll": vm.NewNativeFunction("parseAll", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					dataArg, ok := args.Get(0, vm.ValueTypeString)
+					if !ok {
+						return dataArg, false
+					}
+
+					docs, err := parseYAML(dataArg.GetString())
+					if err != nil {
+						return vm.NewErrFromErr(err), false
+					}
+
+					return vm.NewArray(docs), true
+				}),
+
+				// stringify(value, {indent})
+				"stringify": vm.NewNativeFunction("stringify", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					val, ok := args.Get(0)
+					if !ok {
+						return val, false
+					}
+
+					return stringifyYAML(args, []vm.Value{val})
+				}),
+
+				// stringifyAll(docs, {indent}) writes a multi document stream
+				"stringifyAll": vm.NewNativeFunction("stringifyAll", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+					docsArg, ok := args.Get(0, vm.ValueTypeArray)
+					if !ok {
+						return docsArg, false
+					}
+
+					return stringifyYAML(args, *docsArg.GetArray())
+				}),
+			},
+		)
+	})
+}
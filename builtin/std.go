@@ -12,13 +12,29 @@ func init() {
 	registerBuiltinFuncs(builder)
 	registerBuiltinFuncsModules(builder)
 	registerBuiltinFuncsArr(builder)
+	registerBuiltinFuncsIter(builder)
+	registerBuiltinFuncsFmt(builder)
 
 	registerIOModule(builder)
 	registerStringModule(builder)
 	registerJSONModule(builder)
+	registerYAMLModule(builder)
+	registerTOMLModule(builder)
+	registerCSVModule(builder)
+	registerEncodingModule(builder)
+	registerCryptoModule(builder)
+	registerBytesModule(builder)
+	registerCompressModule(builder)
 	registerMathModule(builder)
+	registerArraysModule(builder)
+	registerObjectsModule(builder)
+	registerIterModule(builder)
+	registerRegexModule(builder)
+	registerSchemaModule(builder)
 	registerHTTPModule(builder)
 	registerFiberModule(builder)
+	registerRuntimeModule(builder)
+	registerOSModule(builder)
 	registerTimeModule(builder)
 	registerModuleRL(builder)
 	registerHtmlModule(builder)
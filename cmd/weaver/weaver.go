@@ -24,7 +24,25 @@ func main() {
 			{
 				Name:        "run",
 				Usage:       "run a file",
-				Description: "run [file]",
+				Description: "run [file] [-- args...], the args are available from os.args()",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "no-recover",
+						Usage: "crash on Go panics instead of turning them into errors",
+					},
+					&cli.IntFlag{
+						Name:  "max-concurrency",
+						Usage: "maximum number of tasks running at the same time, 0 for unlimited",
+					},
+					&cli.IntFlag{
+						Name:  "queue-size",
+						Usage: "maximum number of tasks waiting for --max-concurrency, 0 for unlimited",
+					},
+					&cli.BoolFlag{
+						Name:  "race",
+						Usage: "raise an error on unsynchronized access to objects and arrays shared between fibers",
+					},
+				},
 				Action: func(ctx context.Context, cc *cli.Command) error {
 					srcData, err := os.ReadFile(cc.Args().Get(0))
 					if err != nil {
@@ -64,7 +82,15 @@ func main() {
 						return err
 					}
 
-					executor := vm.NewExecutor(builtin.StdReg)
+					executor := vm.NewExecutor(
+						builtin.StdReg,
+						vm.WithPanicRecovery(!cc.Bool("no-recover")),
+						vm.WithRaceDetection(cc.Bool("race")),
+						vm.WithMaxConcurrency(int(cc.Int("max-concurrency"))),
+						vm.WithQueueSize(int(cc.Int("queue-size"))),
+						vm.WithArgs(cc.Args().Tail()),
+						vm.WithExitHandler(os.Exit),
+					)
 
 					v := vm.New(executor)
 
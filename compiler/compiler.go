@@ -21,11 +21,28 @@ type Compiler struct {
 type frameContext struct {
 	labels    map[string]int
 	constants []vm.Value
+	tries     []tryContext
+}
+
+// tryContext describes a try block that must be unwound
+// when return, break or continue jumps out of it.
+type tryContext struct {
+	handler bool
+	finally *finallyContext
+}
+
+// finallyContext is a finally block compiled once, paths are the labels
+// it jumps back to, indexed by the code stored in resume.
+type finallyContext struct {
+	label  int
+	resume ir.Var
+	paths  []int
 }
 
 type loopContext struct {
 	loopStart int
 	loopEnd   int
+	tryDepth  int
 }
 
 func New(reg *vm.Registry) *Compiler {
@@ -117,6 +134,9 @@ func (c *Compiler) handleLabels(instructions []opcode.OpCode) []opcode.OpCode {
 
 		case opcode.OP_JUMP_F:
 			instr.Args[0] = labels[instr.Args[0]]
+
+		case opcode.OP_TRY:
+			instr.Args[0] = labels[instr.Args[0]]
 		}
 
 		newInstructions = append(newInstructions, instr.Op)
@@ -176,13 +196,14 @@ func (c *Compiler) compileStmt(s ir.Statement) ([]opcode.OpCode, error) {
 
 	case ir.BreakStmt:
 		loop := c.currentLoop()
-		return []opcode.OpCode{
-			opcode.OP_JUMP,
-			opcode.OpCode(loop.loopEnd),
-		}, nil
+
+		instructions := c.unwindTries(loop.tryDepth)
+		instructions = append(instructions, opcode.OP_JUMP, opcode.OpCode(loop.loopEnd))
+
+		return instructions, nil
 
 	case ir.ContinueStmt:
-		var instructions []opcode.OpCode
+		instructions := c.unwindTries(c.currentLoop().tryDepth)
 
 		if s.IncrementStatement != nil {
 			incr, err := c.compileStmt(s.IncrementStatement)
@@ -238,6 +259,22 @@ func (c *Compiler) compileStmt(s ir.Statement) ([]opcode.OpCode, error) {
 
 		return instructions, nil
 
+	case ir.TryStmt:
+		return c.compileTryStmt(s)
+
+	case ir.DeferStmt:
+		var instructions []opcode.OpCode
+
+		expr, err := c.compileExpr(s.Expr)
+		if err != nil {
+			return nil, err
+		}
+
+		instructions = append(instructions, expr...)
+		instructions = append(instructions, opcode.OP_DEFER)
+
+		return instructions, nil
+
 	case ir.ExpressionStmt:
 		var instructions []opcode.OpCode
 
@@ -259,16 +296,21 @@ func (c *Compiler) compileStmt(s ir.Statement) ([]opcode.OpCode, error) {
 func (c *Compiler) compileExpr(e ir.Expr) ([]opcode.OpCode, error) {
 	switch e := e.(type) {
 	case ir.TryExpr:
+		// the raised error replaces the value of the expression
 		var instructions []opcode.OpCode
+		endLabel := c.label()
 
+		c.pushTry(tryContext{handler: true})
 		expr, err := c.compileExpr(e.Expr)
+		c.popTry()
 		if err != nil {
 			return nil, err
 		}
 
-		instructions = append(instructions, opcode.OP_TRY)
+		instructions = append(instructions, opcode.OP_TRY, opcode.OpCode(endLabel))
 		instructions = append(instructions, expr...)
-		instructions = append(instructions, opcode.OP_TRY)
+		instructions = append(instructions, opcode.OP_TRY_END)
+		instructions = append(instructions, opcode.OP_LABEL, opcode.OpCode(endLabel))
 
 		return instructions, nil
 
@@ -293,7 +335,10 @@ func (c *Compiler) compileExpr(e ir.Expr) ([]opcode.OpCode, error) {
 			return nil, err
 		}
 
+		unwind := c.unwindTries(0)
+
 		instructions = append(instructions, expr...)
+		instructions = append(instructions, unwind...)
 		instructions = append(instructions, opcode.OP_RET)
 
 		return instructions, nil
@@ -732,6 +777,7 @@ func (c *Compiler) beginLoop(begin int, end int) {
 	c.loopContext.Push(loopContext{
 		loopStart: begin,
 		loopEnd:   end,
+		tryDepth:  len(c.currentFrameContext().tries),
 	})
 }
 
@@ -743,6 +789,176 @@ func (c *Compiler) currentLoop() loopContext {
 	return c.loopContext.Peek()
 }
 
+// compileTryStmt compiles try/catch/finally to the following layout,
+// the finally body is compiled once and every path that runs it stores
+// its code in the resume variable:
+//
+//	try catch
+//	  body
+//	tryend
+//	resume 0; jmp finally
+//	catch:        (error on the stack)
+//	  try fail    (only with finally)
+//	  store error; pop
+//	  catch body
+//	  tryend      (only with finally)
+//	  resume 0; jmp finally
+//	fail:         (only with finally)
+//	  resume 1; jmp finally
+//	finally:
+//	  finally body
+//	  jump to the path matching resume: 0 ends, 1 raises,
+//	  others continue a return, break or continue
+//	end:
+func (c *Compiler) compileTryStmt(s ir.TryStmt) ([]opcode.OpCode, error) {
+	var instructions []opcode.OpCode
+
+	catchLabel := c.label()
+	failLabel := c.label()
+	endLabel := c.label()
+
+	var finally *finallyContext
+	if s.Finally != nil {
+		finally = &finallyContext{
+			label:  c.label(),
+			resume: *s.Resume,
+			paths:  []int{endLabel, c.label()},
+		}
+	}
+
+	// leave jumps to the end of the statement, through finally if there's one
+	leave := []opcode.OpCode{opcode.OP_JUMP, opcode.OpCode(endLabel)}
+	if finally != nil {
+		leave = c.enterFinally(finally, 0)
+	}
+
+	c.pushTry(tryContext{handler: true, finally: finally})
+	body, err := c.compileStmt(s.Body)
+	c.popTry()
+	if err != nil {
+		return nil, err
+	}
+
+	instructions = append(instructions, opcode.OP_TRY, opcode.OpCode(catchLabel))
+	instructions = append(instructions, body...)
+	instructions = append(instructions, opcode.OP_TRY_END)
+	instructions = append(instructions, leave...)
+	instructions = append(instructions, opcode.OP_LABEL, opcode.OpCode(catchLabel))
+
+	if s.Catch != nil {
+		if finally != nil {
+			instructions = append(instructions, opcode.OP_TRY, opcode.OpCode(failLabel))
+		}
+
+		if s.CatchVar != nil {
+			instructions = append(instructions, c.storeVar(*s.CatchVar)...)
+		}
+		instructions = append(instructions, opcode.OP_POP)
+
+		if finally != nil {
+			c.pushTry(tryContext{handler: true, finally: finally})
+		}
+		catch, err := c.compileStmt(*s.Catch)
+		if finally != nil {
+			c.popTry()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		instructions = append(instructions, catch...)
+		if finally != nil {
+			instructions = append(instructions, opcode.OP_TRY_END)
+		}
+		instructions = append(instructions, leave...)
+	}
+
+	if finally != nil {
+		body, err := c.compileStmt(*s.Finally)
+		if err != nil {
+			return nil, err
+		}
+
+		instructions = append(instructions, opcode.OP_LABEL, opcode.OpCode(failLabel))
+		instructions = append(instructions, c.enterFinally(finally, 1)...)
+		instructions = append(instructions, opcode.OP_LABEL, opcode.OpCode(finally.label))
+		instructions = append(instructions, body...)
+
+		// paths are only complete here, after the body and catch registered theirs
+		for i, path := range finally.paths {
+			if i == len(finally.paths)-1 {
+				instructions = append(instructions, opcode.OP_JUMP, opcode.OpCode(path))
+				break
+			}
+
+			instructions = append(instructions, c.loadVar(finally.resume, opcode.OP_LOAD)...)
+			instructions = append(instructions, c.loadConstant(float64(i))...)
+			instructions = append(instructions, opcode.OP_EQ, opcode.OP_PJUMP_T, opcode.OpCode(path))
+		}
+
+		instructions = append(instructions, opcode.OP_LABEL, opcode.OpCode(finally.paths[1]))
+		instructions = append(instructions, opcode.OP_RAISE)
+	}
+
+	instructions = append(instructions, opcode.OP_LABEL, opcode.OpCode(endLabel))
+
+	return instructions, nil
+}
+
+// enterFinally stores the code of path in the resume variable and jumps
+// to the finally block.
+func (c *Compiler) enterFinally(f *finallyContext, path int) []opcode.OpCode {
+	var instructions []opcode.OpCode
+	instructions = append(instructions, c.loadConstant(float64(path))...)
+	instructions = append(instructions, c.storeVar(f.resume)...)
+	instructions = append(instructions, opcode.OP_POP)
+	instructions = append(instructions, opcode.OP_JUMP, opcode.OpCode(f.label))
+	return instructions
+}
+
+func (c *Compiler) loadConstant(n float64) []opcode.OpCode {
+	return []opcode.OpCode{
+		opcode.OP_LOAD,
+		opcode.ScopeTypeConst,
+		opcode.OpCode(c.defineConstant(vm.NewNumber(n))),
+	}
+}
+
+func (c *Compiler) pushTry(t tryContext) {
+	fc := c.currentFrameContext()
+	fc.tries = append(fc.tries, t)
+}
+
+func (c *Compiler) popTry() {
+	fc := c.currentFrameContext()
+	fc.tries = fc.tries[:len(fc.tries)-1]
+}
+
+// unwindTries returns the instructions that leave every try block above depth,
+// popping their handlers and running their finally blocks from the innermost one.
+func (c *Compiler) unwindTries(depth int) []opcode.OpCode {
+	var instructions []opcode.OpCode
+
+	tries := c.currentFrameContext().tries
+	for i := len(tries) - 1; i >= depth; i-- {
+		t := tries[i]
+
+		if t.handler {
+			instructions = append(instructions, opcode.OP_TRY_END)
+		}
+
+		if t.finally != nil {
+			path := c.label()
+			t.finally.paths = append(t.finally.paths, path)
+
+			instructions = append(instructions, c.enterFinally(t.finally, len(t.finally.paths)-1)...)
+			instructions = append(instructions, opcode.OP_LABEL, opcode.OpCode(path))
+		}
+	}
+
+	return instructions
+}
+
 func (c *Compiler) loadVar(v ir.Var, op opcode.OpCode) []opcode.OpCode {
 	switch v.Scope {
 	case ir.VarScopeLocal:
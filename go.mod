@@ -3,18 +3,21 @@ module github.com/joetifa2003/weaver
 go 1.26
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/gen2brain/raylib-go/raylib v0.55.1
 	github.com/go-chi/chi/v5 v5.2.1
 	github.com/stretchr/testify v1.10.0
+	github.com/tetratelabs/wazero v1.11.0
 	github.com/urfave/cli/v3 v3.3.8
+	golang.org/x/crypto v0.54.0
+	golang.org/x/text v0.40.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/ebitengine/purego v0.8.4 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/tetratelabs/wazero v1.11.0 // indirect
 	golang.org/x/exp v0.0.0-20250606033433-dcc06ee1d476 // indirect
-	golang.org/x/sys v0.38.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.47.0 // indirect
 )
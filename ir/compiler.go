@@ -3,6 +3,7 @@ package ir
 import (
 	"errors"
 	"fmt"
+	"regexp"
 
 	"github.com/joetifa2003/weaver/ast"
 	"github.com/joetifa2003/weaver/internal/pkg/ds"
@@ -256,6 +257,110 @@ func (c *Compiler) CompileStmt(s ast.Statement) (Statement, error) {
 			Body: s.Body,
 		})
 
+	case ast.ForInStmt:
+		// for (x in expr) pulls values from __iterPull(expr) and stops the
+		// iterator in a finally block, so break, return and errors release it.
+		outer := c.currentFrame().pushBlock()
+
+		e, err := c.CompileExpr(s.Expr)
+		if err != nil {
+			return nil, err
+		}
+
+		it := c.currentFrame().define("")
+		outer.pushStmt(it.assignStmt(
+			irCall(irBuiltIn("__iterPull"), e),
+		))
+
+		inner := c.currentFrame().pushBlock()
+
+		variable := c.currentFrame().define(s.Variable)
+
+		c.loopContext.Push(loopContext{
+			loopType: loopTypeWhile,
+		})
+
+		body, err := c.CompileStmt(s.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		c.loopContext.Pop()
+
+		inner.pushStmt(IfStmt{
+			Condition: UnaryExpr{
+				Expr:     irCall(irIndex(it.load(), irString("next"))),
+				Operator: UnaryOpNot,
+			},
+			Body: BreakStmt{},
+		})
+		inner.pushStmt(variable.assignStmt(irCall(irIndex(it.load(), irString("value")))))
+		inner.pushStmt(body)
+		loop := LoopStmt{c.currentFrame().popBlock().export()}
+
+		resume := c.currentFrame().define("").export()
+		outer.pushStmt(TryStmt{
+			Body: loop,
+			Finally: stmtPointer(ExpressionStmt{
+				irCall(irIndex(it.load(), irString("stop"))),
+			}),
+			Resume: &resume,
+		})
+
+		return c.currentFrame().popBlock().export(), nil
+
+	case ast.TryStmt:
+		body, err := c.CompileStmt(s.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		res := TryStmt{Body: body}
+
+		if s.Catch != nil {
+			b := c.currentFrame().pushBlock()
+
+			if s.CatchVar != nil {
+				v := c.currentFrame().define(*s.CatchVar).export()
+				res.CatchVar = &v
+			}
+
+			catch, err := c.CompileStmt(*s.Catch)
+			if err != nil {
+				return nil, err
+			}
+			b.pushStmt(catch)
+
+			res.Catch = stmtPointer(c.currentFrame().popBlock().export())
+		}
+
+		if s.Finally != nil {
+			finally, err := c.CompileStmt(*s.Finally)
+			if err != nil {
+				return nil, err
+			}
+
+			res.Finally = &finally
+			resume := c.currentFrame().define("").export()
+			res.Resume = &resume
+		}
+
+		return res, nil
+
+	case ast.DeferStmt:
+		fn, err := c.CompileExpr(ast.FunctionExpr{
+			Body: ast.BlockStmt{
+				Statements: []ast.Statement{
+					ast.ExprStmt{Expr: s.Expr},
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return DeferStmt{Expr: fn}, nil
+
 	case ast.MatchStmt:
 		outer := c.currentFrame().pushBlock()
 
@@ -395,6 +500,15 @@ func (c *Compiler) compileMatchCondition(cond ast.MatchCaseCondition, expr Expr)
 			res.Operands = append(res.Operands, detailsCond)
 		}
 
+		if cond.Cause != nil {
+			causeExpr := irIndex(expr, irString("cause"))
+			causeCond, err := c.compileMatchCondition(cond.Cause, causeExpr)
+			if err != nil {
+				return nil, err
+			}
+			res.Operands = append(res.Operands, causeCond)
+		}
+
 		return res, nil
 
 	case ast.MatchCaseTypeString:
@@ -427,6 +541,42 @@ func (c *Compiler) compileMatchCondition(cond ast.MatchCaseCondition, expr Expr)
 
 		return res, nil
 
+	case ast.MatchCaseRegex:
+		if _, err := regexp.Compile(cond.Pattern); err != nil {
+			return nil, err
+		}
+
+		// object conditions bind the named groups, anything else gets
+		// the array of all groups
+		named := false
+		if cond.Cond != nil {
+			_, named = (*cond.Cond).(ast.MatchCaseObject)
+		}
+
+		v := c.currentFrame().define("")
+		res := irAnd(
+			irHasType(expr, "string"),
+			irOrTrue(
+				v.assign(
+					irCall(
+						irBuiltIn("__regexMatch"),
+						irString(cond.Pattern), expr, BoolExpr{Value: named},
+					),
+				),
+			),
+			irNeq(v.load(), NilExpr{}),
+		)
+
+		if cond.Cond != nil {
+			child, err := c.compileMatchCondition(*cond.Cond, v.load())
+			if err != nil {
+				return nil, err
+			}
+			res.Operands = append(res.Operands, child)
+		}
+
+		return res, nil
+
 	case ast.MatchCaseRange:
 		begin, err := c.CompileExpr(cond.Begin)
 		if err != nil {
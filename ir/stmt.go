@@ -128,3 +128,46 @@ func (t GotoStmt) stmt() {}
 func (t GotoStmt) String(i int) string {
 	return fmt.Sprintf("goto %s", t.Name)
 }
+
+type TryStmt struct {
+	Body     Statement
+	CatchVar *Var
+	Catch    *Statement
+	Finally  *Statement
+	// Resume records which path entered the finally block,
+	// so it's compiled once and jumps back to that path.
+	Resume *Var
+}
+
+func (t TryStmt) stmt() {}
+
+func (t TryStmt) String(i int) string {
+	var b strings.Builder
+	b.WriteString("try ")
+	b.WriteString(t.Body.String(i))
+
+	if t.Catch != nil {
+		b.WriteString(" catch ")
+		if t.CatchVar != nil {
+			b.WriteString(fmt.Sprintf("(%s) ", *t.CatchVar))
+		}
+		b.WriteString((*t.Catch).String(i))
+	}
+
+	if t.Finally != nil {
+		b.WriteString(" finally ")
+		b.WriteString((*t.Finally).String(i))
+	}
+
+	return b.String()
+}
+
+type DeferStmt struct {
+	Expr Expr
+}
+
+func (t DeferStmt) stmt() {}
+
+func (t DeferStmt) String(i int) string {
+	return fmt.Sprintf("defer %s", t.Expr.String(i))
+}
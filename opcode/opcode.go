@@ -56,7 +56,9 @@ const (
 	OP_NOT // !
 	OP_NEG // -
 
-	OP_TRY // try
+	OP_TRY     // arg1: handler address
+	OP_TRY_END // pop the innermost try handler
+	OP_DEFER   // push a deferred function to the current frame
 
 	OP_ECHO
 	OP_EMPTY_FUNC
@@ -105,7 +107,9 @@ type OpCodeDef struct {
 }
 
 var opCodeDefs = map[OpCode]OpCodeDef{
-	OP_TRY:          {OP_TRY, "try", 0},
+	OP_TRY:          {OP_TRY, "try", 1},
+	OP_TRY_END:      {OP_TRY_END, "tryend", 0},
+	OP_DEFER:        {OP_DEFER, "defer", 0},
 	OP_RAISE:        {OP_RAISE, "raise", 0},
 	OP_POP:          {OP_POP, "pop", 0},
 	OP_CALL:         {OP_CALL, "call", 1},
@@ -171,3 +171,29 @@ func TestFunctionExpr(t *testing.T) {
 		)
 	})
 }
+
+func TestTryStmt(t *testing.T) {
+	assert := require.New(t)
+
+	p := tryStmt()
+	s, err := pargo.Parse(p, newLexer(), "try { x } catch (e) { y } finally { z }")
+	require.NoError(t, err)
+
+	tryStmt, ok := s.(ast.TryStmt)
+	assert.True(ok)
+	assert.NotNil(tryStmt.CatchVar)
+	assert.Equal("e", *tryStmt.CatchVar)
+	assert.NotNil(tryStmt.Catch)
+	assert.NotNil(tryStmt.Finally)
+
+	s, err = pargo.Parse(p, newLexer(), "try { x } finally { z }")
+	require.NoError(t, err)
+
+	tryStmt, ok = s.(ast.TryStmt)
+	assert.True(ok)
+	assert.Nil(tryStmt.Catch)
+	assert.NotNil(tryStmt.Finally)
+
+	_, err = pargo.Parse(p, newLexer(), "try { x }")
+	require.Error(t, err)
+}
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"errors"
+
 	"github.com/joetifa2003/weaver/ast"
 	"github.com/joetifa2003/weaver/internal/pargo"
 )
@@ -78,6 +80,22 @@ func forStmt() pargo.Parser[ast.Statement] {
 				}
 			},
 		),
+		pargo.Sequence7(
+			pargo.Exactly("for"),
+			pargo.Exactly("("),
+			pargo.TokenType(TT_IDENT),
+			pargo.Exactly("in"),
+			pargo.Lazy(expr),
+			pargo.Exactly(")"),
+			pargo.Lazy(stmt),
+			func(_, _ string, variable string, _ string, e ast.Expr, _ string, body ast.Statement) ast.Statement {
+				return ast.ForInStmt{
+					Variable: variable,
+					Expr:     e,
+					Body:     body,
+				}
+			},
+		),
 	)
 }
 
@@ -191,6 +209,7 @@ func matchConditionBase() pargo.Parser[ast.MatchCaseCondition] {
 		matchCaseTypeError(),
 		matchCaseTypeNumber(),
 		matchCaseTypeString(),
+		matchCaseRegex(),
 		matchRangeCondition(),
 		matchCaseInt(),
 		matchCaseFloat(),
@@ -319,6 +338,27 @@ func matchCaseType(typ string, f func(childCond *ast.MatchCaseCondition) ast.Mat
 	)
 }
 
+func matchCaseRegex() pargo.Parser[ast.MatchCaseCondition] {
+	return pargo.Sequence5(
+		pargo.Exactly("regex"),
+		pargo.Exactly("("),
+		pargo.TokenType(TT_STRING),
+		pargo.Optional(
+			pargo.Sequence2(
+				pargo.Exactly(","),
+				pargo.Lazy(matchCondition),
+				func(_ string, cond ast.MatchCaseCondition) ast.MatchCaseCondition {
+					return cond
+				},
+			),
+		),
+		pargo.Exactly(")"),
+		func(_ string, _ string, pattern string, cond *ast.MatchCaseCondition, _ string) ast.MatchCaseCondition {
+			return ast.MatchCaseRegex{Pattern: pattern, Cond: cond}
+		},
+	)
+}
+
 func matchCaseTypeError() pargo.Parser[ast.MatchCaseCondition] {
 	return pargo.OneOf(
 		// error() with no arguments
@@ -342,6 +382,24 @@ func matchCaseTypeError() pargo.Parser[ast.MatchCaseCondition] {
 				}
 			},
 		),
+		// error(msg, details, cause) with three arguments
+		pargo.Sequence8(
+			pargo.Exactly("error"),
+			pargo.Exactly("("),
+			pargo.Lazy(matchCondition),
+			pargo.Exactly(","),
+			pargo.Lazy(matchCondition),
+			pargo.Exactly(","),
+			pargo.Lazy(matchCondition),
+			pargo.Exactly(")"),
+			func(kw, lp string, msgCond ast.MatchCaseCondition, _ string, detailsCond ast.MatchCaseCondition, _ string, causeCond ast.MatchCaseCondition, rp string) ast.MatchCaseCondition {
+				return ast.MatchCaseTypeError{
+					Message: msgCond,
+					Data:    detailsCond,
+					Cause:   causeCond,
+				}
+			},
+		),
 		// error(msg, details) with two arguments
 		pargo.Sequence6(
 			pargo.Exactly("error"),
@@ -402,6 +460,76 @@ func gotoStmt() pargo.Parser[ast.Statement] {
 	)
 }
 
+type catchClause struct {
+	name *string
+	body ast.Statement
+}
+
+var errTryWithoutHandler = errors.New("try statement must have a catch or finally block")
+
+func tryStmt() pargo.Parser[ast.Statement] {
+	return pargo.Map(
+		pargo.Sequence4(
+			pargo.Exactly("try"),
+			blockStmt(),
+			pargo.Optional(
+				pargo.Sequence3(
+					pargo.Exactly("catch"),
+					pargo.Optional(
+						pargo.Sequence3(
+							pargo.Exactly("("),
+							pargo.TokenType(TT_IDENT),
+							pargo.Exactly(")"),
+							func(_ string, name string, _ string) string {
+								return name
+							},
+						),
+					),
+					blockStmt(),
+					func(_ string, name *string, body ast.Statement) catchClause {
+						return catchClause{name, body}
+					},
+				),
+			),
+			pargo.Optional(
+				pargo.Sequence2(
+					pargo.Exactly("finally"),
+					blockStmt(),
+					func(_ string, body ast.Statement) ast.Statement {
+						return body
+					},
+				),
+			),
+			func(_ string, body ast.Statement, catch *catchClause, finally *ast.Statement) ast.TryStmt {
+				res := ast.TryStmt{Body: body, Finally: finally}
+				if catch != nil {
+					res.CatchVar = catch.name
+					res.Catch = &catch.body
+				}
+				return res
+			},
+		),
+		func(s ast.TryStmt) (ast.Statement, error) {
+			if s.Catch == nil && s.Finally == nil {
+				return nil, errTryWithoutHandler
+			}
+
+			return s, nil
+		},
+	)
+}
+
+func deferStmt() pargo.Parser[ast.Statement] {
+	return pargo.Sequence3(
+		pargo.Exactly("defer"),
+		expr(),
+		pargo.Optional(pargo.Exactly(";")),
+		func(_ string, expr ast.Expr, _ *string) ast.Statement {
+			return ast.DeferStmt{Expr: expr}
+		},
+	)
+}
+
 func stmt() pargo.Parser[ast.Statement] {
 	return pargo.OneOf(
 		varDeclStmt(),
@@ -414,6 +542,8 @@ func stmt() pargo.Parser[ast.Statement] {
 		matchStmt(),
 		labelStmt(),
 		gotoStmt(),
+		tryStmt(),
+		deferStmt(),
 
 		// keep this at the end
 		exprStmt(),
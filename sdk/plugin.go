@@ -24,6 +24,9 @@ func valueNewNumber(val float64) int32
 //go:wasmimport weaver value_new_string
 func valueNewString(ptr int32, length int32) int32
 
+//go:wasmimport weaver value_new_bytes
+func valueNewBytes(ptr int32, length int32) int32
+
 //go:wasmimport weaver value_new_object
 func valueNewObject() int32
 
@@ -48,6 +51,9 @@ func valueGetNumber(handle int32) float64
 //go:wasmimport weaver value_get_string
 func valueGetString(handle int32, ptr int32, maxLen int32) int32
 
+//go:wasmimport weaver value_get_bytes
+func valueGetBytes(handle int32, ptr int32, maxLen int32) int32
+
 //go:wasmimport weaver value_get_bool
 func valueGetBool(handle int32) int32
 
@@ -109,6 +115,7 @@ const (
 	TypeObject = 3
 	TypeBool   = 4
 	TypeArray  = 6
+	TypeBytes  = 16
 )
 
 // Constructors
@@ -144,6 +151,17 @@ func String(s string) Value {
 	return Value{h}
 }
 
+// Bytes creates a bytes value handle, the data is copied.
+func Bytes(b []byte) Value {
+	if len(b) == 0 {
+		return Value{valueNewBytes(0, 0)}
+	}
+	ptr := int32(uintptr(unsafe.Pointer(&b[0])))
+	h := valueNewBytes(ptr, int32(len(b)))
+	runtime.KeepAlive(b)
+	return Value{h}
+}
+
 // Object creates an empty object value handle.
 func Object() Value {
 	return Value{valueNewObject()}
@@ -221,6 +239,20 @@ func (v Value) AsString() string {
 	return string(buf)
 }
 
+// AsBytes reads the bytes value from this handle, strings are returned as
+// their UTF-8 bytes.
+func (v Value) AsBytes() []byte {
+	l := valueGetBytes(v.handle, 0, 0)
+	if l <= 0 {
+		return nil
+	}
+	buf := make([]byte, l)
+	ptr := int32(uintptr(unsafe.Pointer(&buf[0])))
+	valueGetBytes(v.handle, ptr, l)
+	runtime.KeepAlive(buf)
+	return buf
+}
+
 // AsBool reads the bool value from this handle.
 func (v Value) AsBool() bool {
 	return valueGetBool(v.handle) != 0
@@ -43,6 +43,7 @@ const (
 	TypeObject = 3
 	TypeBool   = 4
 	TypeArray  = 6
+	TypeBytes  = 16
 )
 
 func Nil() Value {
@@ -61,6 +62,10 @@ func String(s string) Value {
 	panic("sdk can only be used in a wasip1 environment")
 }
 
+func Bytes(b []byte) Value {
+	panic("sdk can only be used in a wasip1 environment")
+}
+
 func Object() Value {
 	panic("sdk can only be used in a wasip1 environment")
 }
@@ -101,6 +106,10 @@ func (v Value) AsString() string {
 	panic("sdk can only be used in a wasip1 environment")
 }
 
+func (v Value) AsBytes() []byte {
+	panic("sdk can only be used in a wasip1 environment")
+}
+
 func (v Value) AsBool() bool {
 	panic("sdk can only be used in a wasip1 environment")
 }
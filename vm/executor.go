@@ -1,7 +1,11 @@
 package vm
 
 import (
+	"context"
+	"fmt"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	"github.com/joetifa2003/weaver/internal/pkg/pool"
 )
@@ -10,67 +14,365 @@ type Executor struct {
 	l    sync.RWMutex
 	Reg  *Registry
 	Pool *pool.Pool[*VM]
+
+	recoverPanics bool
+	raceDetection bool
+	options       []ExecutorOption
+	args          []string
+	exit          func(code int)
+
+	modulesLock sync.Mutex
+	modules     map[string]*moduleEntry
+
+	maxConcurrency int
+	queueSize      int
+	scheduler      *scheduler
+	metrics        executorMetrics
+}
+
+type ExecutorOption func(e *Executor)
+
+// WithPanicRecovery controls whether Go panics inside natives and the VM are
+// turned into weaver errors, it's enabled by default.
+// Disable it to crash with the original panic when debugging.
+func WithPanicRecovery(enabled bool) ExecutorOption {
+	return func(e *Executor) {
+		e.recoverPanics = enabled
+	}
+}
+
+// WithRaceDetection makes unsynchronized access to objects and arrays
+// shared between fibers raise an error instead of corrupting them or crashing,
+// it's meant for debugging and slows down indexing.
+func WithRaceDetection(enabled bool) ExecutorOption {
+	return func(e *Executor) {
+		e.raceDetection = enabled
+	}
+}
+
+// WithArgs sets the command-line arguments scripts get from os.args.
+func WithArgs(args []string) ExecutorOption {
+	return func(e *Executor) {
+		e.args = slices.Clone(args)
+	}
+}
+
+// WithExitHandler sets what os.exit calls, the weaver CLI passes os.Exit.
+// Without one os.exit only raises an error, so scripts can't exit the host
+// process.
+func WithExitHandler(exit func(code int)) ExecutorOption {
+	return func(e *Executor) {
+		e.exit = exit
+	}
 }
 
-func NewExecutor(reg *Registry) *Executor {
+func NewExecutor(reg *Registry, options ...ExecutorOption) *Executor {
 	e := &Executor{
-		Reg: reg,
+		Reg:           reg,
+		recoverPanics: true,
+		options:       options,
+		modules:       map[string]*moduleEntry{},
+	}
+	for _, option := range options {
+		option(e)
 	}
+
 	e.Pool = pool.New(func() *VM {
+		e.metrics.vms.Add(1)
 		return New(e)
 	})
 
+	if e.maxConcurrency > 0 {
+		e.scheduler = newScheduler(e.maxConcurrency, e.queueSize, &e.metrics)
+	}
+
 	return e
 }
 
+// WithMaxConcurrency limits how many tasks run at the same time,
+// tasks started past the limit wait in a queue, it's unlimited by default.
+// Tasks waiting on tasks that are still queued can deadlock when every slot is taken.
+func WithMaxConcurrency(n int) ExecutorOption {
+	return func(e *Executor) {
+		e.maxConcurrency = n
+	}
+}
+
+// WithQueueSize limits how many tasks can wait for WithMaxConcurrency,
+// starting a task blocks while the queue is full, it's unlimited by default.
+func WithQueueSize(n int) ExecutorOption {
+	return func(e *Executor) {
+		e.queueSize = n
+	}
+}
+
+// Fork returns a new executor with the same registry and options,
+// it doesn't share imported modules or VMs with e.
+func (e *Executor) Fork() *Executor {
+	return NewExecutor(e.Reg, e.options...)
+}
+
+// Args returns the arguments set with WithArgs.
+func (e *Executor) Args() []string {
+	return slices.Clone(e.args)
+}
+
+// Exit calls the exit handler if one is set, it returns when the handler does.
+func (e *Executor) Exit(code int) {
+	if e.exit != nil {
+		e.exit(code)
+	}
+}
+
+// moduleEntry is a module that's loaded or being loaded,
+// done is closed when load returns.
+type moduleEntry struct {
+	done   chan struct{}
+	loader *VM
+	val    Value
+	ok     bool
+}
+
+// Module returns the module imported as name, load is called on v to create it
+// the first time, modules are cached per executor.
+// Other imports of name wait for the first load, a failed load isn't cached.
+func (e *Executor) Module(v *VM, name string, load func() (Value, bool)) (Value, bool) {
+	e.modulesLock.Lock()
+	if entry, ok := e.modules[name]; ok {
+		loader := entry.loader
+		e.modulesLock.Unlock()
+
+		if loader == v {
+			return NewError(fmt.Sprintf("import cycle while importing %s", name), Value{}), false
+		}
+
+		select {
+		case <-entry.done:
+			return entry.val, entry.ok
+		case <-v.Ctx.Done():
+			return NewCancelled(), false
+		}
+	}
+
+	entry := &moduleEntry{done: make(chan struct{}), loader: v}
+	e.modules[name] = entry
+	e.modulesLock.Unlock()
+
+	entry.val, entry.ok = load()
+
+	e.modulesLock.Lock()
+	entry.loader = nil
+	if !entry.ok {
+		delete(e.modules, name)
+	}
+	e.modulesLock.Unlock()
+	close(entry.done)
+
+	return entry.val, entry.ok
+}
+
 func (e *Executor) Run(function Value, args ...Value) *ExecutorTask {
+	return e.RunContext(context.Background(), function, args...)
+}
+
+// RunContext runs function in a new task that is cancelled when ctx is done,
+// pass the VM context to cancel the task with the task that started it.
+func (e *Executor) RunContext(ctx context.Context, function Value, args ...Value) *ExecutorTask {
+	return e.RunWithOptions(ctx, TaskOptions{}, function, args...)
+}
+
+type TaskOptions struct {
+	// Priority orders tasks waiting for WithMaxConcurrency, higher runs first.
+	Priority int
+}
+
+// RunWithOptions is RunContext with per task options, when the executor
+// queue is full it blocks until there's room or ctx is done.
+func (e *Executor) RunWithOptions(ctx context.Context, opts TaskOptions, function Value, args ...Value) *ExecutorTask {
+	// args may point into the caller's stack which keeps running.
+	args = slices.Clone(args)
+
+	task := newExecutorTask()
+	stop := context.AfterFunc(ctx, task.Cancel)
+
+	if e.scheduler == nil {
+		e.metrics.active.Add(1)
+		go e.runTask(task, stop, function, args)
+		return task
+	}
+
+	queued := e.scheduler.enqueue(ctx, opts.Priority, func() {
+		defer e.scheduler.done()
+		e.runTask(task, stop, function, args)
+	})
+	if !queued {
+		task.Cancel()
+		e.metrics.active.Add(1)
+		go e.runTask(task, stop, function, args)
+	}
+
+	return task
+}
+
+// runTask runs a task that's counted as active.
+func (e *Executor) runTask(task *ExecutorTask, stop func() bool, function Value, args []Value) {
+	defer close(task.exited)
+	defer stop()
+	defer e.metrics.active.Add(-1)
+
+	// cancelled while waiting in the queue
+	if task.isDone() {
+		e.metrics.failed.Add(1)
+		return
+	}
+
 	v := e.Pool.Get()
+	defer e.Pool.Put(v)
 	v.Resurrect()
+	if !task.setVM(v) {
+		e.metrics.failed.Add(1)
+		return
+	}
 
-	task := newExecutorTask(v)
-	go func() {
-		defer e.Pool.Put(v)
-		task.Complete(v.RunFunction(function, args...))
-	}()
+	val, ok := v.RunFunction(function, args...)
+	task.endVM(v)
 
-	return task
+	if ok {
+		e.metrics.completed.Add(1)
+	} else {
+		e.metrics.failed.Add(1)
+	}
+
+	task.Complete(val, ok)
+}
+
+// Metrics returns a snapshot of the executor's task counters.
+func (e *Executor) Metrics() ExecutorMetrics {
+	return ExecutorMetrics{
+		Active:    int(e.metrics.active.Load()),
+		Queued:    int(e.metrics.queued.Load()),
+		Completed: int(e.metrics.completed.Load()),
+		Failed:    int(e.metrics.failed.Load()),
+		PoolSize:  int(e.metrics.vms.Load()),
+	}
+}
+
+type ExecutorMetrics struct {
+	// Active is the number of running tasks.
+	Active int
+	// Queued is the number of tasks waiting for WithMaxConcurrency.
+	Queued int
+	// Completed is the number of tasks that returned without an error.
+	Completed int
+	// Failed is the number of tasks that raised an error or were cancelled.
+	Failed int
+	// PoolSize is the number of VMs the executor has allocated.
+	PoolSize int
+}
+
+type executorMetrics struct {
+	active    atomic.Int64
+	queued    atomic.Int64
+	completed atomic.Int64
+	failed    atomic.Int64
+	vms       atomic.Int64
 }
 
 type ExecutorTask struct {
-	done chan struct{}
-	vm   *VM
-	once *sync.Once
-	val  Value
-	ok   bool
+	done   chan struct{}
+	exited chan struct{}
+	once   *sync.Once
+
+	// mu makes setting vm and cancelling atomic, so a task is either
+	// cancelled before it starts or its VM gets stopped.
+	mu sync.Mutex
+	vm *VM
+
+	val Value
+	ok  bool
 }
 
-func newExecutorTask(vm *VM) *ExecutorTask {
+func newExecutorTask() *ExecutorTask {
 	return &ExecutorTask{
-		done: make(chan struct{}),
-		vm:   vm,
-		once: &sync.Once{},
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+		once:   &sync.Once{},
+	}
+}
+
+func (t *ExecutorTask) isDone() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
 	}
 }
 
+// setVM records the VM running the task, it returns false if the task
+// was already cancelled.
+func (t *ExecutorTask) setVM(v *VM) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.isDone() {
+		return false
+	}
+	t.vm = v
+	return true
+}
+
+// endVM ends the task on v, after it cancelling the task no longer stops v.
+func (t *ExecutorTask) endVM(v *VM) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	v.EndTask()
+	t.vm = nil
+}
+
 func (t *ExecutorTask) Wait() (Value, bool) {
 	<-t.done
 	return t.val, t.ok
 }
 
+// Join waits like Wait, but for a cancelled task it also waits until the task
+// has unwound, so its finally blocks and defers have run.
+func (t *ExecutorTask) Join() (Value, bool) {
+	<-t.exited
+	return t.Wait()
+}
+
+// WaitContext waits for the task like Wait, but returns Cancelled if ctx is done first.
+func (t *ExecutorTask) WaitContext(ctx context.Context) (Value, bool) {
+	select {
+	case <-t.done:
+		return t.val, t.ok
+	case <-ctx.Done():
+		return NewCancelled(), false
+	}
+}
+
 func (t *ExecutorTask) Complete(val Value, ok bool) {
 	t.once.Do(func() {
 		t.val = val
 		t.ok = ok
-		t.vm.running.Store(false)
 		close(t.done)
 	})
 }
 
+// Cancel stops the task, the task's VM gets Cancelled raised and
+// tasks started with its context are cancelled too.
 func (t *ExecutorTask) Cancel() {
 	t.once.Do(func() {
-		t.vm.running.Store(false)
-		t.vm.ctxCancel()
-		t.val = Value{} // return nil value on cancel, TODO: maybe cancellation error?
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if t.vm != nil {
+			t.vm.Stop()
+		}
+		t.val = NewCancelled()
+		t.ok = false
 		close(t.done)
 	})
 }
@@ -22,9 +22,8 @@ func NewRegBuilderFrom(other *Registry) *RegistryBuilder {
 		modules: ds.NewConcMap[string, func() Value](),
 	}
 
-	for _, f := range other.funcs.Iter() {
-		fn := f.GetNativeFunction()
-		r.RegisterFunc(fn.Name, fn.Fn)
+	for k, f := range other.funcs.Iter() {
+		r.funcs.Set(k, f)
 	}
 
 	for k, v := range other.modules.Iter() {
@@ -58,6 +57,12 @@ func (r *RegistryBuilder) RegisterFunc(name string, f NativeFunctionImpl) *Regis
 	return r
 }
 
+func (r *RegistryBuilder) RegisterFuncWithMembers(name string, f NativeFunctionImpl, members map[string]Value) *RegistryBuilder {
+	val := NewNativeFunctionWithMembers(name, f, members)
+	r.funcs.Set(name, val)
+	return r
+}
+
 func (r *RegistryBuilder) ResolveFunc(name string) (Value, bool) {
 	return r.funcs.Get(name)
 }
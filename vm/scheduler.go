@@ -0,0 +1,104 @@
+package vm
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// scheduler starts at most max tasks at a time, the rest wait in a queue
+// ordered by priority, a full queue blocks whoever is adding tasks.
+type scheduler struct {
+	metrics *executorMetrics
+
+	mu      sync.Mutex
+	max     int
+	running int
+	seq     uint64
+	queue   taskQueue
+
+	// slots has room for every task that can be queued, it's nil when the queue is unbounded.
+	slots chan struct{}
+}
+
+func newScheduler(max int, queueSize int, metrics *executorMetrics) *scheduler {
+	s := &scheduler{max: max, metrics: metrics}
+	if queueSize > 0 {
+		s.slots = make(chan struct{}, queueSize)
+	}
+
+	return s
+}
+
+// enqueue queues start to be called in a new goroutine, start must call done
+// when it returns, enqueue returns false if ctx is done while waiting for room.
+func (s *scheduler) enqueue(ctx context.Context, priority int, start func()) bool {
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	heap.Push(&s.queue, queuedTask{priority: priority, seq: s.seq, start: start})
+	s.metrics.queued.Add(1)
+	s.dispatch()
+
+	return true
+}
+
+func (s *scheduler) done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running--
+	s.dispatch()
+}
+
+func (s *scheduler) dispatch() {
+	for s.running < s.max && len(s.queue) > 0 {
+		t := heap.Pop(&s.queue).(queuedTask)
+		if s.slots != nil {
+			<-s.slots
+		}
+
+		s.running++
+		s.metrics.queued.Add(-1)
+		s.metrics.active.Add(1)
+		go t.start()
+	}
+}
+
+type queuedTask struct {
+	priority int
+	seq      uint64
+	start    func()
+}
+
+// taskQueue is a heap of tasks, higher priorities first then oldest first.
+type taskQueue []queuedTask
+
+func (q taskQueue) Len() int { return len(q) }
+
+func (q taskQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q taskQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *taskQueue) Push(x any) { *q = append(*q, x.(queuedTask)) }
+
+func (q *taskQueue) Pop() any {
+	old := *q
+	t := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return t
+}
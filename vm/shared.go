@@ -0,0 +1,176 @@
+package vm
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// objectValue and arrayValue keep the map and slice as their first field,
+// GetObject and GetArray read them through the value pointer.
+type objectValue struct {
+	m      map[string]Value
+	shared sharedState
+
+	// keys is the key order of objects made with NewOrderedObject.
+	keys []string
+}
+
+type arrayValue struct {
+	a      []Value
+	shared sharedState
+}
+
+// sharedState tracks how an object or array is shared between fibers.
+type sharedState struct {
+	frozen atomic.Bool
+
+	// access is used by race detection, it's the number of readers
+	// or -1 while a write is in progress.
+	access atomic.Int32
+}
+
+var (
+	ErrConcurrentWrite     = errors.New("concurrent write to a shared value, use a lock or fiber.shared")
+	ErrConcurrentReadWrite = errors.New("concurrent read and write of a shared value, use a lock or fiber.shared")
+)
+
+func (v *Value) sharedState() *sharedState {
+	switch v.VType {
+	case ValueTypeObject:
+		return &(*objectValue)(v.nonPrimitive).shared
+	case ValueTypeArray:
+		return &(*arrayValue)(v.nonPrimitive).shared
+	default:
+		return nil
+	}
+}
+
+// Freeze makes v and every array and object inside it read only,
+// frozen values can be handed to other fibers safely.
+func (v *Value) Freeze() {
+	state := v.sharedState()
+	if state == nil || !state.frozen.CompareAndSwap(false, true) {
+		return
+	}
+
+	switch v.VType {
+	case ValueTypeObject:
+		for _, val := range v.GetObject() {
+			val.Freeze()
+		}
+	case ValueTypeArray:
+		for _, val := range *v.GetArray() {
+			val.Freeze()
+		}
+	}
+}
+
+func (v *Value) IsFrozen() bool {
+	state := v.sharedState()
+	return state != nil && state.frozen.Load()
+}
+
+// DeepCopy copies v and every array and object inside it,
+// the copy is never frozen.
+func (v *Value) DeepCopy() Value {
+	return v.deepCopy(map[any]Value{})
+}
+
+func (v *Value) deepCopy(seen map[any]Value) Value {
+	switch v.VType {
+	case ValueTypeObject:
+		if c, ok := seen[v.nonPrimitive]; ok {
+			return c
+		}
+
+		src := v.GetObject()
+		m := make(map[string]Value, len(src))
+		c := NewObject(m)
+		seen[v.nonPrimitive] = c
+		for k, val := range src {
+			m[k] = val.deepCopy(seen)
+		}
+		return c
+
+	case ValueTypeArray:
+		if c, ok := seen[v.nonPrimitive]; ok {
+			return c
+		}
+
+		src := *v.GetArray()
+		arr := make([]Value, len(src))
+		c := NewArray(arr)
+		seen[v.nonPrimitive] = c
+		for i, val := range src {
+			arr[i] = val.deepCopy(seen)
+		}
+		return c
+
+	default:
+		return *v
+	}
+}
+
+// Mutate runs fn to modify val, it fails if val is frozen or,
+// with race detection enabled, if another fiber is using val at the same time.
+func (v *VM) Mutate(val Value, fn func()) (Value, bool) {
+	if val.IsFrozen() {
+		return NewError(ErrFrozen.Error(), Value{}), false
+	}
+
+	if v.raceDetection {
+		if err := val.beginWrite(); err != nil {
+			return NewError(err.Error(), Value{}), false
+		}
+		defer val.endWrite()
+	}
+
+	fn()
+
+	return Value{}, true
+}
+
+func (v *Value) beginWrite() error {
+	state := v.sharedState()
+	if state == nil {
+		return nil
+	}
+
+	if !state.access.CompareAndSwap(0, -1) {
+		if state.access.Load() < 0 {
+			return ErrConcurrentWrite
+		}
+		return ErrConcurrentReadWrite
+	}
+
+	return nil
+}
+
+func (v *Value) endWrite() {
+	if state := v.sharedState(); state != nil {
+		state.access.Store(0)
+	}
+}
+
+func (v *Value) beginRead() error {
+	state := v.sharedState()
+	if state == nil {
+		return nil
+	}
+
+	for {
+		n := state.access.Load()
+		if n < 0 {
+			return ErrConcurrentReadWrite
+		}
+		if state.access.CompareAndSwap(n, n+1) {
+			return nil
+		}
+	}
+}
+
+func (v *Value) endRead() {
+	if state := v.sharedState(); state != nil {
+		state.access.Add(-1)
+	}
+}
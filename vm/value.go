@@ -1,9 +1,11 @@
 package vm
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"iter"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,6 +34,7 @@ const (
 	ValueTypeChannel
 	ValueTypeTime
 	ValueTypeIterator
+	ValueTypeBytes
 )
 
 func (t ValueType) Is(other ...ValueType) bool {
@@ -81,6 +84,8 @@ func (t ValueType) String() string {
 		return "time"
 	case ValueTypeIterator:
 		return "iterator"
+	case ValueTypeBytes:
+		return "bytes"
 	default:
 		panic(fmt.Sprintf("unimplemented %d", t))
 	}
@@ -126,13 +131,30 @@ func (v *Value) GetTime() time.Time {
 	return *(*time.Time)(v.nonPrimitive)
 }
 
-func (v *Value) SetIter(iter iter.Seq[Value]) {
+// SetBytes sets v to b, bytes values are immutable so b must not be
+// modified after.
+func (v *Value) SetBytes(b []byte) {
+	v.VType = ValueTypeBytes
+	v.nonPrimitive = unsafe.Pointer(&b)
+}
+
+func (v *Value) GetBytes() []byte {
+	return *(*[]byte)(v.nonPrimitive)
+}
+
+// IterFunc builds an iterator's sequence for the VM consuming it, so
+// callbacks inside the iterator run on the fiber that iterates it and not
+// on the one that created it.
+type IterFunc func(v *VM) iter.Seq[Value]
+
+func (v *Value) SetIter(fn IterFunc) {
 	v.VType = ValueTypeIterator
-	v.nonPrimitive = unsafe.Pointer(&iter)
+	v.nonPrimitive = unsafe.Pointer(&fn)
 }
 
-func (v *Value) GetIter() iter.Seq[Value] {
-	return *(*iter.Seq[Value])(v.nonPrimitive)
+// GetIter returns the iterator's sequence consumed by vm.
+func (v *Value) GetIter(vm *VM) iter.Seq[Value] {
+	return (*(*IterFunc)(v.nonPrimitive))(vm)
 }
 
 func (v *Value) SetTask(t *ExecutorTask) {
@@ -163,9 +185,8 @@ func (v *Value) SetLock(l *sync.Mutex) {
 
 				l.Lock()
 				defer l.Unlock()
-				v.RunFunction(fnArg)
 
-				return Value{}, true
+				return v.RunFunction(fnArg)
 			}
 
 			l.Lock()
@@ -207,13 +228,38 @@ func (v *Value) GetNumber() float64 {
 
 func (v *Value) SetObject(o map[string]Value) {
 	v.VType = ValueTypeObject
-	v.nonPrimitive = unsafe.Pointer(&o)
+	v.nonPrimitive = unsafe.Pointer(&objectValue{m: o})
 }
 
 func (v *Value) GetObject() map[string]Value {
 	return *(*map[string]Value)(v.nonPrimitive)
 }
 
+// ObjectKeys returns the keys of an object in the order they were added
+// for objects made with NewOrderedObject, other keys come after them sorted.
+func (v *Value) ObjectKeys() []string {
+	obj := (*objectValue)(v.nonPrimitive)
+
+	keys := make([]string, 0, len(obj.m))
+	seen := make(map[string]bool, len(obj.keys))
+	for _, k := range obj.keys {
+		if _, ok := obj.m[k]; ok && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	rest := make([]string, 0, len(obj.m)-len(keys))
+	for k := range obj.m {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	slices.Sort(rest)
+
+	return append(keys, rest...)
+}
+
 func (v *Value) GetBool() bool {
 	return *interpret[bool](&v.primitive)
 }
@@ -224,7 +270,7 @@ func (v *Value) GetArray() *[]Value {
 
 func (v *Value) SetArray(a []Value) {
 	v.VType = ValueTypeArray
-	v.nonPrimitive = unsafe.Pointer(&a)
+	v.nonPrimitive = unsafe.Pointer(&arrayValue{a: a})
 }
 
 func (v *Value) SetBool(b bool) {
@@ -238,14 +284,74 @@ func (v *Value) SetNil() {
 }
 
 type Error struct {
-	msg  string
-	data Value
+	msg   string
+	data  Value
+	cause Value
+
+	// kind is a sentinel the error is an instance of, unlike cause scripts
+	// can't reassign it, see NewCancelled.
+	kind *Error
+	// sealed errors are sentinels shared by every executor, their fields
+	// can't be assigned.
+	sealed bool
 }
 
 func (e *Error) Error() string {
+	if e.cause.IsError() {
+		return e.msg + ": " + e.cause.GetError().Error()
+	}
+
 	return e.msg
 }
 
+func (e *Error) Msg() string {
+	return e.msg
+}
+
+func (e *Error) Data() Value {
+	return e.data
+}
+
+// Cause returns the error wrapped by e, or nil if e doesn't wrap an error.
+func (e *Error) Cause() Value {
+	return e.cause
+}
+
+// Clone returns a copy of e with new data and cause that is still an
+// instance of the same sentinel, sealed errors are shared instead of copied.
+func (e *Error) Clone(data Value, cause Value) Value {
+	if e.sealed {
+		return Value{VType: ValueTypeError, nonPrimitive: unsafe.Pointer(e)}
+	}
+
+	c := Error{msg: e.msg, data: data, cause: cause, kind: e.kind}
+	return Value{VType: ValueTypeError, nonPrimitive: unsafe.Pointer(&c)}
+}
+
+// Contains reports whether target is in the chain of errors starting at e.
+// Errors are compared by identity and strings are compared to the messages.
+func (e *Error) Contains(target Value) bool {
+	for cur := e; cur != nil; {
+		switch target.VType {
+		case ValueTypeError:
+			if cur == target.GetError() || (cur.kind != nil && cur.kind == target.GetError()) {
+				return true
+			}
+		case ValueTypeString:
+			if cur.msg == target.GetString() {
+				return true
+			}
+		}
+
+		if !cur.cause.IsError() {
+			return false
+		}
+		cur = cur.cause.GetError()
+	}
+
+	return false
+}
+
 func (v *Value) SetError(msg string, data Value) {
 	e := Error{msg: msg, data: data}
 	v.VType = ValueTypeError
@@ -256,6 +362,13 @@ func (v *Value) GetError() *Error {
 	return (*Error)(v.nonPrimitive)
 }
 
+// SetWrappedError sets v to a new error with the given message and data that wraps cause.
+func (v *Value) SetWrappedError(msg string, data Value, cause Value) {
+	e := Error{msg: msg, data: data, cause: cause}
+	v.VType = ValueTypeError
+	v.nonPrimitive = unsafe.Pointer(&e)
+}
+
 type FunctionValue struct {
 	NumVars      int
 	Instructions []opcode.OpCode
@@ -327,6 +440,9 @@ func CheckValueType(name string, val Value, types ...ValueType) (Value, bool) {
 type NativeFunction struct {
 	Name string
 	Fn   NativeFunctionImpl
+
+	// Members are exposed with the dot operator, like error.wrap
+	Members map[string]Value
 }
 
 type NativeFunctionImpl func(v *VM, args NativeFunctionArgs) (Value, bool)
@@ -370,6 +486,12 @@ func NewNativeFunction(name string, f NativeFunctionImpl) Value {
 	return val
 }
 
+func NewNativeFunctionWithMembers(name string, f NativeFunctionImpl, members map[string]Value) Value {
+	val := Value{}
+	val.SetNativeFunction(NativeFunction{Name: name, Fn: f, Members: members})
+	return val
+}
+
 func NewNativeObject(
 	o interface{},
 	methods map[string]Value,
@@ -391,6 +513,14 @@ func NewObject(m map[string]Value) Value {
 	return val
 }
 
+// NewOrderedObject makes an object that remembers its key order,
+// keys set later on are added to the end.
+func NewOrderedObject(m map[string]Value, keys []string) Value {
+	val := Value{VType: ValueTypeObject}
+	val.nonPrimitive = unsafe.Pointer(&objectValue{m: m, keys: keys})
+	return val
+}
+
 func NewBoolean(b bool) Value {
 	val := Value{}
 	val.SetBool(b)
@@ -415,9 +545,26 @@ func NewTime(t time.Time) Value {
 	return val
 }
 
-func NewIter(iter iter.Seq[Value]) Value {
+func NewBytes(b []byte) Value {
+	val := Value{}
+	val.SetBytes(b)
+	return val
+}
+
+// NewIter makes an iterator from a sequence that doesn't run any weaver code.
+func NewIter(seq iter.Seq[Value]) Value {
+	return NewIterFunc(func(*VM) iter.Seq[Value] { return seq })
+}
+
+func NewIterFunc(fn IterFunc) Value {
 	val := Value{}
-	val.SetIter(iter)
+	val.SetIter(fn)
+	return val
+}
+
+func NewWrappedError(msg string, data Value, cause Value) Value {
+	val := Value{}
+	val.SetWrappedError(msg, data, cause)
 	return val
 }
 
@@ -480,11 +627,19 @@ func (v *Value) string(i int) string {
 	case ValueTypeError:
 		err := v.GetError()
 		msg := err.msg
+
+		var res string
 		if err.data.VType == ValueTypeNil {
-			return fmt.Sprintf("error(%s)", msg)
+			res = fmt.Sprintf("error(%s)", msg)
+		} else {
+			res = fmt.Sprintf("error(%s, %s)", msg, err.data.String())
+		}
+
+		if err.cause.IsError() {
+			res += ": " + err.cause.string(i)
 		}
 
-		return fmt.Sprintf("error(%s, %s)", msg, err.data.String())
+		return res
 
 	case ValueTypeChannel:
 		return "channel"
@@ -498,6 +653,9 @@ func (v *Value) string(i int) string {
 	case ValueTypeIterator:
 		return "iterator"
 
+	case ValueTypeBytes:
+		return fmt.Sprintf("bytes(%x)", v.GetBytes())
+
 	case ValueTypeNativeObject:
 		return fmt.Sprintf("native object(%T)", v.GetNativeObject().Obj)
 
@@ -530,6 +688,12 @@ func (v *Value) Add(other *Value, res *Value) {
 		return
 	}
 
+	if v.VType == ValueTypeBytes && other.VType == ValueTypeBytes {
+		a, b := v.GetBytes(), other.GetBytes()
+		res.SetBytes(append(a[:len(a):len(a)], b...))
+		return
+	}
+
 	panic(fmt.Sprintf("illegal operation %s + %s", v.VType, other.VType))
 }
 
@@ -609,6 +773,8 @@ func (v *Value) Equal(other *Value, res *Value) {
 		res.SetBool(v.GetNumber() == other.GetNumber())
 	case ValueTypeString:
 		res.SetBool(v.GetString() == other.GetString())
+	case ValueTypeBytes:
+		res.SetBool(bytes.Equal(v.GetBytes(), other.GetBytes()))
 	case ValueTypeArray:
 		res.SetBool(v.GetArray() == other.GetArray())
 	case ValueTypeBool:
@@ -617,6 +783,8 @@ func (v *Value) Equal(other *Value, res *Value) {
 		res.SetBool(v.GetFunction() == other.GetFunction())
 	case ValueTypeTime:
 		res.SetBool(v.GetTime().Equal(other.GetTime()))
+	case ValueTypeError:
+		res.SetBool(v.GetError() == other.GetError())
 	default:
 		res.SetBool(false)
 	}
@@ -635,6 +803,8 @@ func (v *Value) NotEqual(other *Value, res *Value) {
 		res.SetBool(v.GetNumber() != other.GetNumber())
 	case ValueTypeString:
 		res.SetBool(v.GetString() != other.GetString())
+	case ValueTypeBytes:
+		res.SetBool(!bytes.Equal(v.GetBytes(), other.GetBytes()))
 	case ValueTypeArray:
 		res.SetBool(v.GetArray() != other.GetArray())
 	case ValueTypeBool:
@@ -643,6 +813,8 @@ func (v *Value) NotEqual(other *Value, res *Value) {
 		res.SetBool(v.GetFunction() != other.GetFunction())
 	case ValueTypeTime:
 		res.SetBool(!v.GetTime().Equal(other.GetTime()))
+	case ValueTypeError:
+		res.SetBool(v.GetError() != other.GetError())
 	default:
 		res.SetBool(true)
 	}
@@ -669,6 +841,8 @@ var (
 	ErrInvalidArrayIndexType  = errors.New("invalid array index type")
 	ErrInvalidObjectIndexType = errors.New("invalid object index type")
 	ErrInvalidErrorIndexType  = errors.New("invalid error index type")
+	ErrIndexOutOfRange        = errors.New("index out of range")
+	ErrFrozen                 = errors.New("cannot modify a frozen value")
 )
 
 func (v *Value) Index(idx *Value, res *Value) {
@@ -679,6 +853,12 @@ func (v *Value) Index(idx *Value, res *Value) {
 			res.Set((*v.GetArray())[int(idx.GetNumber())])
 			return
 		}
+	case ValueTypeBytes:
+		switch idx.VType {
+		case ValueTypeNumber:
+			res.SetNumber(float64(v.GetBytes()[int(idx.GetNumber())]))
+			return
+		}
 	case ValueTypeObject:
 		switch idx.VType {
 		case ValueTypeString:
@@ -699,6 +879,19 @@ func (v *Value) Index(idx *Value, res *Value) {
 			case "data":
 				res.Set(err.data)
 				return
+			case "cause":
+				res.Set(err.cause)
+				return
+			}
+		}
+
+	case ValueTypeNativeFunction:
+		switch idx.VType {
+		case ValueTypeString:
+			fn := v.GetNativeFunction()
+			if member, ok := fn.Members[idx.GetString()]; ok {
+				res.Set(member)
+				return
 			}
 		}
 
@@ -733,26 +926,47 @@ func (v *Value) Index(idx *Value, res *Value) {
 	res.SetNil()
 }
 
-func (v *Value) SetIndex(idx *Value, val Value) {
+func (v *Value) SetIndex(idx *Value, val Value) error {
 	switch v.VType {
 	case ValueTypeArray:
+		if v.IsFrozen() {
+			return ErrFrozen
+		}
+
 		switch idx.VType {
 		case ValueTypeNumber:
-			(*v.GetArray())[int(idx.GetNumber())] = val
+			arr := *v.GetArray()
+			i := int(idx.GetNumber())
+			if i < 0 || i >= len(arr) {
+				return ErrIndexOutOfRange
+			}
+			arr[i] = val
 		default:
-			panic(ErrInvalidArrayIndexType)
+			return ErrInvalidArrayIndexType
 		}
 	case ValueTypeObject:
+		if v.IsFrozen() {
+			return ErrFrozen
+		}
+
 		switch idx.VType {
 		case ValueTypeString:
-			v.GetObject()[idx.GetString()] = val
+			obj := (*objectValue)(v.nonPrimitive)
+			key := idx.GetString()
+			if _, ok := obj.m[key]; !ok && obj.keys != nil {
+				obj.keys = append(obj.keys, key)
+			}
+			obj.m[key] = val
 		default:
-			panic(ErrInvalidObjectIndexType)
+			return ErrInvalidObjectIndexType
 		}
 	case ValueTypeError:
 		switch idx.VType {
 		case ValueTypeString:
 			err := v.GetError()
+			if err.sealed {
+				return ErrFrozen
+			}
 			key := idx.GetString()
 
 			switch key {
@@ -760,13 +974,19 @@ func (v *Value) SetIndex(idx *Value, val Value) {
 				err.msg = val.GetString()
 			case "data":
 				err.data = val
+			case "cause":
+				err.cause = val
 			default:
-				panic(ErrInvalidObjectIndexType)
+				return ErrInvalidObjectIndexType
 			}
 		default:
-			panic(ErrInvalidErrorIndexType)
+			return ErrInvalidErrorIndexType
 		}
+	default:
+		return fmt.Errorf("cannot index assign %s", v.VType)
 	}
+
+	return nil
 }
 
 func (v *Value) IsError() bool {
@@ -2,8 +2,11 @@ package vm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime/debug"
 	"sync/atomic"
+	"unsafe"
 
 	"github.com/joetifa2003/weaver/opcode"
 )
@@ -23,7 +26,15 @@ type Frame struct {
 	ip          int
 	stackOffset int
 	returnAddr  int
-	hasTry      bool
+	handlers    []tryHandler
+	defers      []Value
+}
+
+// tryHandler is pushed by OP_TRY, when an error is raised inside the try block
+// the stack is restored to sp and execution jumps to addr with the error on top.
+type tryHandler struct {
+	addr int
+	sp   int
 }
 
 type VM struct {
@@ -34,39 +45,93 @@ type VM struct {
 	callStack [MaxCallStack]Frame
 	curFrame  *Frame
 	reg       *Registry
-	ctxCancel context.CancelFunc
-	running   *atomic.Bool
+	ctxCancel context.CancelCauseFunc
+	cancelled atomic.Bool
 	sp        int
 	fp        int
+
+	// taskEnd runs when the task running on the VM ends.
+	taskEnd []func()
+
+	// raceDetection checks objects and arrays for unsynchronized access.
+	raceDetection bool
+}
+
+// Cancelled is the sentinel for cancellation errors, it's sealed so scripts
+// can't change it for every executor. Cancelled tasks raise and return fresh
+// errors from NewCancelled, match them with IsCancelledErr or error.is.
+var Cancelled = Value{VType: ValueTypeError, nonPrimitive: unsafe.Pointer(&Error{msg: "cancelled", sealed: true})}
+
+// NewCancelled returns a new cancellation error that is an instance of Cancelled.
+func NewCancelled() Value {
+	return Value{VType: ValueTypeError, nonPrimitive: unsafe.Pointer(&Error{msg: "cancelled", kind: Cancelled.GetError()})}
+}
+
+// IsCancelledErr reports whether val is a cancellation error or wraps one.
+func IsCancelledErr(val Value) bool {
+	return val.IsError() && val.GetError().Contains(Cancelled)
 }
 
+var errCancelled = errors.New("cancelled")
+
 func New(executor *Executor) *VM {
-	running := atomic.Bool{}
-	running.Store(true)
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancelCause(context.Background())
 	vm := &VM{
-		Executor:  executor,
-		sp:        -1,
-		fp:        -1,
-		running:   &running,
-		Ctx:       ctx,
-		ctxCancel: cancel,
+		Executor:      executor,
+		sp:            -1,
+		fp:            -1,
+		Ctx:           ctx,
+		ctxCancel:     cancel,
+		raceDetection: executor != nil && executor.raceDetection,
 	}
 
 	return vm
 }
 
+func (v *VM) setIndex(assignee *Value, idx *Value, val Value) error {
+	if v.raceDetection {
+		if err := assignee.beginWrite(); err != nil {
+			return err
+		}
+		defer assignee.endWrite()
+	}
+
+	return assignee.SetIndex(idx, val)
+}
+
 func (v *VM) Resurrect() {
-	v.running.Store(true)
+	v.EndTask()
+	v.cancelled.Store(false)
 	v.sp = -1
 	v.fp = -1
 	v.curFrame = nil
-	v.Ctx, v.ctxCancel = context.WithCancel(context.Background())
+	v.Ctx, v.ctxCancel = context.WithCancelCause(context.Background())
+}
+
+// AtTaskEnd registers fn to run when the task running on the VM ends, it
+// releases what's tied to the task since the VM is reused by later tasks.
+func (v *VM) AtTaskEnd(fn func()) {
+	v.taskEnd = append(v.taskEnd, fn)
+}
+
+// EndTask runs the functions registered with AtTaskEnd.
+func (v *VM) EndTask() {
+	for _, fn := range v.taskEnd {
+		fn()
+	}
+	v.taskEnd = nil
 }
 
+// Stop cancels the VM context, the running code gets Cancelled raised
+// so its deferred functions and finally blocks still run.
 func (v *VM) Stop() {
-	v.ctxCancel()
-	v.running.Store(false)
+	v.ctxCancel(errCancelled)
+	v.cancelled.Store(true)
+}
+
+// IsCancelled reports whether the VM was stopped.
+func (v *VM) IsCancelled() bool {
+	return v.Ctx.Err() != nil
 }
 
 var scopeGettersDeref = [4]func(v *VM, idx int) *Value{
@@ -110,15 +175,90 @@ func (v *VM) GetStackVal(idx int) Value {
 func (v *VM) Run(frame Frame, args int) bool {
 	v.pushFrame(frame, args)
 
+	if !v.recoverPanics() {
+		return v.run()
+	}
+
 	for {
-		if !v.running.Load() {
-			return true
+		ok, recovered := v.runRecover()
+		if !recovered || !ok {
+			return ok
+		}
+
+		// the panic was caught by a try handler, continue from it
+	}
+}
+
+// runRecover runs the current frame, if a Go panic happens it's raised as a weaver error.
+// recovered reports whether a panic happened, in that case ok reports whether it was caught.
+func (v *VM) runRecover() (ok bool, recovered bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok, recovered = v.raise(newPanicError("panic", r)), true
+		}
+	}()
+
+	return v.run(), false
+}
+
+func (v *VM) recoverPanics() bool {
+	return v.Executor == nil || v.Executor.recoverPanics
+}
+
+// callNative calls a native function, when panic recovery is enabled
+// a panic inside it is returned as an error.
+func (v *VM) callNative(fn *NativeFunction, args NativeFunctionArgs) (res Value, ok bool) {
+	if !v.recoverPanics() {
+		return fn.Fn(v, args)
+	}
+
+	fp := v.fp
+	defer func() {
+		if r := recover(); r != nil {
+			// the native may have panicked while running a function
+			v.fp = fp
+			v.curFrame = &v.callStack[fp]
+			res, ok = newPanicError(fmt.Sprintf("panic in %s", fn.Name), r), false
+		}
+	}()
+
+	return fn.Fn(v, args)
+}
+
+func newPanicError(msg string, r any) Value {
+	return NewError(
+		fmt.Sprintf("%s: %v", msg, r),
+		NewObject(map[string]Value{
+			"panic": NewString(fmt.Sprint(r)),
+			"stack": NewString(string(debug.Stack())),
+		}),
+	)
+}
+
+func (v *VM) run() bool {
+	for {
+		if v.cancelled.Load() && v.cancelled.CompareAndSwap(true, false) {
+			// raised once, so cleanup code can run after it
+			if !v.raise(NewCancelled()) {
+				return false
+			}
+			continue
 		}
 
 		switch v.curFrame.Instructions[v.curFrame.ip] {
 		case opcode.OP_TRY:
-			v.curFrame.hasTry = !v.curFrame.hasTry
-			v.curFrame.ip += 1
+			addr := int(v.curFrame.Instructions[v.curFrame.ip+1])
+			v.curFrame.handlers = append(v.curFrame.handlers, tryHandler{addr: addr, sp: v.sp})
+			v.curFrame.ip += 2
+
+		case opcode.OP_TRY_END:
+			v.curFrame.handlers = v.curFrame.handlers[:len(v.curFrame.handlers)-1]
+			v.curFrame.ip++
+
+		case opcode.OP_DEFER:
+			v.curFrame.defers = append(v.curFrame.defers, v.stack[v.sp])
+			v.sp--
+			v.curFrame.ip++
 
 		case opcode.OP_UPGRADE_REF:
 			scope := v.curFrame.Instructions[v.curFrame.ip+1]
@@ -420,7 +560,18 @@ func (v *VM) Run(frame Frame, args int) bool {
 			val := v.stack[v.sp-1]
 			v.sp--
 
-			val.Index(&index, &v.stack[v.sp])
+			if v.raceDetection {
+				if err := val.beginRead(); err != nil {
+					if !v.raise(NewError(err.Error(), Value{})) {
+						return false
+					}
+					continue
+				}
+				val.Index(&index, &v.stack[v.sp])
+				val.endRead()
+			} else {
+				val.Index(&index, &v.stack[v.sp])
+			}
 
 			v.curFrame.ip++
 
@@ -433,7 +584,12 @@ func (v *VM) Run(frame Frame, args int) bool {
 			assignee := v.stack[v.sp-1]
 			val := v.stack[v.sp-2]
 
-			assignee.SetIndex(&idx, val)
+			if err := v.setIndex(&assignee, &idx, val); err != nil {
+				if !v.raise(NewError(err.Error(), Value{})) {
+					return false
+				}
+				continue
+			}
 
 			v.sp -= 2
 			v.stack[v.sp] = assignee
@@ -472,7 +628,7 @@ func (v *VM) Run(frame Frame, args int) bool {
 					Args: v.stack[argsBegin : argsBegin+numArgs],
 					Name: fn.Name,
 				}
-				r, ok := fn.Fn(v, args)
+				r, ok := v.callNative(&fn, args)
 				v.sp = calleeIdx
 				v.stack[v.sp] = r
 				v.curFrame.ip += 2
@@ -492,6 +648,15 @@ func (v *VM) Run(frame Frame, args int) bool {
 			}
 
 		case opcode.OP_RET:
+			if len(v.curFrame.defers) != 0 {
+				if errVal, ok := v.runDefers(); !ok {
+					if !v.raise(errVal) {
+						return false
+					}
+					continue
+				}
+			}
+
 			val := v.stack[v.sp]
 			v.sp = v.curFrame.returnAddr
 			v.stack[v.sp] = val
@@ -502,6 +667,18 @@ func (v *VM) Run(frame Frame, args int) bool {
 			}
 
 		case opcode.OP_HALT:
+			if len(v.curFrame.defers) != 0 {
+				if errVal, ok := v.runDefers(); !ok {
+					if !v.raise(errVal) {
+						return false
+					}
+					continue
+				}
+			}
+
+			v.sp = v.curFrame.returnAddr
+			v.stack[v.sp].SetNil()
+			v.popFrame()
 			return true
 
 		case opcode.OP_LOAD_LOAD_ADD:
@@ -806,36 +983,61 @@ func (v *VM) Run(frame Frame, args int) bool {
 	}
 }
 
+// raise unwinds the call stack until a try handler catches val, running the
+// deferred functions of every frame it leaves. It returns false when the error
+// escapes the frame that Run was called with.
 func (v *VM) raise(val Value) bool {
-	prevFrame := v.curFrame
-	v.popFrame() // pop the current frame
+	if IsCancelledErr(val) {
+		// a native already noticed the cancellation, don't raise it twice
+		v.cancelled.Store(false)
+	}
 
 	for {
-		if prevFrame.HaltAfter {
-			v.sp = prevFrame.returnAddr
-			v.stack[v.sp] = val
-			return false
-		}
+		f := v.curFrame
 
-		if v.fp < 0 {
-			break
-		}
-
-		if v.callStack[v.fp].hasTry {
-			v.sp = prevFrame.returnAddr
+		if n := len(f.handlers); n != 0 {
+			h := f.handlers[n-1]
+			f.handlers = f.handlers[:n-1]
+			v.sp = h.sp + 1
 			v.stack[v.sp] = val
+			f.ip = h.addr
 			return true
 		}
 
-		prevFrame = v.curFrame
+		if len(f.defers) != 0 {
+			// an error raised by a deferred function replaces the one being raised
+			if errVal, ok := v.runDefers(); !ok {
+				val = errVal
+			}
+		}
+
+		v.sp = f.returnAddr
+		v.stack[v.sp] = val
+		haltAfter := f.HaltAfter
 		v.popFrame()
+
+		if haltAfter || v.curFrame == nil {
+			return false
+		}
 	}
+}
 
-	if prevFrame != nil {
-		v.sp = prevFrame.returnAddr
-		v.stack[v.sp] = val
+// runDefers runs the deferred functions of the current frame in reverse order,
+// it returns the first error raised by them.
+func (v *VM) runDefers() (Value, bool) {
+	f := v.curFrame
+	res, ok := Value{}, true
+
+	for len(f.defers) != 0 {
+		fn := f.defers[len(f.defers)-1]
+		f.defers = f.defers[:len(f.defers)-1]
+
+		if r, fnOk := v.RunFunction(fn); !fnOk && ok {
+			res, ok = r, false
+		}
 	}
-	return false
+
+	return res, ok
 }
 
 func (v *VM) pushFrame(f Frame, args int) {
@@ -862,6 +1064,11 @@ func (v *VM) popFrame() {
 }
 
 func (v *VM) RunFunction(f Value, args ...Value) (Value, bool) {
+	if f.VType == ValueTypeNativeFunction {
+		fn := f.GetNativeFunction()
+		return v.callNative(&fn, NativeFunctionArgs{Args: args, Name: fn.Name})
+	}
+
 	fn := f.GetFunction()
 	v.sp++
 	retAddr := v.sp
@@ -1,8 +1,14 @@
 package vm_test
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -715,6 +721,1579 @@ func TestVM(t *testing.T) {
 				|> filter() { it % 2 != 0 }) == 2 
 				|> assert();
 		`,
+		56: `
+			log := [];
+			f := |x| {
+				try {
+					if (x) { raise error("boom", 1); }
+					log |> push("body");
+				} catch (e) {
+					log |> push(e.msg);
+					e.data == 1 |> assert();
+				} finally {
+					log |> push("finally");
+				}
+			};
+			f(false);
+			f(true);
+			len(log) == 4 |> assert();
+			log[0] == "body" |> assert();
+			log[1] == "finally" |> assert();
+			log[2] == "boom" |> assert();
+			log[3] == "finally" |> assert();
+		`,
+		57: `
+			log := [];
+			f := || {
+				defer log |> push("first");
+				defer log |> push("second");
+				try {
+					return "ret";
+				} finally {
+					log |> push("finally");
+				}
+			};
+			f() == "ret" |> assert();
+			log[0] == "finally" |> assert();
+			log[1] == "second" |> assert();
+			log[2] == "first" |> assert();
+
+			g := || {
+				defer log |> push("deferred");
+				raise error("failed");
+			};
+			err := try g();
+			err.msg == "failed" |> assert();
+			log[3] == "deferred" |> assert();
+
+			h := || {
+				try { raise error("inner"); } finally { log |> push("cleanup"); }
+			};
+			(try h()).msg == "inner" |> assert();
+			log[4] == "cleanup" |> assert();
+		`,
+		58: `
+			count := 0;
+			for (i := 0; i < 5; i++) {
+				try {
+					if (i == 1) { continue }
+					if (i == 3) { break }
+				} finally {
+					count++;
+				}
+			}
+			count == 4 |> assert();
+
+			caught := false;
+			try {
+				number("abc");
+			} catch {
+				caught = true;
+			}
+			caught |> assert();
+
+			isError(try number("abc")) |> assert();
+		`,
+		59: `
+			notFound := error("not found");
+			err := error.wrap(notFound, "read config", "app.json");
+			err.msg == "read config" |> assert();
+			err.data == "app.json" |> assert();
+			err.cause == notFound |> assert();
+			error.cause(err) == notFound |> assert();
+			error.cause(notFound) == nil |> assert();
+			error.is(err, notFound) |> assert();
+			error.is(err, "not found") |> assert();
+			!error.is(err, error("not found")) |> assert();
+			!error.is(1, notFound) |> assert();
+
+			wrapped := error.wrap(err, "startup");
+			error.is(wrapped, notFound) |> assert();
+
+			match wrapped {
+				error("startup", _, error("read config", file, error("not found"))) => file == "app.json" |> assert(),
+				else => false |> assert()
+			}
+		`,
+		60: `
+			err := try goPanic("boom");
+			isError(err) |> assert();
+			err.msg == "panic in goPanic: boom" |> assert();
+			err.data.panic == "boom" |> assert();
+			type(err.data.stack) == "string" |> assert();
+
+			caught := false;
+			try {
+				[1, 2] |> map(|x| goPanic("inside callback"));
+			} catch (e) {
+				caught = e.data.panic == "inside callback";
+			}
+			caught |> assert();
+		`,
+		61: `
+			err := try (1 + "a");
+			err.msg == "panic: illegal operation number + string" |> assert();
+
+			f := || [1, 2][5];
+			isError(try f()) |> assert();
+		`,
+		62: `
+			fiber := import("fiber");
+			log := [];
+			t := fiber.run(|| {
+				defer log |> push("deferred");
+				try {
+					sleep(10000);
+				} finally {
+					log |> push(fiber.cancelled());
+				}
+				log |> push("unreachable");
+			});
+			sleep(20);
+			fiber.cancel(t);
+
+			err := try fiber.wait(t);
+			err != fiber.Cancelled |> assert();
+			error.is(err, fiber.Cancelled) |> assert();
+			err.msg = "changed";
+			fiber.Cancelled.msg == "cancelled" |> assert();
+			(try (|| { fiber.Cancelled.msg = "changed"; })()) |> isError() |> assert();
+			other := fiber.run(|| sleep(10000));
+			fiber.cancel(other);
+			otherErr := try fiber.wait(other);
+			otherErr != err && otherErr.msg == "cancelled" && error.is(otherErr, fiber.Cancelled) |> assert();
+
+			sleep(20);
+			len(log) == 2 |> assert();
+			log[0] == true |> assert();
+			log[1] == "deferred" |> assert();
+		`,
+		63: `
+			fiber := import("fiber");
+			ch := fiber.newChannel();
+			cleaned := fiber.newChannel(1);
+			parent := fiber.run(|| {
+				child := fiber.run(|| {
+					fiber.onCancel(|| fiber.send(cleaned, "child"));
+					fiber.recv(ch);
+				});
+				fiber.wait(child);
+			});
+			sleep(20);
+			fiber.cancel(parent);
+			fiber.recv(cleaned) == "child" |> assert();
+			!fiber.cancelled() |> assert();
+
+			fired := fiber.newChannel(1);
+			finished := fiber.run(|| {
+				fiber.onCancel(|| fiber.send(fired, 1));
+				fiber.onCancel(fiber.cancelled);
+			});
+			fiber.wait(finished);
+			fiber.cancel(finished);
+			sleep(10);
+			len(fired) == 0 |> assert();
+			(try fiber.onCancel(1)) |> isError() |> assert();
+		`,
+		64: `
+			fiber := import("fiber");
+			res := fiber.group(|g| {
+				g.run(|| { sleep(20); return 1; });
+				g.run(|x| x * 2, 21);
+			});
+			res[0] == 1 |> assert();
+			res[1] == 42 |> assert();
+
+			limited := fiber.group({limit: 2}, |g| {
+				for (i in 0..4) {
+					g.run(|n| {
+						sleep(10);
+						return n;
+					}, i);
+				}
+			});
+			len(limited) == 5 |> assert();
+			limited[4] == 4 |> assert();
+		`,
+		65: `
+			fiber := import("fiber");
+			log := [];
+			err := try fiber.group(|g| {
+				g.run(|| {
+					try {
+						sleep(10000);
+					} finally {
+						log |> push("cancelled");
+					}
+				});
+				g.run(|| {
+					sleep(10);
+					raise error("boom");
+				});
+			});
+			err |> isError() |> assert();
+			error.is(err, "boom") |> assert();
+			len(err.data) == 1 |> assert();
+			len(log) == 1 |> assert();
+
+			t := fiber.run(|| fiber.group(|g| {
+				g.run(|| sleep(10000));
+			}));
+			sleep(20);
+			fiber.cancel(t);
+			cancelErr := try fiber.wait(t);
+			error.is(cancelErr, fiber.Cancelled) |> assert();
+		`,
+		66: `
+			fiber := import("fiber");
+			a := fiber.newChannel(1);
+			b := fiber.newChannel(1);
+			fiber.send(b, "hi");
+
+			r := fiber.select([{recv: a}, {recv: b}]);
+			r.index == 1 |> assert();
+			r.value == "hi" |> assert();
+			r.ok |> assert();
+
+			fiber.select([{recv: a}, {default: true}]).index == 1 |> assert();
+			fiber.select([{recv: a}, {recv: fiber.after(10), fn: |t| "timeout"}]) == "timeout" |> assert();
+			fiber.select([{recv: nil}, {send: a, value: 5}]).index == 1 |> assert();
+			len(a) == 1 |> assert();
+			fiber.cap(a) == 1 |> assert();
+
+			fiber.close(a);
+			fiber.recv(a) == 5 |> assert();
+			!fiber.select([{recv: a}]).ok |> assert();
+		`,
+		67: `
+			fiber := import("fiber");
+			ch := fiber.newChannel(2);
+			fiber.run(|| {
+				for (i in 1..5) {
+					fiber.send(ch, i);
+				}
+				fiber.close(ch);
+			});
+			sum := 0;
+			for (x in ch) {
+				if (x == 2) {
+					continue
+				}
+				sum = sum + x;
+			}
+			sum == 13 |> assert();
+			(try fiber.newChannel(-1)) |> isError() |> assert();
+
+			keys := [];
+			for (k in {b: 1, a: 2}) {
+				keys |> push(k);
+			}
+			keys[0] == "a" |> assert();
+			keys[1] == "b" |> assert();
+
+			first := || {
+				for (x in [1, 2, 3]) {
+					if (x > 1) {
+						return x;
+					}
+				}
+			};
+			first() == 2 |> assert();
+
+			chars := "";
+			for (c in "abc") {
+				chars = chars + c;
+			}
+			chars == "abc" |> assert();
+		`,
+		68: `
+			fiber := import("fiber");
+			l := fiber.newRWLock();
+			err := try l.lock(|| raise error("inside"));
+			error.is(err, "inside") |> assert();
+			l.lock(|| 1) == 1 |> assert();
+			l.rlock();
+			l.rlock(|| 2) == 2 |> assert();
+			l.runlock();
+			(try l.runlock()) |> isError() |> assert();
+			(try l.unlock()) |> isError() |> assert();
+			l.lock();
+			l.unlock();
+			(try l.unlock()) |> isError() |> assert();
+			l.lock(|| 4) == 4 |> assert();
+
+			m := fiber.newLock();
+			err2 := try m.lock(|| raise error("inside"));
+			error.is(err2, "inside") |> assert();
+			m.lock(|| 3) == 3 |> assert();
+
+			sem := fiber.newSemaphore(2);
+			counter := fiber.newCounter();
+			peak := fiber.newAtomic(0);
+			wg := fiber.newWaitGroup();
+			for (i in 1..6) {
+				wg.run(|| sem.acquire(|| {
+					n := counter.add();
+					current := peak.load();
+					while (n > current && !peak.compareAndSwap(current, n)) {
+						current = peak.load();
+					}
+					sleep(5);
+					counter.add(-1);
+				}));
+			}
+			wg.wait();
+			counter.load() == 0 |> assert();
+			peak.load() <= 2 |> assert();
+			sem.tryAcquire() |> assert();
+			sem.release();
+			err3 := try sem.acquire(|| raise error("sem"));
+			error.is(err3, "sem") |> assert();
+			sem.tryAcquire() |> assert();
+			sem.tryAcquire() |> assert();
+			!sem.tryAcquire() |> assert();
+
+			calls := fiber.newCounter();
+			init := fiber.once(|| {
+				calls.add();
+				return "ready";
+			});
+			fiber.wait([fiber.run(|| init()), fiber.run(|| init())]);
+			init() == "ready" |> assert();
+			calls.load() == 1 |> assert();
+
+			wg.add(2);
+			wg.done();
+			wg.done();
+			wg.wait();
+			(try wg.done()) |> isError() |> assert();
+		`,
+		69: `
+			fiber := import("fiber");
+			config := {name: "app", ports: [80, 443], nested: {x: 1}};
+			freeze(config);
+			isFrozen(config) |> assert();
+			isFrozen(config.ports) |> assert();
+			isFrozen(config.nested) |> assert();
+
+			setName := || { config.name = "other"; };
+			err := try setName();
+			err |> isError() |> assert();
+			err.msg == "cannot modify a frozen value" |> assert();
+			(try push(config.ports, 8080)) |> isError() |> assert();
+			len(config.ports) == 2 |> assert();
+
+			fiber.wait(fiber.run(|| config.nested.x)) == 1 |> assert();
+
+			c := deepCopy(config);
+			!isFrozen(c) |> assert();
+			c.nested.x = 2;
+			c.nested.x == 2 |> assert();
+			config.nested.x == 1 |> assert();
+
+			arr := [1];
+			outOfRange := || { arr[5] = 1; };
+			(try outOfRange()) |> isError() |> assert();
+		`,
+		70: `
+			fiber := import("fiber");
+			counts := fiber.shared({});
+			items := fiber.shared([]);
+			fiber.wait([
+				fiber.run(|| {
+					for (i in 1..50) {
+						counts.update(|c| c.a = (c.a || 0) + 1);
+						items.push(i);
+					}
+				}),
+				fiber.run(|| {
+					for (i in 1..50) {
+						counts.update(|c| c.b = (c.b || 0) + 1);
+						items.push(i);
+					}
+				}),
+			]);
+			counts.get("a") == 50 |> assert();
+			counts.get("b") == 50 |> assert();
+			items.len() == 100 |> assert();
+			counts.read(|c| len(c)) == 2 |> assert();
+
+			snap := counts.snapshot();
+			snap.a = 0;
+			counts.get("a") == 50 |> assert();
+			counts.set("a", 1) == 1 |> assert();
+			counts.get("a") == 1 |> assert();
+			(try items.get(100)) |> isError() |> assert();
+
+			(try counts.update(|c| counts.get("a"))) |> isError() |> assert();
+			(try counts.read(|c| counts.len())) |> isError() |> assert();
+			counts.get("a") == 1 |> assert();
+			(try counts.read(|c| c.a = 2)) |> isError() |> assert();
+			counts.get("a") == 1 |> assert();
+
+			nested := fiber.shared([[1]]);
+			inner := nested.get(0);
+			inner[0] = 2;
+			nested.get(0)[0] == 1 |> assert();
+			val := [1];
+			nested.set(0, val);
+			val[0] = 3;
+			nested.get(0)[0] == 1 |> assert();
+		`,
+		71: `
+			io := import("io");
+			fiber := import("fiber");
+			path := io.join(tempDir(), "worker.wvr");
+			io.writeFile(path, "count := 0; return |mb| { for (msg in mb.messages) { count = count + 1; if (msg.op == 0) { raise error(string(msg.n)); } if (msg.op == 2) { return count; } mb.send({n: msg.n * 2, count: count}); } };");
+
+			h := fiber.spawnIsolate(path, {restart: true, maxRestarts: 1});
+			data := {op: 1, n: 21};
+			h.send(data);
+			data.n = 0;
+			r := h.recv();
+			r.n == 42 |> assert();
+			r.count == 1 |> assert();
+
+			h.send({op: 0, n: 7});
+			h.send({op: 1, n: 1});
+			r2 := h.recv();
+			r2.count == 1 |> assert();
+			h.restarts() == 1 |> assert();
+
+			(try h.send({op: 1, fn: || 1})) |> isError() |> assert();
+			(try h.send({op: 1, ch: fiber.newChannel()})) |> isError() |> assert();
+
+			h.send({op: 0, n: 8});
+			err := try h.wait();
+			err |> isError() |> assert();
+			error.is(err, "8") |> assert();
+			err.data.restarts == 1 |> assert();
+			(try h.send({op: 1, n: 1})) |> isError() |> assert();
+			(try h.recv()) |> isError() |> assert();
+			(try fiber.spawnIsolate(path, {buffer: -1})) |> isError() |> assert();
+
+			h2 := fiber.spawnIsolate(path, {buffer: 2});
+			h2.send({op: 1, n: 1});
+			h2.send({op: 2});
+			for (m in h2.messages) {
+				m.n == 2 |> assert();
+			}
+			h2.wait() == 2 |> assert();
+		`,
+		72: `
+			fiber := import("fiber");
+			runtime := import("runtime");
+			t := fiber.run(|| 42, {priority: 10});
+			fiber.wait(t) == 42 |> assert();
+
+			m := runtime.metrics();
+			m.completed >= 1 |> assert();
+			m.queued == 0 |> assert();
+			m.poolSize >= 1 |> assert();
+			type(m.active) == "number" |> assert();
+			type(m.failed) == "number" |> assert();
+			runtime.numCPU() >= 1 |> assert();
+			runtime.numGoroutine() >= 1 |> assert();
+		`,
+		73: `
+			time := import("time");
+			fiber := import("fiber");
+
+			hits := fiber.newCounter();
+			once := time.after(10 * time.millisecond, || hits.add());
+			once.wait() == 1 |> assert();
+			hits.load() == 1 |> assert();
+
+			later := time.after(time.hour, || hits.add());
+			later.cancel();
+			later.wait() == 0 |> assert();
+
+			every := time.every(5 * time.millisecond, || {
+				if (hits.add() == 4) {
+					raise error("stop");
+				}
+			});
+			err := try every.wait();
+			error.is(err, "stop") |> assert();
+			hits.load() == 4 |> assert();
+
+			ticker := time.ticker(5 * time.millisecond);
+			ticks := 0;
+			for (t in ticker.c) {
+				type(t) == "time" |> assert();
+				ticks = ticks + 1;
+				if (ticks == 3) {
+					ticker.stop();
+				}
+			}
+			ticks >= 3 |> assert();
+
+			c := time.cron("*/5 * * * *", || 1, {tz: "America/New_York"});
+			c.cancel();
+			c.wait() == 0 |> assert();
+			(try time.cron("* * *", || 1)) |> isError() |> assert();
+			(try time.cron("* * * * *", || 1, {tz: "Nowhere/Nothing"})) |> isError() |> assert();
+
+			time.after(time.now(), time.unix(0)) |> assert();
+
+			background := fiber.newCounter();
+			t := fiber.run(|| time.every(time.millisecond, || background.add()).wait());
+			sleep(20);
+			fiber.cancel(t);
+			sleep(10);
+			stopped := background.load();
+			sleep(20);
+			background.load() == stopped |> assert();
+		`,
+		74: `
+			arrays := import("arrays");
+			same := |a, b| len(a) == len(b) && arrays.zip(a, b) |> arrays.every(|p| p[0] == p[1]);
+
+			people := [{name: "c", age: 30}, {name: "a", age: 20}, {name: "b", age: 30}];
+			byAge := people |> arrays.sort(|a, b| a.age - b.age);
+			same(byAge |> map(|p| p.name), ["a", "c", "b"]) |> assert();
+			byName := people |> arrays.sort({key: |p| p.name, desc: true});
+			same(byName |> map(|p| p.name), ["c", "b", "a"]) |> assert();
+			nums := [3, 1, 2];
+			same(arrays.sort(nums), [1, 2, 3]) |> assert();
+			same(nums, [3, 1, 2]) |> assert();
+
+			arrays.reduce([1, 2, 3], |acc, x| acc + x) == 6 |> assert();
+			arrays.reduce([], |acc, x| acc + x, 10) == 10 |> assert();
+			same(arrays.slice([1, 2, 3, 4], 1, -1), [2, 3]) |> assert();
+			same(arrays.slice([1, 2, 3], 3), []) |> assert();
+			same(arrays.reverse([1, 2, 3]), [3, 2, 1]) |> assert();
+			same(arrays.concat([1], [2, 3], []), [1, 2, 3]) |> assert();
+			same([1, 2] |> arrays.flatMap(|x| [x, x * 10]), [1, 10, 2, 20]) |> assert();
+			same(arrays.flatten([1, [2, [3, [4]]]], 2) |> arrays.slice(0, 3), [1, 2, 3]) |> assert();
+			pairs := arrays.zip([1, 2, 3], ["a", "b"]);
+			len(pairs) == 2 && pairs[1][1] == "b" |> assert();
+
+			groups := people |> arrays.groupBy(|p| p.age);
+			len(groups["30"]) == 2 && len(groups["20"]) == 1 |> assert();
+			chunks := arrays.chunk([1, 2, 3, 4, 5], 2);
+			len(chunks) == 3 && same(chunks[2], [5]) |> assert();
+			same(arrays.unique([1, 2, 1, 3, 2]), [1, 2, 3]) |> assert();
+			len(people |> arrays.unique(|p| p.age)) == 2 |> assert();
+			arrays.indexOf([5, 6, 7], 7) == 2 |> assert();
+			arrays.indexOf([5, 6, 7], |x| x > 5) == 1 |> assert();
+			arrays.indexOf([5, 6, 7], 8) == -1 |> assert();
+
+			xs := [1, 2, 3];
+			arrays.insert(xs, 1, 9);
+			same(xs, [1, 9, 2, 3]) |> assert();
+			arrays.removeAt(xs, -1) == 3 |> assert();
+			arrays.pop(xs) == 2 |> assert();
+			arrays.shift(xs) == 1 |> assert();
+			same(xs, [9]) |> assert();
+			arrays.pop([]) == nil |> assert();
+
+			arrays.some([1, 2], |x| x > 1) |> assert();
+			!arrays.every([1, 2], |x| x > 1) |> assert();
+			arrays.sum([1, 2, 3]) == 6 |> assert();
+			arrays.min([3, 1, 2]) == 1 |> assert();
+			arrays.max(["b", "c", "a"]) == "c" |> assert();
+			(people |> arrays.max(|p| p.age)).name == "c" |> assert();
+			arrays.binarySearch([1, 3, 5, 7], 5) == 2 |> assert();
+			arrays.binarySearch([1, 3, 5, 7], 4) == -1 |> assert();
+		`,
+		75: `
+			arrays := import("arrays");
+
+			(try arrays.sort([1, "a"])) |> isError() |> assert();
+			(try arrays.sort([2, 1], |a, b| "x")) |> isError() |> assert();
+			(try arrays.sort([2, 1], |a, b| raise error("boom"))) |> error.is("boom") |> assert();
+			(try arrays.sort("abc")) |> isError() |> assert();
+			(try arrays.reduce([], |acc, x| acc)) |> isError() |> assert();
+			(try arrays.slice([1, 2], 3)) |> isError() |> assert();
+			(try arrays.slice([1, 2, 3], 2, 1)) |> isError() |> assert();
+			(try arrays.flatten([1], -1)) |> isError() |> assert();
+			(try arrays.chunk([1], 0)) |> isError() |> assert();
+			(try arrays.groupBy([1], |x| [x])) |> isError() |> assert();
+			(try arrays.insert([1], 5, 0)) |> isError() |> assert();
+			(try arrays.removeAt([], 0)) |> isError() |> assert();
+			(try arrays.insert(freeze([1]), 0, 0)) |> isError() |> assert();
+			(try arrays.pop(freeze([1]))) |> isError() |> assert();
+			(try arrays.sum([1, "2"])) |> isError() |> assert();
+			(try arrays.min([])) |> isError() |> assert();
+			(try arrays.every([1], |x| raise error("boom"))) |> error.is("boom") |> assert();
+		`,
+		76: `
+			objects := import("objects");
+			arrays := import("arrays");
+			same := |a, b| len(a) == len(b) && arrays.zip(a, b) |> arrays.every(|p| p[0] == p[1]);
+
+			user := {name: "joe", age: 30, address: {city: "cairo", zip: "123"}, tags: ["a", "b"]};
+			same(objects.keys(user), ["address", "age", "name", "tags"]) |> assert();
+			arrays.sum(objects.values({b: 2, a: 1})) == 3 |> assert();
+			entries := objects.entries({a: 1});
+			entries[0][0] == "a" && entries[0][1] == 1 |> assert();
+			rebuilt := objects.entries(user) |> objects.fromEntries();
+			rebuilt.name == "joe" |> assert();
+
+			objects.has(user, "age") |> assert();
+			!objects.has(user, "missing") |> assert();
+			copy := objects.clone(user);
+			objects.delete(copy, "age") |> assert();
+			!objects.delete(copy, "age") |> assert();
+			objects.has(user, "age") && !objects.has(copy, "age") |> assert();
+
+			merged := objects.merge({a: 1, b: {x: 1}}, {b: {y: 2}, c: 3});
+			merged.a == 1 && merged.c == 3 && merged.b.x == nil |> assert();
+			deep := objects.deepMerge({a: 1, b: {x: 1}}, {b: {y: 2}});
+			deep.b.x == 1 && deep.b.y == 2 |> assert();
+
+			cloned := objects.deepClone(user);
+			cloned.address.city = "giza";
+			user.address.city == "cairo" |> assert();
+
+			same(objects.pick(user, ["name", "nope"]) |> objects.keys(), ["name"]) |> assert();
+			same(objects.omit(user, ["address", "tags"]) |> objects.keys(), ["age", "name"]) |> assert();
+			doubled := {a: 1, b: 2} |> objects.mapValues(|val, key| key + string(val * 2));
+			doubled.a == "a2" && doubled.b == "b4" |> assert();
+
+			objects.get(user, "address.city") == "cairo" |> assert();
+			objects.get(user, "tags.1") == "b" |> assert();
+			objects.get(user, "address.street", "none") == "none" |> assert();
+			objects.get(user, "tags.5") == nil |> assert();
+
+			frozen := objects.freeze({a: {b: 1}});
+			objects.isFrozen(frozen) && objects.isFrozen(frozen.a) |> assert();
+			(try objects.delete(frozen, "a")) |> isError() |> assert();
+
+			fiber := import("fiber");
+			counter := fiber.newCounter();
+			objects.has(counter, "add") |> assert();
+			arrays.indexOf(objects.keys(counter), "load") != -1 |> assert();
+
+			(try objects.keys([1])) |> isError() |> assert();
+			(try objects.fromEntries([["a"]])) |> isError() |> assert();
+			(try objects.fromEntries([[1, 2]])) |> isError() |> assert();
+			(try objects.pick(user, [1])) |> isError() |> assert();
+			(try objects.merge(user, 1)) |> isError() |> assert();
+			(try objects.mapValues(user, |val, key| raise error("boom"))) |> error.is("boom") |> assert();
+		`,
+		77: `
+			iter := import("iter");
+			arrays := import("arrays");
+			same := |a, b| len(a) == len(b) && arrays.zip(a, b) |> arrays.every(|p| p[0] == p[1]);
+
+			calls := 0;
+			evens := iter.range(1000000)
+				|> iter.map(|x| {
+					calls = calls + 1;
+					return x * 2;
+				})
+				|> iter.filter(|x| x % 4 == 0)
+				|> iter.take(3)
+				|> iter.collect();
+			same(evens, [0, 4, 8]) |> assert();
+			calls == 5 |> assert();
+
+			same(iter.range(5, 0, -2) |> iter.collect(), [5, 3, 1]) |> assert();
+			same(iter.from("abc") |> iter.skip(1) |> iter.collect(), ["b", "c"]) |> assert();
+			same(iter.from({b: 1, a: 2}) |> iter.collect(), ["a", "b"]) |> assert();
+			same([1, 2, 3, 1] |> iter.takeWhile(|x| x < 3) |> iter.collect(), [1, 2]) |> assert();
+
+			pairs := ["a", "b"] |> iter.enumerate() |> iter.collect();
+			pairs[1][0] == 1 && pairs[1][1] == "b" |> assert();
+			zipped := iter.zip(iter.range(10), ["x", "y"]) |> iter.collect();
+			len(zipped) == 2 && zipped[1][0] == 1 && zipped[1][1] == "y" |> assert();
+			same(iter.chain([1], iter.range(2, 4)) |> iter.collect(), [1, 2, 3]) |> assert();
+
+			chunks := iter.range(5) |> iter.chunk(2) |> iter.collect();
+			len(chunks) == 3 && same(chunks[2], [4]) |> assert();
+			windows := iter.range(4) |> iter.window(3) |> iter.collect();
+			len(windows) == 2 && same(windows[1], [1, 2, 3]) |> assert();
+
+			(iter.range(5) |> iter.reduce(|acc, x| acc + x)) == 10 |> assert();
+			(iter.range(0) |> iter.reduce(|acc, x| acc + x, 7)) == 7 |> assert();
+			total := 0;
+			iter.range(4) |> iter.forEach(|x| total = total + x);
+			total == 6 |> assert();
+
+			pulled := 0;
+			for (x in iter.range(1000000) |> iter.map(|x| {
+				pulled = pulled + 1;
+				return x;
+			})) {
+				if (x == 2) {
+					break
+				}
+			}
+			pulled == 3 |> assert();
+		`,
+		78: `
+			iter := import("iter");
+
+			boom := |x| {
+				if (x == 2) {
+					raise error("boom");
+				}
+				return x;
+			};
+			(try iter.range(5) |> iter.map(boom) |> iter.collect()) |> error.is("boom") |> assert();
+			(try iter.range(5) |> iter.filter(boom) |> iter.forEach(|x| x)) |> error.is("boom") |> assert();
+			(try iter.zip(iter.range(5) |> iter.map(boom), [1, 2, 3]) |> iter.collect()) |> error.is("boom") |> assert();
+
+			seen := 0;
+			try {
+				for (x in iter.range(5) |> iter.map(boom)) {
+					seen = seen + 1;
+				}
+			} catch (e) {
+				error.is(e, "boom") |> assert();
+			}
+			seen == 2 |> assert();
+
+			(try iter.range(1, 2, 0)) |> isError() |> assert();
+			(try iter.from(1)) |> isError() |> assert();
+			(try iter.chunk([1], 0)) |> isError() |> assert();
+			(try iter.take([1], -1)) |> isError() |> assert();
+			(try iter.map([1], 1)) |> isError() |> assert();
+			(try iter.reduce([], |acc, x| acc)) |> isError() |> assert();
+		`,
+		79: `
+			regex := import("regex");
+			arrays := import("arrays");
+			same := |a, b| len(a) == len(b) && arrays.zip(a, b) |> arrays.every(|p| p[0] == p[1]);
+
+			re := regex.compile("(\w+)@(\w+)\.com");
+			re.pattern == "(\w+)@(\w+)\.com" |> assert();
+			re.test("mail joe@example.com now") |> assert();
+			!re.test("nothing here") |> assert();
+			re.find("a@b.com, c@d.com") == "a@b.com" |> assert();
+			re.find("none") == nil |> assert();
+			same(re.findAll("a@b.com, c@d.com"), ["a@b.com", "c@d.com"]) |> assert();
+			same(re.findAll("a@b.com, c@d.com", 1), ["a@b.com"]) |> assert();
+			same(re.captures("x joe@site.com"), ["joe@site.com", "joe", "site"]) |> assert();
+			re.captures("none") == nil |> assert();
+			len(re.capturesAll("a@b.com c@d.com")) == 2 |> assert();
+
+			named := regex.compile("(?P<key>\w+)=(?P<val>\w*)(?P<rest>;)?");
+			groups := named.groups("name=joe");
+			groups.key == "name" && groups.val == "joe" && groups.rest == nil |> assert();
+
+			re.replace("joe@site.com", "$2:$1") == "site:joe" |> assert();
+			re.replace("a@b.com c@d.com", |m, c| c[1]) == "a c" |> assert();
+			same(regex.compile("\s*,\s*").split("a , b,c"), ["a", "b", "c"]) |> assert();
+			regex.test("^\d+$", "123") |> assert();
+			regex.quote("a.b") == "a\.b" |> assert();
+
+			classify := |line| {
+				match line {
+					regex("^(?P<level>[A-Z]+): (?P<msg>.*)$", {level: "ERROR", msg}) => {
+						return "error " + msg;
+					},
+					regex("^(?P<level>[A-Z]+): (?P<msg>.*)$", {level}) => {
+						return "other " + level;
+					},
+					regex("^(\d+)-(\d+)$", [_, from, to]) => {
+						return number(to) - number(from);
+					},
+					regex("^#") => {
+						return "comment";
+					},
+					_ => {
+						return "unknown";
+					},
+				}
+			};
+			classify("ERROR: disk full") == "error disk full" |> assert();
+			classify("INFO: ok") == "other INFO" |> assert();
+			classify("3-10") == 7 |> assert();
+			classify("# hi") == "comment" |> assert();
+			classify(42) == "unknown" |> assert();
+			classify("plain") == "unknown" |> assert();
+
+			(try regex.compile("(")) |> isError() |> assert();
+			(try re.replace("a@b.com", |m, c| 1)) |> isError() |> assert();
+			(try re.replace("a@b.com", |m, c| raise error("boom"))) |> error.is("boom") |> assert();
+			(try re.findAll("a", "x")) |> isError() |> assert();
+		`,
+		80: `
+			strings := import("strings");
+			arrays := import("arrays");
+			same := |a, b| len(a) == len(b) && arrays.zip(a, b) |> arrays.every(|p| p[0] == p[1]);
+
+			s := "héllo wörld";
+			len(s) == 11 && strings.length(s) == 11 |> assert();
+			len(strings.bytes(s)) == 13 |> assert();
+			strings.substring(s, 1, 5) == "éllo" |> assert();
+			strings.substring(s, 6) == "wörld" |> assert();
+			strings.indexOf(s, "wörld") == 6 |> assert();
+			strings.lastIndexOf("ööö", "ö") == 2 |> assert();
+			strings.padStart("é", 3, "ü") == "üüé" |> assert();
+			strings.padEnd("é", 4, "ab") == "éaba" |> assert();
+
+			same(strings.chars("aé😀"), ["a", "é", "😀"]) |> assert();
+			same(strings.runes("aé"), [97, 233]) |> assert();
+			same(strings.bytes("é"), [195, 169]) |> assert();
+			strings.codePointAt("aé", 1) == 233 |> assert();
+			strings.codePointAt("aé", 5) == nil |> assert();
+			strings.fromCodePoints(104, 233) == "hé" |> assert();
+
+			decomposed := strings.normalize("é", "NFD");
+			len(decomposed) == 2 && len(strings.bytes(decomposed)) == 3 |> assert();
+			strings.normalize(decomposed) == "é" |> assert();
+			len(strings.graphemes(decomposed)) == 1 |> assert();
+			same(strings.graphemes("a🇪🇬👍🏽b"), ["a", "🇪🇬", "👍🏽", "b"]) |> assert();
+			len(strings.graphemes("👨‍👩‍👧")) == 1 |> assert();
+
+			strings.repeat("ab", 3) == "ababab" |> assert();
+			strings.title("hello wörld") == "Hello Wörld" |> assert();
+			strings.fold("Straße") == strings.fold("STRASSE") |> assert();
+			strings.equalFold("Σίσυφος", "ΣΊΣΥΦΟΣ") |> assert();
+
+			sb := strings.builder();
+			for (i in 1..3) {
+				sb.write(i, ",");
+			}
+			sb.writeLine("done");
+			sb.toString() == "1,2,3,done" + strings.fromCodePoints(10) |> assert();
+			sb.reset();
+			sb.toString() == "" |> assert();
+
+			(try strings.repeat("a", -1)) |> isError() |> assert();
+			(try strings.normalize("a", "NFX")) |> isError() |> assert();
+			(try strings.fromCodePoints(-1)) |> isError() |> assert();
+			(try sb.write(error("boom"))) |> error.is("boom") |> assert();
+		`,
+		81: `
+			strings := import("strings");
+
+			strings.fmt("{} + {} = {}", 1, 2, 3) == "1 + 2 = 3" |> assert();
+			strings.fmt("{} {}", "only") == "only {}" |> assert();
+			strings.fmt("\{} {}", "x") == "{} x" |> assert();
+			strings.fmt("{1} {0} {1}", "a", "b") == "b a b" |> assert();
+			strings.fmt("{name} is {age}", {name: "joe", age: 30}) == "joe is 30" |> assert();
+			strings.fmt("{user.name}", {user: {name: "ann"}}) == "ann" |> assert();
+
+			strings.fmt("[{:>6}]", "ab") == "[    ab]" |> assert();
+			strings.fmt("[{:<6}]", "ab") == "[ab    ]" |> assert();
+			strings.fmt("[{:*^6}]", "ab") == "[**ab**]" |> assert();
+			strings.fmt("[{:6}]", 42) == "[    42]" |> assert();
+			strings.fmt("{:.2f}", 3.14159) == "3.14" |> assert();
+			strings.fmt("{:.2}", 2.5) == "2.50" |> assert();
+			strings.fmt("{:x} {:X} {:o} {:b}", 255, 255, 8, 5) == "ff FF 10 101" |> assert();
+			strings.fmt("{:08d}", -42) == "-0000042" |> assert();
+			strings.fmt("{:+d}", 7) == "+7" |> assert();
+			strings.fmt("{:.1%}", 0.256) == "25.6%" |> assert();
+			strings.fmt("{:.3}", "abcdef") == "abc" |> assert();
+			q := strings.fromCodePoints(34);
+			strings.fmt("{:?}", "hi") == q + "hi" + q |> assert();
+			strings.fmt("{:?}", [1, "a", {b: nil}]) == strings.replace("[1, 'a', {b: nil}]", "'", q) |> assert();
+			strings.fmt("{0:?}", error("boom")) == strings.replace("error('boom')", "'", q) |> assert();
+
+			(try strings.fmt("{:d}", 1.5)) |> isError() |> assert();
+			(try strings.fmt("{:d}", "x")) |> isError() |> assert();
+			strings.fmt("{:z}", 1) == "{:z}" |> assert();
+			strings.fmt("{3}", 1) == "{3}" |> assert();
+			strings.fmt("{missing}", {a: 1}) == "{missing}" |> assert();
+			strings.fmt("{name}", 1) == "{name}" |> assert();
+			strings.fmt("literal {x y} {}", 1) == "literal {x y} 1" |> assert();
+			strings.fmt("{" + q + "a" + q + ": 1} {a}", {a: 2}) == "{" + q + "a" + q + ": 1} 2" |> assert();
+			(try strings.fmt("{}", error("boom"))) |> error.is("boom") |> assert();
+
+			inspect({b: [1, 2], a: "x"}, {indent: 0}) == strings.replace("{a: 'x', b: [1, 2]}", "'", q) |> assert();
+			nested := inspect({a: [1, {b: 2}]});
+			nested == strings.replace("{|  a: [|    1,|    {|      b: 2|    }|  ]|}", "|", strings.fromCodePoints(10)) |> assert();
+			inspect([[[1]]], {depth: 1, indent: 0}) == "[[...]]" |> assert();
+
+			loop := {name: "loop"};
+			loop.self = loop;
+			items := [loop, loop];
+			inspect(items, {indent: 0}) == strings.replace("[{name: 'loop', self: <cycle object>}, {name: 'loop', self: <cycle object>}]", "'", q) |> assert();
+			arr := [1];
+			push(arr, arr);
+			inspect(arr, {indent: 0}) == "[1, <cycle array>]" |> assert();
+
+			fiber := import("fiber");
+			inspect(fiber.newChannel(2), {}) == "<channel 0/2>" |> assert();
+			inspect(fiber.run(|| 1)) == "<task>" |> assert();
+			inspect(fiber.newLock()) == "<lock>" |> assert();
+			inspect(|| 1) == "<function>" |> assert();
+			strings.startsWith(inspect(fiber.newCounter()), "<native object") |> assert();
+			(try inspect(1, {depth: -1})) |> isError() |> assert();
+			(try inspect(1, {bogus: 1})) |> isError() |> assert();
+		`,
+		82: `
+			json := import("json");
+			strings := import("strings");
+			iter := import("iter");
+			io := import("io");
+			nl := strings.fromCodePoints(10);
+			q := strings.fromCodePoints(34);
+			j := |s| strings.replace(s, "'", q);
+
+			json.stringify({b: [1, nil, true], a: "x<y"}) == j("{'a':'x<y','b':[1,null,true]}") |> assert();
+			pretty := json.stringify({a: [1, 2], b: {}}, {indent: 2});
+			pretty == strings.replace(j("{|  'a': [|    1,|    2|  ],|  'b': {}|}"), "|", nl) |> assert();
+			json.stringify([], {indent: "	"}) == "[]" |> assert();
+
+			parsed := json.parse(j("{'a': null, 'n': 9007199254740993, 'f': 1.5}"));
+			parsed.a == nil && parsed.f == 1.5 |> assert();
+			exact := json.parse(j("{'n': 9007199254740993, 'm': 12, 'big': 123456789012345678901234}"), {exact: true});
+			exact.n == "9007199254740993" && exact.m == 12 && exact.big == "123456789012345678901234" |> assert();
+
+			revived := json.parse(j("{'a': 1, 'b': [2, 3]}"), |key, val| {
+				if (type(val) == "number") {
+					return val * 10;
+				}
+				return val;
+			});
+			revived.a == 10 && revived.b[1] == 30 |> assert();
+
+			err := try json.parse("{" + nl + j("  'a': 1,") + nl + "  }");
+			isError(err) && err.data.line == 3 && err.data.column == 3 |> assert();
+			err2 := try json.parse(j("{'a': "));
+			isError(err2) && err2.data.line == 1 |> assert();
+			(try json.parse("1 2")) |> isError() |> assert();
+			(try json.parse(strings.repeat("[", 20000))) |> isError() |> assert();
+
+			doc := j("{'z':1,'a':{'y':2,'b':3},'m':[{'c':1,'b':2}]}");
+			ordered := json.parse(doc);
+			json.stringify(ordered, {sortKeys: false}) == doc |> assert();
+			json.stringify(ordered) == j("{'a':{'b':3,'y':2},'m':[{'b':2,'c':1}],'z':1}") |> assert();
+			ordered.k = 4;
+			ordered.z = 5;
+			json.stringify(ordered, {sortKeys: false}) == j("{'z':5,'a':{'y':2,'b':3},'m':[{'c':1,'b':2}],'k':4}") |> assert();
+			json.stringify({b: 1, a: 2}, {sortKeys: false}) == j("{'a':2,'b':1}") |> assert();
+			visited := [];
+			json.parse(j("{'z': 1, 'a': 2}"), |key, val| {
+				visited |> push(key);
+				return val;
+			});
+			visited[0] == "z" && visited[1] == "a" |> assert();
+
+			lines := j("{'id': 1}") + nl + j("{'id': 2}") + nl + j("{'id': 3}") + nl;
+			ids := json.decoder(lines) |> iter.map(|x| x.id) |> iter.collect();
+			len(ids) == 3 && ids[2] == 3 |> assert();
+			firstTwo := json.decoder(lines) |> iter.take(2) |> iter.collect();
+			len(firstTwo) == 2 |> assert();
+
+			items := json.decoder("[1, [2], {}, 4]", {array: true}) |> iter.collect();
+			len(items) == 4 && items[1][0] == 2 |> assert();
+			count := 0;
+			for (x in json.decoder("[1, 2, 3]", {array: true})) {
+				count = count + 1;
+			}
+			count == 3 |> assert();
+
+			bad := j("{'id': 1}") + nl + j("{'id': }");
+			seen := 0;
+			try {
+				for (x in json.decoder(bad)) {
+					seen = seen + 1;
+				}
+			} catch (e) {
+				e.data.line == 2 && e.data.column == 8 |> assert();
+			}
+			seen == 1 |> assert();
+			(try json.decoder(j("{'id': [1,")) |> iter.collect()) |> isError() |> assert();
+			(try json.decoder("{}", {array: true}) |> iter.collect()) |> isError() |> assert();
+
+			loop := {};
+			loop.self = loop;
+			(try json.stringify(loop)) |> isError() |> assert();
+			(try json.stringify(0 / 0)) |> isError() |> assert();
+			(try json.stringify(1, {indent: true})) |> isError() |> assert();
+			(try json.decoder(1)) |> isError() |> assert();
+
+			path := io.join(tempDir(), "items.ndjson");
+			io.writeFile(path, lines);
+			f := io.open(path);
+			fromFile := json.decoder(f) |> iter.map(|x| x.id) |> iter.collect();
+			f.close();
+			len(fromFile) == 3 && fromFile[0] == 1 && fromFile[2] == 3 |> assert();
+			io.writeFile(path, "[1, 2, 3]");
+			f2 := io.open(path);
+			(json.decoder(f2, {array: true}) |> iter.reduce(|acc, x| acc + x, 0)) == 6 |> assert();
+			f2.close();
+		`,
+		83: `
+			schema := import("schema");
+			arrays := import("arrays");
+			strings := import("strings");
+			q := strings.fromCodePoints(34);
+			j := |s| strings.replace(s, "'", q);
+
+			user := schema.compile({
+				type: "object",
+				required: ["name", "age"],
+				properties: {
+					name: {type: "string", minLength: 2, pattern: "^[a-z]+$"},
+					age: {type: "integer", minimum: 0, exclusiveMaximum: 150},
+					role: {enum: ["admin", "user"]},
+					tags: {type: "array", items: {type: "string"}, maxItems: 2, uniqueItems: true},
+				},
+				additionalProperties: false,
+			});
+
+			user.isValid({name: "joe", age: 30, role: "admin", tags: ["a"]}) |> assert();
+			ok := user.validate({name: "joe", age: 30});
+			ok.valid && len(ok.errors) == 0 |> assert();
+
+			res := user.validate({name: "J", age: 1.5, role: "root", tags: ["a", 1, "a"], extra: 1});
+			!res.valid |> assert();
+			paths := res.errors |> map(|e| e.path + ":" + e.keyword);
+			expected := ["/age:type", "/extra:additionalProperties", "/name:minLength", "/name:pattern", "/role:enum", "/tags:maxItems", "/tags:uniqueItems", "/tags/1:type"];
+			len(paths) == len(expected) |> assert();
+			arrays.zip(paths, expected) |> arrays.every(|p| p[0] == p[1]) |> assert();
+
+			missing := user.validate({});
+			len(missing.errors) == 2 && missing.errors[0].path == "" && missing.errors[0].keyword == "required" |> assert();
+			user.validate("x").errors[0].message == "must be object, got string" |> assert();
+
+			err := try user.assert({name: "joe"});
+			isError(err) && len(err.data) == 1 && err.data[0].keyword == "required" |> assert();
+			user.assert({name: "joe", age: 1}).name == "joe" |> assert();
+
+			fromJSON := schema.compile(j("{'oneOf': [{'type': 'number', 'multipleOf': 2}, {'type': 'number', 'multipleOf': 3}]}"));
+			fromJSON.isValid(4) && fromJSON.isValid(9) && !fromJSON.isValid(6) && !fromJSON.isValid(5) |> assert();
+			fromJSON.validate(6).errors[0].message == "must match exactly one schema in oneOf, matched 2" |> assert();
+
+			anyOf := {anyOf: [{type: "string"}, {type: "null"}], not: {const: "no"}};
+			schema.validate(anyOf, nil).valid && schema.validate(anyOf, "x").valid |> assert();
+			!schema.validate(anyOf, 1).valid && !schema.validate(anyOf, "no").valid |> assert();
+			schema.validate({properties: {"a/b": false}}, {"a/b": 1}).errors[0].path == "/a~1b" |> assert();
+			schema.validate({type: ["string", "null"], const: [1, {a: 2}]}, nil).errors[0].keyword == "const" |> assert();
+
+			(try schema.compile({type: "nope"})) |> isError() |> assert();
+			(try schema.compile({pattern: "("})) |> isError() |> assert();
+			(try schema.compile({minLength: -1})) |> isError() |> assert();
+			(try schema.compile({items: 1})) |> isError() |> assert();
+			(try schema.compile("{")) |> isError() |> assert();
+		`,
+		84: `
+			yaml := import("yaml");
+			toml := import("toml");
+			strings := import("strings");
+			time := import("time");
+			nl := strings.fromCodePoints(10);
+			lines := |s| strings.replace(s, "|", nl);
+
+			cfg := yaml.parse(lines("name: app|port: 8080|ratio: 0.5|debug: true|empty: null|created: 2024-01-02T03:04:05Z|day: 2024-01-02|quoted: '2024-01-02'|tags: [a, b]|base: &base|  host: localhost|  port: 1|prod:|  <<: *base|  port: 2|"));
+			cfg.name == "app" && cfg.port == 8080 && cfg.ratio == 0.5 && cfg.debug && cfg.empty == nil |> assert();
+			type(cfg.created) == "time" && type(cfg.day) == "time" && type(cfg.quoted) == "string" |> assert();
+			time.format(cfg.created, "2006-01-02 15:04:05") == "2024-01-02 03:04:05" |> assert();
+			cfg.tags[1] == "b" && cfg.prod.host == "localhost" && cfg.prod.port == 2 |> assert();
+
+			out := yaml.stringify({b: [1, 2.5], a: "x", c: {d: nil}});
+			out == lines("a: x|b:|  - 1|  - 2.5|c:|  d: null|") |> assert();
+			yaml.stringify(yaml.parse(out)) == out |> assert();
+			yaml.stringify({a: {b: 1}}, {indent: 4}) == lines("a:|    b: 1|") |> assert();
+			roundTime := yaml.parse(yaml.stringify({t: cfg.created}));
+			type(roundTime.t) == "time" |> assert();
+
+			docs := yaml.parseAll(lines("a: 1|---|a: 2|---|- x|"));
+			len(docs) == 3 && docs[0].a == 1 && docs[1].a == 2 && docs[2][0] == "x" |> assert();
+			yaml.stringifyAll([{a: 1}, [1]]) == lines("a: 1|---|- 1|") |> assert();
+			yaml.parse("") == nil && len(yaml.parseAll("")) == 0 |> assert();
+			(try yaml.parse("a: [1")) |> isError() |> assert();
+			cyclic := {};
+			cyclic.self = cyclic;
+			(try yaml.stringify(cyclic)) |> isError() |> assert();
+			(try yaml.stringify({a: 1}, {indent: -1})) |> isError() |> assert();
+			(try yaml.stringify({a: 1}, {indent: 1.5})) |> isError() |> assert();
+
+			names := "abcdefghi";
+			laughs := "a: &a [x, x, x, x, x, x, x, x, x]";
+			for (i := 1; i < 9; i++) {
+				prev := "*" + strings.substring(names, i - 1, i);
+				name := strings.substring(names, i, i + 1);
+				laughs = laughs + nl + name + ": &" + name + " [" + strings.repeat(prev + ", ", 8) + prev + "]";
+			}
+			(try yaml.parse(laughs)) |> isError() |> assert();
+			small := yaml.parse(lines("a: &a [x, x]|b: [*a, *a]|"));
+			len(small.b) == 2 && small.b[1][1] == "x" |> assert();
+
+			ordered := lines("name: app|zone: 1|base: &base|  zhost: h|  port: 1|prod:|  <<: *base|  port: 2|  items:|    - z: 1|      a: 2|");
+			yaml.stringify(yaml.parse(ordered)) == lines("name: app|zone: 1|base:|  zhost: h|  port: 1|prod:|  zhost: h|  port: 2|  items:|    - z: 1|      a: 2|") |> assert();
+			grown := yaml.parse(lines("z: 1|a: 2|"));
+			grown.m = 3;
+			yaml.stringify(grown) == lines("z: 1|a: 2|m: 3|") |> assert();
+
+			conf := toml.parse(lines("title = 'x'|[server]|port = 80|hosts = ['a', 'b']|started = 1979-05-27T07:32:00Z|[[users]]|name = 'a'|[[users]]|name = 'b'|"));
+			conf.title == "x" && conf.server.port == 80 && conf.server.hosts[1] == "b" |> assert();
+			type(conf.server.started) == "time" && len(conf.users) == 2 && conf.users[1].name == "b" |> assert();
+
+			tout := toml.stringify({title: "x", n: 1.5, skip: nil, server: {port: 80}});
+			q := strings.fromCodePoints(34);
+			tout == strings.replace(lines("n = 1.5|title = 'x'||[server]|  port = 80|"), "'", q) |> assert();
+			toml.stringify(toml.parse(tout)) == tout |> assert();
+			tdoc := strings.replace(lines("title = 'x'|alpha = 1||[server]|  port = 80|  host = 'h'|  [server.z]|    b = 1||[[users]]|  name = 'a'|  id = 1||[[users]]|  name = 'b'|  id = 2|"), "'", q);
+			toml.stringify(toml.parse(tdoc)) == tdoc |> assert();
+
+			err := try toml.parse(lines("a = 1|b = |"));
+			isError(err) && err.data.line == 2 |> assert();
+			(try toml.stringify([1])) |> isError() |> assert();
+			(try toml.stringify({a: {b: 1}}, {indent: -2})) |> isError() |> assert();
+		`,
+		85: `
+			csv := import("csv");
+			io := import("io");
+			strings := import("strings");
+			iter := import("iter");
+			nl := strings.fromCodePoints(10);
+			q := strings.fromCodePoints(34);
+			text := |s| strings.replace(strings.replace(s, "|", nl), "'", q);
+
+			data := text("name,age,note|joe,30,'hello, world'|ann,25,'say ''hi'''|");
+			rows := csv.parse(data);
+			len(rows) == 3 && rows[1][2] == "hello, world" && rows[2][2] == "say " + q + "hi" + q |> assert();
+
+			people := csv.parse(data, {header: true, infer: true});
+			len(people) == 2 && people[0].name == "joe" && people[0].age == 30 && people[1].age == 25 |> assert();
+			typed := csv.parse("1.5,true,007,,1e3,0x10,abc,0,0.5,-0.25,00.5", {infer: true})[0];
+			typed[0] == 1.5 && typed[1] == true && typed[2] == "007" && typed[3] == "" && typed[4] == 1000 && typed[5] == "0x10" |> assert();
+			typed[7] == 0 && typed[8] == 0.5 && typed[9] == -0.25 && typed[10] == "00.5" |> assert();
+			keyed := csv.parse("a;b" + nl + "#skip" + nl + "c;d", {delimiter: ";", comment: "#", header: ["x", "y"]});
+			len(keyed) == 2 && keyed[0].x == "a" && keyed[1].y == "d" |> assert();
+
+			err := try csv.parse(text("a,b|c,d,e|"));
+			isError(err) && err.data.line == 2 |> assert();
+			(try csv.parse("a", {delimiter: ";;"})) |> isError() |> assert();
+			short := csv.parse(text("a,b,c|1|2,3|"), {header: true});
+			short[0].a == "1" && short[0].b == nil && short[1].b == "3" && short[1].c == nil |> assert();
+			long := try csv.parse(text("a,b|1,2|3,4,5|"), {header: true});
+			isError(long) && long.data.line == 3 |> assert();
+
+			out := csv.stringify([{name: "joe", note: "a, b"}, {name: "ann", note: "x" + q}]);
+			out == text("name,note|joe,'a, b'|ann,'x'''|") |> assert();
+			csv.stringify([[1, true, nil]]) == "1,true," + nl |> assert();
+			csv.parse(out, {header: true})[1].note == "x" + q |> assert();
+			(try csv.stringify([[[1]]])) |> isError() |> assert();
+
+			w := csv.writer({header: ["b", "a"], delimiter: "	"});
+			w.write({a: 1, b: 2});
+			w.write([3, 4]);
+			w.toString() == text("b	a|2	1|3	4|") |> assert();
+
+			path := io.join(tempDir(), "weaver_csv_test.csv");
+			f := io.open(path, "w");
+			fw := csv.writer(f);
+			fw.writeAll(iter.range(1000) |> iter.map(|i| [i, i * 2]) |> iter.collect());
+			f.close();
+
+			rf := io.open(path);
+			total := csv.reader(rf, {infer: true}) |> iter.reduce(|acc, row| acc + row[1], 0);
+			rf.close();
+			total == 999000 |> assert();
+			rf2 := io.open(path);
+			rf2.read(4) == "0,0" + nl && len(rf2.read()) > 0 && rf2.read() == nil |> assert();
+			rf2.close();
+			(try io.open(path, "x")) |> isError() |> assert();
+			io.remove(path);
+
+			bad := csv.reader(text("a|'b|"));
+			(try iter.collect(bad)) |> isError() |> assert();
+		`,
+		86: `
+			encoding := import("encoding");
+			strings := import("strings");
+			b64 := encoding.base64;
+			hex := encoding.hex;
+			url := encoding.url;
+			bin := encoding.binary;
+
+			b64.encode("hello?>") == "aGVsbG8/Pg==" && b64.encode("hello?>", "url") == "aGVsbG8_Pg==" |> assert();
+			b64.encode("hello?>", "rawUrl") == "aGVsbG8_Pg" && b64.encode("hi", "rawStd") == "aGk" |> assert();
+			b64.decode("aGVsbG8/Pg==") == "hello?>" && b64.decode("aGVsbG8_Pg", "rawUrl") == "hello?>" |> assert();
+			(try b64.decode("!!")) |> isError() |> assert();
+			(try b64.encode("x", "nope")) |> isError() |> assert();
+
+			hex.encode("Hi!") == "486921" && hex.decode("486921") == "Hi!" |> assert();
+			(try hex.decode("4")) |> isError() |> assert();
+
+			url.queryEscape("a b&c=d/é") == "a+b%26c%3Dd%2F%C3%A9" && url.queryUnescape("a+b%26c") == "a b&c" |> assert();
+			url.pathEscape("a b/c") == "a%20b%2Fc" && url.pathUnescape("a%20b") == "a b" |> assert();
+			(try url.queryUnescape("%zz")) |> isError() |> assert();
+
+			packed := bin.pack(">HiB", 258, -2, 255);
+			hex.encode(packed) == "0102fffffffeff" && bin.size(">HiB") == 7 |> assert();
+			hex.encode(bin.pack("<H", 258)) == "0201" && hex.encode(bin.pack("2b", -1, 1)) == "ff01" |> assert();
+			vals := bin.unpack(">HiB", packed);
+			vals[0] == 258 && vals[1] == -2 && vals[2] == 255 |> assert();
+			floats := bin.unpack("<fd?", bin.pack("<fd?", 1.5, -0.25, true));
+			floats[0] == 1.5 && floats[1] == -0.25 && floats[2] == true |> assert();
+			str := bin.unpack("<4sxq", bin.pack("<4sxq", "ab", 9007199254740991));
+			str[0] == "ab" + strings.fromCodePoints(0, 0) && str[1] == 9007199254740991 |> assert();
+
+			(try bin.pack("B", 256)) |> isError() |> assert();
+			(try bin.pack("b", 1.5)) |> isError() |> assert();
+			(try bin.pack("Q", -1)) |> isError() |> assert();
+			(try bin.pack("i")) |> isError() |> assert();
+			(try bin.pack("i", 1, 2)) |> isError() |> assert();
+			(try bin.pack("z", 1)) |> isError() |> assert();
+			(try bin.unpack("i", "abc")) |> isError() |> assert();
+			(try bin.pack("<99999999999I", 1)) |> isError() |> assert();
+			(try bin.pack("<999999999999999999999I", 1)) |> isError() |> assert();
+			(try bin.pack("<60000000I", 1)) |> isError() |> assert();
+			(try bin.unpack("<60000000I", "abcd")) |> isError() |> assert();
+			(try bin.size("<99999999999q")) |> isError() |> assert();
+			bin.size("3s2x") == 5 |> assert();
+		`,
+		87: `
+			crypto := import("crypto");
+			encoding := import("encoding");
+			regex := import("regex");
+			bytes := import("bytes");
+			strings := import("strings");
+
+			crypto.sha256("abc") == "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" |> assert();
+			crypto.md5("abc") == "900150983cd24fb0d6963f7d28e17f72" && crypto.sha1("abc") == "a9993e364706816aba3e25717850c26c9cd0d89d" |> assert();
+			len(crypto.sha512("abc")) == 128 && type(crypto.sha256("abc", "raw")) == "bytes" && len(crypto.sha256("abc", "raw")) == 32 |> assert();
+			crypto.sha1("abc", "base64") == "qZk+NkcGgWq6PiVxeFDCbJzQ2J0=" |> assert();
+			(try crypto.sha256("abc", "nope")) |> isError() |> assert();
+
+			sig := crypto.hmac("sha256", "key", "The quick brown fox jumps over the lazy dog");
+			sig == "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8" |> assert();
+			crypto.compare(sig, "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8") && !crypto.compare(sig, "f7") |> assert();
+			(try crypto.hmac("sha3", "k", "d")) |> isError() |> assert();
+
+			len(crypto.randomBytes(16)) == 16 && crypto.randomBytes(8) != crypto.randomBytes(8) |> assert();
+			len(crypto.randomToken()) == 43 && len(crypto.randomToken(3)) == 4 |> assert();
+
+			uuidPattern := |v| "^[0-9a-f]{8}-[0-9a-f]{4}-" + v + "[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$";
+			regex.test(uuidPattern("4"), crypto.uuid.v4()) && regex.test(uuidPattern("7"), crypto.uuid.v7()) |> assert();
+			crypto.uuid.v4() != crypto.uuid.v4() |> assert();
+
+			bh := crypto.bcrypt.hash("secret", 4);
+			crypto.bcrypt.verify("secret", bh) && !crypto.bcrypt.verify("wrong", bh) |> assert();
+			(try crypto.bcrypt.verify("secret", "garbage")) |> isError() |> assert();
+
+			ah := crypto.argon2.hash("secret", {memory: 1024, threads: 1});
+			regex.test("^[$]argon2id[$]v=19[$]m=1024,t=1,p=1[$]", ah) |> assert();
+			crypto.argon2.verify("secret", ah) && !crypto.argon2.verify("wrong", ah) |> assert();
+			(try crypto.argon2.verify("secret", "$bcrypt$")) |> isError() |> assert();
+			(try crypto.argon2.hash("secret", {time: 0})) |> isError() |> assert();
+			(try crypto.argon2.hash("secret", {memory: 4194304})) |> isError() |> assert();
+			tampered := |from, to| try crypto.argon2.verify("secret", strings.replace(ah, from, to));
+			tampered("m=1024,t=1,p=1", "m=1024,t=0,p=1") |> isError() |> assert();
+			tampered("m=1024,t=1,p=1", "m=1024,t=1,p=0") |> isError() |> assert();
+			tampered("m=1024,t=1,p=1", "m=4294967295,t=1,p=1") |> isError() |> assert();
+			parts := strings.split(ah, "$");
+			shortKey := strings.replace(ah, parts[5], strings.substring(parts[5], 0, 10));
+			(try crypto.argon2.verify("secret", shortKey)) |> isError() |> assert();
+
+			key := crypto.randomBytes(32);
+			box := crypto.aes.encrypt(key, "attack at dawn", "id-1");
+			bytes.toString(crypto.aes.decrypt(key, box, "id-1")) == "attack at dawn" |> assert();
+			(try crypto.aes.decrypt(key, box, "id-2")) |> isError() |> assert();
+			(try crypto.aes.decrypt(crypto.randomBytes(32), box)) |> isError() |> assert();
+			(try crypto.aes.encrypt("short", "x")) |> isError() |> assert();
+
+			pair := crypto.ed25519.generateKey();
+			signature := crypto.ed25519.sign(pair.privateKey, "msg");
+			crypto.ed25519.verify(pair.publicKey, "msg", signature) && !crypto.ed25519.verify(pair.publicKey, "msg2", signature) |> assert();
+			len(encoding.hex.encode(signature)) == 128 |> assert();
+			(try crypto.ed25519.sign("short", "msg")) |> isError() |> assert();
+		`,
+		88: `
+			io := import("io");
+			iter := import("iter");
+			arrays := import("arrays");
+			bin := import("bytes");
+			encoding := import("encoding");
+
+			b := bytes("héllo");
+			type(b) == "bytes" && len(b) == 6 && b[0] == 104 && b[1] == 195 |> assert();
+			(try b[6]) |> isError() |> assert();
+			bin.toString(b) == "héllo" && bin.toString(b, "hex") == "68c3a96c6c6f" |> assert();
+			bytes("68c3a96c6c6f", "hex") == b && bytes("aMOpbGxv", "base64") == b |> assert();
+			bin.toString(bytes("hé", "latin1"), "hex") == "68e9" && bin.toString(bytes([104, 233]), "latin1") == "hé" |> assert();
+			(try bytes("zz", "hex")) |> isError() |> assert();
+			(try bytes("x", "utf16")) |> isError() |> assert();
+			(try bytes([256])) |> isError() |> assert();
+			(try bytes(["a"])) |> isError() |> assert();
+			bytes(3) == bytes([0, 0, 0]) && bytes(b) == b |> assert();
+
+			ab := bytes("ab");
+			joined := ab + bytes("cd");
+			bin.toString(joined) == "abcd" && bin.toString(ab) == "ab" && bytes("ab") != bytes("ac") |> assert();
+			(try ab + "cd") |> isError() |> assert();
+
+			total := 0;
+			for (c in bytes([1, 2, 3])) {
+				total = total + c;
+			}
+			total == 6 && len(bin.toArray(bytes("AB"))) == 2 && bytes(bin.toArray(bytes("AB"))) == bytes("AB") |> assert();
+			bytes(bytes([5, 6]) |> iter.map(|c| c * 2) |> iter.collect()) == bytes([10, 12]) |> assert();
+
+			bin.slice(joined, 1, 3) == bytes("bc") && bin.slice(joined, -2) == bytes("cd") |> assert();
+			(try bin.slice(joined, 3, 1)) |> isError() |> assert();
+			bin.concat(ab, "-", bytes("z")) == bytes("ab-z") |> assert();
+			bin.indexOf(joined, "cd") == 2 && bin.indexOf(joined, bytes("x")) == -1 |> assert();
+			bin.isValidUtf8(b) && !bin.isValidUtf8(bytes([255])) |> assert();
+			sorted := arrays.sort([bytes("b"), bytes("a")]);
+			sorted[0] == bytes("a") && sorted[1] == bytes("b") |> assert();
+
+			buf := bin.buffer();
+			buf.write("AB", 67, [68, 69], bytes("F"));
+			buf.pack(">H", 258);
+			snapshot := buf.bytes();
+			buf.write("!");
+			buf.len() == 9 && len(snapshot) == 8 && buf.toString("hex") == "4142434445460102" + "21" |> assert();
+			encoding.binary.unpack(">H", bin.slice(snapshot, 6))[0] == 258 |> assert();
+			type(encoding.binary.pack("<i", 1)) == "bytes" |> assert();
+			(try buf.write(300)) |> isError() |> assert();
+			buf.reset();
+			buf.len() == 0 |> assert();
+
+			path := io.join(tempDir(), "data.bin");
+			io.writeFile(path, bytes([0, 255, 10]));
+			io.readBytes(path) == bytes([0, 255, 10]) |> assert();
+			f := io.open(path, "a");
+			f.write(bytes([7]), "x");
+			f.close();
+			rf := io.open(path);
+			rf.readBytes(2) == bytes([0, 255]) && rf.readBytes() == bytes([10, 7, 120]) && rf.readBytes() == nil |> assert();
+			rf.close();
+		`,
+		89: `
+			io := import("io");
+			bin := import("bytes");
+			compress := import("compress");
+			csv := import("csv");
+			iter := import("iter");
+			strings := import("strings");
+
+			text := "hello hello hello hello hello hello";
+			gz := compress.gzip(text);
+			type(gz) == "bytes" && bin.toString(compress.gunzip(gz)) == text |> assert();
+			compress.gunzip(compress.gzip(bytes([0, 1, 255]), 9)) == bytes([0, 1, 255]) |> assert();
+			len(compress.gzip(text, 0)) > len(compress.gzip(text, 9)) |> assert();
+			(try compress.gzip(text, 10)) |> isError() |> assert();
+			(try compress.gunzip("not gzip")) |> isError() |> assert();
+			z := compress.zlib.compress(text);
+			bin.toString(compress.zlib.decompress(z)) == text && z != gz |> assert();
+			(try compress.zlib.decompress(gz)) |> isError() |> assert();
+
+			dir := tempDir();
+			src := io.join(dir, "src");
+			io.mkdir(io.join(src, "sub"));
+			io.writeFile(io.join(src, "a.txt"), "alpha");
+			io.writeFile(io.join(src, "sub", "b.csv"), "x,y" + strings.fromCodePoints(10) + "1,2");
+
+			zipPath := io.join(dir, "out.zip");
+			zw := compress.zip.create(zipPath);
+			zw.add("note.txt", "zipped");
+			zw.add("raw.bin", bytes([9, 8, 7]));
+			zw.addFile("tree", src);
+			zw.close();
+
+			zr := compress.zip.open(zipPath);
+			names := zr.entries() |> map(|e| e.name);
+			len(names) == 6 && contains(names, "tree/sub/b.csv") && contains(names, "tree/sub/") |> assert();
+			entry := zr.entries() |> find(|e| e.name == "note.txt");
+			entry.size == 6 && !entry.isDir && type(entry.modTime) == "time" |> assert();
+			zr.read("raw.bin") == bytes([9, 8, 7]) && bin.toString(zr.read("tree/a.txt")) == "alpha" |> assert();
+			(try zr.read("missing")) |> isError() |> assert();
+			stream := zr.open("tree/sub/b.csv");
+			rows := csv.reader(stream, {header: true, infer: true}) |> iter.collect();
+			stream.close();
+			len(rows) == 1 && rows[0].y == 2 |> assert();
+			out := io.join(dir, "unzipped");
+			len(zr.extract(out)) == 6 |> assert();
+			io.readFile(io.join(out, "tree", "sub", "b.csv")) == "x,y" + strings.fromCodePoints(10) + "1,2" |> assert();
+			zr.close();
+			compress.zip.open(io.readBytes(zipPath)).read("note.txt") == bytes("zipped") |> assert();
+			(try compress.zip.open(io.join(dir, "nope.zip"))) |> isError() |> assert();
+
+			for (tarName in ["out.tar", "out.tar.gz"]) {
+				tarPath := io.join(dir, tarName);
+				tw := compress.tar.create(tarPath);
+				tw.add("top.txt", "tarred");
+				tw.addFile("tree", src);
+				tw.close();
+
+				tr := compress.tar.open(tarPath);
+				len(tr.entries()) == 5 && bin.toString(tr.read("tree/a.txt")) == "alpha" |> assert();
+				s := tr.open("top.txt");
+				s.read(3) == "tar" && s.read() == "red" && s.read() == nil |> assert();
+				s.close();
+				tarOut := io.join(dir, tarName + "-x");
+				len(tr.extract(tarOut)) == 5 && io.readFile(io.join(tarOut, "top.txt")) == "tarred" |> assert();
+				tr.close();
+			}
+			bin.slice(io.readBytes(io.join(dir, "out.tar.gz")), 0, 2) == bytes([31, 139]) |> assert();
+			bin.slice(io.readBytes(io.join(dir, "out.tar")), 0, 2) != bytes([31, 139]) |> assert();
+			compress.tar.open(io.readBytes(io.join(dir, "out.tar.gz"))).read("top.txt") == bytes("tarred") |> assert();
+			(try compress.tar.open(bytes("garbage that is not a tar archive"))) |> isError() |> assert();
+
+			evilPath := io.join(dir, "evil.tar");
+			ew := compress.tar.create(evilPath, {gzip: true});
+			ew.add("../escaped.txt", "nope");
+			ew.close();
+			bin.slice(io.readBytes(evilPath), 0, 2) == bytes([31, 139]) |> assert();
+			(try compress.tar.open(evilPath).extract(io.join(dir, "evil"))) |> isError() |> assert();
+			!io.exists(io.join(dir, "escaped.txt")) |> assert();
+
+			evilZip := io.join(dir, "evil.zip");
+			ez := compress.zip.create(evilZip);
+			ez.add("/abs.txt", "nope");
+			ez.close();
+			(try compress.zip.open(evilZip).extract(io.join(dir, "evil"))) |> isError() |> assert();
+		`,
+		90: `
+			os := import("os");
+			crypto := import("crypto");
+			encoding := import("encoding");
+
+			name := "WEAVER_OS_TEST_" + encoding.hex.encode(crypto.randomBytes(8));
+			os.env.set(name, "on");
+			os.env.get(name) == "on" && os.env.all()[name] == "on" |> assert();
+			os.env.unset(name);
+			os.env.get(name) == nil && os.env.get(name, "off") == "off" |> assert();
+			(try os.env.set(name, 1)) |> isError() |> assert();
+
+			argv := os.args();
+			len(argv) == 2 && argv[0] == "a" && argv[1] == "--b" |> assert();
+
+			exited := try os.exit(3);
+			isError(exited) && exited.msg == "exit status 3" && exited.data == 3 |> assert();
+			(try os.exit(1.5)) |> isError() |> assert();
+
+			type(os.pid) == "number" && os.pid > 0 |> assert();
+			len(os.hostname()) > 0 && len(os.platform) > 0 && len(os.arch) > 0 |> assert();
+			(try os.onSignal("SIGKILL", |s| nil)) |> isError() |> assert();
+			(try os.onSignal("SIGINT", 1)) |> isError() |> assert();
+		`,
+		91: `
+			iter := import("iter");
+			fiber := import("fiber");
+
+			offset := 1;
+			odd := fiber.wait(fiber.run(|| iter.range(2000)
+				|> iter.map(|x| {
+					y := x * 2;
+					if (x % 50 == 0) {
+						sleep(1);
+					}
+					return y + offset;
+				})
+				|> iter.filter(|x| x % 3 == 0)
+				|> iter.take(200)));
+			sum := || {
+				total := 0;
+				for (x in odd) {
+					total = total + x;
+				}
+				return total;
+			};
+
+			expected := 0;
+			for (i := 0; i < 200; i++) {
+				expected = expected + 6 * i + 3;
+			}
+			sum() == expected |> assert();
+
+			tasks := [];
+			for (i := 0; i < 8; i++) {
+				tasks |> push(fiber.run(sum));
+				tasks |> push(fiber.run(|| odd |> iter.reduce(|acc, x| acc + x, 0)));
+			}
+			results := fiber.wait(tasks);
+			len(results) == 16 |> assert();
+			for (total in results) {
+				total == expected |> assert();
+			}
+		`,
+		92: `
+			for (i := 0; i < 300; i++) {
+				__regexMatch("^" + string(i) + "$", string(i), false)[0] == string(i) |> assert();
+			}
+			__regexMatch("^(\d+)-(\d+)$", "3-10", false)[2] == "10" |> assert();
+			__regexMatch("^a", "b", false) == nil |> assert();
+		`,
+		93: `
+			log := [];
+			exits := |n| {
+				for (i := 0; i < 3; i++) {
+					try {
+						if (i == n) {
+							return "ret" + string(i);
+						}
+						if (i == 0) {
+							continue
+						}
+						if (i == 2) {
+							break
+						}
+					} finally {
+						for (j := 0; j < 3; j++) {
+							if (j == 1) {
+								break
+							}
+							log |> push(i);
+						}
+					}
+				}
+				return "end";
+			};
+			exits(1) == "ret1" && len(log) == 2 && log[0] == 0 && log[1] == 1 |> assert();
+			log = [];
+			exits(5) == "end" && len(log) == 3 && log[2] == 2 |> assert();
+
+			order := [];
+			g := || {
+				try {
+					try {
+						return 1;
+					} finally {
+						order |> push("inner");
+					}
+				} finally {
+					order |> push("outer");
+				}
+			};
+			g() == 1 && len(order) == 2 && order[0] == "inner" && order[1] == "outer" |> assert();
+
+			ran := 0;
+			h := || {
+				try {
+					raise error("boom");
+				} catch (e) {
+					raise error(e.msg + "!");
+				} finally {
+					ran = ran + 1;
+				}
+			};
+			err := try h();
+			err.msg == "boom!" && ran == 1 |> assert();
+			for (k in [1, 2, 3]) {
+				try {
+					if (k == 2) {
+						break
+					}
+				} finally {
+					ran = ran + 1;
+				}
+			}
+			ran == 3 |> assert();
+		`,
+		94: `
+			io := import("io");
+			json := import("json");
+			fiber := import("fiber");
+			dir := tempDir();
+			io.writeFile(io.join(dir, "b.wvr"), "return {x: 41};");
+			io.writeFile(io.join(dir, "a.wvr"), "return import(" + json.stringify("b.wvr") + ").x + 1;");
+			io.writeFile(io.join(dir, "c.wvr"), "return import(" + json.stringify("d.wvr") + ");");
+			io.writeFile(io.join(dir, "d.wvr"), "return import(" + json.stringify("c.wvr") + ");");
+
+			tasks := [];
+			for (i in 0..10) {
+				tasks |> push(fiber.run(|| import(io.join(dir, "a.wvr"))));
+			}
+			for (r in fiber.wait(tasks)) {
+				r == 42 |> assert();
+			}
+			import(io.join(dir, "a.wvr")) == 42 |> assert();
+			(try import(io.join(dir, "c.wvr"))) |> isError() |> assert();
+			(try import(io.join(dir, "missing.wvr"))) |> isError() |> assert();
+		`,
 	}
 
 	for i, tc := range tests {
@@ -734,12 +2313,18 @@ func TestVM(t *testing.T) {
 					RegisterFunc("tempDir", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
 						return vm.NewString(t.TempDir()), true
 					}).
+					RegisterFunc("goPanic", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+						panic(args.Args[0].String())
+					}).
 					Build()
 				c := compiler.New(reg)
 				instructions, vars, constants, err := c.Compile(ircr)
 				assert.NoError(err)
 
-				executor := vm.NewExecutor(builtin.StdReg)
+				executor := vm.NewExecutor(
+					builtin.StdReg,
+					vm.WithArgs([]string{"a", "--b"}),
+				)
 				task := executor.Run(
 					vm.NewFunction(vm.FunctionValue{
 						Instructions: instructions,
@@ -755,3 +2340,180 @@ func TestVM(t *testing.T) {
 		}
 	}
 }
+
+// TestOSProcessState changes the working directory and signals the test
+// process, so it doesn't run in parallel with the script tests.
+func TestOSProcessState(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals can't be sent to the current process on windows")
+	}
+
+	reg := vm.NewRegBuilderFrom(builtin.StdReg).
+		RegisterFunc("tempDir", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			return vm.NewString(t.TempDir()), true
+		}).
+		RegisterFunc("sendSignal", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			p, err := os.FindProcess(os.Getpid())
+			if err == nil {
+				err = p.Signal(syscall.SIGHUP)
+			}
+			if err != nil {
+				return vm.NewErrFromErr(err), false
+			}
+			return vm.Value{}, true
+		}).
+		Build()
+
+	fn := compileScript(t, reg, `
+		os := import("os");
+		io := import("io");
+
+		cwd := os.cwd();
+		dir := tempDir();
+		os.chdir(dir);
+		os.cwd() != cwd |> assert();
+		os.chdir(cwd);
+		os.cwd() == cwd |> assert();
+		(try os.chdir(io.join(dir, "missing"))) |> isError() |> assert();
+
+		got := nil;
+		stop := os.onSignal("SIGHUP", |s| { got = s; });
+		sendSignal();
+		for (i := 0; i < 200 && got == nil; i++) {
+			sleep(10);
+		}
+		stop();
+		stop();
+		got == "SIGHUP" |> assert();
+	`)
+
+	val, _ := vm.NewExecutor(reg).Run(fn).Wait()
+	if val.IsError() {
+		t.Error(val.GetError())
+	}
+}
+
+func TestRaceDetection(t *testing.T) {
+	holding := make(chan struct{})
+	release := make(chan struct{})
+
+	reg := vm.NewRegBuilderFrom(builtin.StdReg).
+		RegisterFunc("holdWrite", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			return v.Mutate(args.Args[0], func() {
+				close(holding)
+				<-release
+			})
+		}).
+		RegisterFunc("waitHolding", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			<-holding
+			return vm.Value{}, true
+		}).
+		RegisterFunc("release", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			close(release)
+			return vm.Value{}, true
+		}).
+		Build()
+
+	fn := compileScript(t, reg, `
+		fiber := import("fiber");
+		obj := {a: 1};
+		t := fiber.run(|| holdWrite(obj));
+		waitHolding();
+
+		write := || { obj.a = 2; };
+		writeErr := try write();
+		writeErr |> isError() |> assert();
+		readErr := try obj.a;
+		readErr |> isError() |> assert();
+
+		release();
+		fiber.wait(t);
+		write();
+		obj.a == 2 |> assert();
+	`)
+
+	executor := vm.NewExecutor(reg, vm.WithRaceDetection(true))
+	val, _ := executor.Run(fn).Wait()
+	if val.IsError() {
+		t.Error(val.GetError())
+	}
+}
+
+func TestExecutorScheduling(t *testing.T) {
+	assert := require.New(t)
+
+	var (
+		mu    sync.Mutex
+		order []int
+	)
+
+	reg := vm.NewRegBuilderFrom(builtin.StdReg).
+		RegisterFunc("record", func(v *vm.VM, args vm.NativeFunctionArgs) (vm.Value, bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, int(args.Args[0].GetNumber()))
+			return vm.Value{}, true
+		}).
+		Build()
+
+	executor := vm.NewExecutor(reg, vm.WithMaxConcurrency(1), vm.WithQueueSize(2))
+
+	work, ok := executor.Run(compileScript(t, reg, `
+		return |n, ms| {
+			sleep(ms);
+			record(n);
+		};
+	`)).Wait()
+	assert.True(ok)
+
+	blocker := executor.Run(work, vm.NewNumber(0), vm.NewNumber(100))
+	low := executor.RunWithOptions(context.Background(), vm.TaskOptions{Priority: 0}, work, vm.NewNumber(1), vm.NewNumber(1))
+	high := executor.RunWithOptions(context.Background(), vm.TaskOptions{Priority: 5}, work, vm.NewNumber(2), vm.NewNumber(1))
+
+	metrics := executor.Metrics()
+	assert.Equal(1, metrics.Active)
+	assert.Equal(2, metrics.Queued)
+
+	// the queue is full so this blocks until ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	rejected := executor.RunContext(ctx, work, vm.NewNumber(3), vm.NewNumber(1))
+	val, ok := rejected.Join()
+	assert.False(ok)
+	assert.True(vm.IsCancelledErr(val))
+
+	for _, task := range []*vm.ExecutorTask{blocker, low, high} {
+		_, ok := task.Wait()
+		assert.True(ok)
+	}
+
+	mu.Lock()
+	assert.Equal([]int{0, 2, 1}, order)
+	mu.Unlock()
+
+	assert.Eventually(func() bool {
+		metrics := executor.Metrics()
+		return metrics.Active == 0 && metrics.Queued == 0 && metrics.Completed == 4 && metrics.Failed == 1
+	}, time.Second, time.Millisecond)
+	assert.Positive(executor.Metrics().PoolSize)
+}
+
+// compileScript compiles src to a function that runs it.
+func compileScript(t *testing.T, reg *vm.Registry, src string) vm.Value {
+	assert := require.New(t)
+
+	p, err := parser.Parse(src)
+	assert.NoError(err)
+
+	ircr, err := ir.NewCompiler().Compile("<test>", p)
+	assert.NoError(err)
+
+	instructions, vars, constants, err := compiler.New(reg).Compile(ircr)
+	assert.NoError(err)
+
+	return vm.NewFunction(vm.FunctionValue{
+		Instructions: instructions,
+		NumVars:      vars,
+		Constants:    constants,
+	})
+}